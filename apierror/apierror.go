@@ -0,0 +1,185 @@
+// Package apierror is the error envelope shared by the lambdas behind API
+// Gateway. Every error response carries a machine readable code, which
+// decides its status, and a message:
+//
+//	{"code": "validation_failed", "error": "Adding Title not specified"}
+//
+// Only internal errors are returned to the lambda runtime as Go errors, so
+// that client mistakes do not count as function failures.
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Code is the machine readable kind of an error.
+type Code string
+
+const (
+	ValidationFailed   Code = "validation_failed"
+	Unauthorized       Code = "unauthorized"
+	NotFound           Code = "not_found"
+	MethodNotAllowed   Code = "method_not_allowed"
+	NotAcceptable      Code = "not_acceptable"
+	Conflict           Code = "conflict"
+	Gone               Code = "gone"
+	PreconditionFailed Code = "precondition_failed"
+	Unprocessable      Code = "unprocessable"
+	Throttled          Code = "throttled"
+	Internal           Code = "internal"
+	NotImplemented     Code = "not_implemented"
+	Unavailable        Code = "unavailable"
+)
+
+var statuses = map[Code]int{
+	ValidationFailed:   http.StatusBadRequest,
+	Unauthorized:       http.StatusUnauthorized,
+	NotFound:           http.StatusNotFound,
+	MethodNotAllowed:   http.StatusMethodNotAllowed,
+	NotAcceptable:      http.StatusNotAcceptable,
+	Conflict:           http.StatusConflict,
+	Gone:               http.StatusGone,
+	PreconditionFailed: http.StatusPreconditionFailed,
+	Unprocessable:      http.StatusUnprocessableEntity,
+	Throttled:          http.StatusTooManyRequests,
+	Internal:           http.StatusInternalServerError,
+	NotImplemented:     http.StatusNotImplemented,
+	Unavailable:        http.StatusServiceUnavailable,
+}
+
+// ForStatus returns the code answered with the HTTP status code, Internal
+// for statuses without one.
+func ForStatus(status int) Code {
+	for code, s := range statuses {
+		if s == status {
+			return code
+		}
+	}
+	return Internal
+}
+
+// Status is the HTTP status code answered for the code, 500 for codes
+// that are not known.
+func (c Code) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrMethodNotAllowed is the error of a request with a method the lambda
+// does not serve.
+var ErrMethodNotAllowed = errors.New("Method not allowed")
+
+// Error is an error answered to the client. Details are extra fields of
+// the envelope, such as the current state of the item a write conflicted
+// with, and Err is the error it was made from, if any.
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]interface{}
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns an error with the code and message.
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Wrap returns an error with the code and the message of err.
+func Wrap(code Code, err error) *Error {
+	return &Error{Code: code, Message: err.Error(), Err: err}
+}
+
+// With adds a field to the envelope of the error.
+func (e *Error) With(name string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	e.Details[name] = value
+	return e
+}
+
+// Body is the JSON envelope of the error.
+func (e *Error) Body() string {
+	envelope := map[string]interface{}{}
+	for name, value := range e.Details {
+		envelope[name] = value
+	}
+	envelope["code"] = e.Code
+	envelope["error"] = e.Message
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		body, _ = json.Marshal(map[string]string{"code": string(Internal), "error": err.Error()})
+	}
+	return string(body)
+}
+
+// As returns err as an *Error, taking any error that is not one for an
+// internal error.
+func As(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return Wrap(Internal, err)
+}
+
+// internalMessage is all the client gets to see of an internal error.
+const internalMessage = "Internal error"
+
+// Sanitize returns err as it is answered to the client: As err, except
+// that an internal error from the AWS SDK is the error FromAWS translates
+// it to, and any other internal error answers internalMessage. Either way
+// the full error is logged.
+func Sanitize(err error) *Error {
+	apiErr := As(err)
+	if apiErr.Code == Internal {
+		if mapped, ok := FromAWS(apiErr.Err); ok {
+			logAWS(apiErr.Err)
+			apiErr = mapped
+		} else if apiErr.Message != internalMessage {
+			fmt.Println("Got internal error: " + strings.ReplaceAll(apiErr.Message, "\n", " "))
+			apiErr = &Error{Code: Internal, Message: internalMessage, Details: apiErr.Details, Err: apiErr}
+		}
+	}
+	return apiErr
+}
+
+// Response answers err with the status of its code and its envelope, plus
+// the given headers, after passing it through Sanitize. The Go error
+// returned is err for internal and unavailable errors, which Lambda should
+// see as function errors, and nil for everything else.
+func Response(err error, headers map[string]string) (events.APIGatewayProxyResponse, error) {
+	apiErr := Sanitize(err)
+	status := apiErr.Code.Status()
+	if apiErr.Code == Throttled {
+		if headers == nil {
+			headers = map[string]string{}
+		}
+		headers["Retry-After"] = "1"
+	}
+	apiResponse := events.APIGatewayProxyResponse{
+		Headers:    headers,
+		Body:       apiErr.Body(),
+		StatusCode: status,
+	}
+	if apiErr.Code == Internal || apiErr.Code == Unavailable {
+		return apiResponse, err
+	}
+	return apiResponse, nil
+}
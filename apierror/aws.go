@@ -0,0 +1,70 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// awsCodes maps the codes of AWS errors to the code and the message the
+// client gets instead of the raw error, which names tables and attributes.
+var awsCodes = map[string]struct {
+	code    Code
+	message string
+}{
+	dynamodb.ErrCodeConditionalCheckFailedException:          {Conflict, "The item was changed by another request"},
+	dynamodb.ErrCodeTransactionCanceledException:             {Conflict, "The write conflicted with another request"},
+	dynamodb.ErrCodeTransactionConflictException:             {Conflict, "The write conflicted with another request"},
+	dynamodb.ErrCodeProvisionedThroughputExceededException:   {Throttled, "Too many requests, try again later"},
+	dynamodb.ErrCodeRequestLimitExceeded:                     {Throttled, "Too many requests, try again later"},
+	"ThrottlingException":                                    {Throttled, "Too many requests, try again later"},
+	dynamodb.ErrCodeResourceNotFoundException:                {Unavailable, "Storage is not available"},
+	dynamodb.ErrCodeInternalServerError:                      {Unavailable, "Storage is not available"},
+	"ValidationException":                                    {ValidationFailed, "The request could not be stored"},
+	dynamodb.ErrCodeItemCollectionSizeLimitExceededException: {ValidationFailed, "The request could not be stored"},
+	dynamodb.ErrCodeTransactionInProgressException:           {Conflict, "The write conflicted with another request"},
+}
+
+// FromAWS translates an error of the AWS SDK into the error answered for
+// it, keeping the SDK error as Err. A transaction canceled because one of
+// its items was throttled counts as throttled. Codes that are not known
+// are internal errors, with a message that does not leak the raw error.
+// ok is false for errors that do not come from the SDK.
+func FromAWS(err error) (*Error, bool) {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return nil, false
+	}
+	code := aerr.Code()
+	var canceled *dynamodb.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		for _, reason := range canceled.CancellationReasons {
+			if reason.Code != nil && *reason.Code == "ThrottlingError" {
+				code = dynamodb.ErrCodeProvisionedThroughputExceededException
+			}
+		}
+	}
+	mapped, ok := awsCodes[code]
+	if !ok {
+		return &Error{Code: Internal, Message: internalMessage, Err: err}, true
+	}
+	return &Error{Code: mapped.code, Message: mapped.message, Err: err}, true
+}
+
+// logAWS prints the full SDK error with the ID of the AWS request, which
+// the client does not get to see.
+func logAWS(err error) {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return
+	}
+	requestID := "unknown"
+	var failure awserr.RequestFailure
+	if errors.As(err, &failure) && failure.RequestID() != "" {
+		requestID = failure.RequestID()
+	}
+	fmt.Println("Got AWS error (request " + requestID + "): " + strings.ReplaceAll(aerr.Error(), "\n", " "))
+}
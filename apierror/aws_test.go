@@ -0,0 +1,112 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const rawMessage = "One or more parameter values were invalid: table Todos"
+
+func requestFailure(code string) error {
+	return awserr.NewRequestFailure(awserr.New(code, rawMessage, nil), http.StatusBadRequest, "REQUEST1")
+}
+
+func TestResponseFromAWS(t *testing.T) {
+	cases := []struct {
+		name       string
+		err        error
+		status     int
+		code       Code
+		message    string
+		retryAfter string
+	}{
+		{"conditional check", requestFailure(dynamodb.ErrCodeConditionalCheckFailedException), http.StatusConflict, Conflict, "The item was changed by another request", ""},
+		{"throughput", requestFailure(dynamodb.ErrCodeProvisionedThroughputExceededException), http.StatusTooManyRequests, Throttled, "Too many requests, try again later", "1"},
+		{"missing table", requestFailure(dynamodb.ErrCodeResourceNotFoundException), http.StatusServiceUnavailable, Unavailable, "Storage is not available", ""},
+		{"validation", requestFailure("ValidationException"), http.StatusBadRequest, ValidationFailed, "The request could not be stored", ""},
+		{"unknown code", requestFailure("SomethingNew"), http.StatusInternalServerError, Internal, "Internal error", ""},
+		{"throttled transaction", &dynamodb.TransactionCanceledException{
+			Message_:            aws.String(rawMessage),
+			CancellationReasons: []*dynamodb.CancellationReason{{Code: aws.String("None")}, {Code: aws.String("ThrottlingError")}},
+		}, http.StatusTooManyRequests, Throttled, "Too many requests, try again later", "1"},
+		{"canceled transaction", &dynamodb.TransactionCanceledException{
+			Message_:            aws.String(rawMessage),
+			CancellationReasons: []*dynamodb.CancellationReason{{Code: aws.String("ConditionalCheckFailed")}},
+		}, http.StatusConflict, Conflict, "The write conflicted with another request", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			apiResponse, err := Response(c.err, nil)
+			if apiResponse.StatusCode != c.status {
+				t.Errorf("got status %d, want %d", apiResponse.StatusCode, c.status)
+			}
+			body := map[string]string{}
+			if err := json.Unmarshal([]byte(apiResponse.Body), &body); err != nil {
+				t.Fatalf("body is not an envelope: %s", apiResponse.Body)
+			}
+			if body["code"] != string(c.code) || body["error"] != c.message {
+				t.Errorf("got %s %q, want %s %q", body["code"], body["error"], c.code, c.message)
+			}
+			if strings.Contains(apiResponse.Body, "Todos") || strings.Contains(apiResponse.Body, "REQUEST1") {
+				t.Errorf("body leaks the AWS error: %s", apiResponse.Body)
+			}
+			if apiResponse.Headers["Retry-After"] != c.retryAfter {
+				t.Errorf("got Retry-After %q, want %q", apiResponse.Headers["Retry-After"], c.retryAfter)
+			}
+			if (err != nil) != (c.status >= http.StatusInternalServerError) {
+				t.Errorf("got Go error %v for status %d", err, c.status)
+			}
+		})
+	}
+}
+
+func TestFromAWSIgnoresOtherErrors(t *testing.T) {
+	if _, ok := FromAWS(errors.New("plain")); ok {
+		t.Error("a plain error was taken for an AWS error")
+	}
+	apiResponse, err := Response(New(NotFound, "Todo not found"), nil)
+	if apiResponse.StatusCode != http.StatusNotFound || err != nil {
+		t.Errorf("got %d %v, want 404 without a Go error", apiResponse.StatusCode, err)
+	}
+	apiResponse, err = Response(New(NotImplemented, "Not implemented"), nil)
+	if apiResponse.StatusCode != http.StatusNotImplemented || err != nil {
+		t.Errorf("got %d %v, want 501 without a Go error", apiResponse.StatusCode, err)
+	}
+}
+
+func TestResponseHidesInternalErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+	}{
+		{"plain error", errors.New("open /var/task/config.json: no such file")},
+		{"wrapped internal", Wrap(Internal, errors.New("marshal Todos: unsupported value"))},
+		{"new internal", New(Internal, "position a0 of table Todos is full")},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			apiResponse, err := Response(c.err, nil)
+			if apiResponse.StatusCode != http.StatusInternalServerError || err != c.err {
+				t.Errorf("got %d %v, want 500 with the error for Lambda", apiResponse.StatusCode, err)
+			}
+			body := map[string]string{}
+			if err := json.Unmarshal([]byte(apiResponse.Body), &body); err != nil {
+				t.Fatalf("body is not an envelope: %s", apiResponse.Body)
+			}
+			if body["code"] != string(Internal) || body["error"] != internalMessage {
+				t.Errorf("got %s %q, want %s %q", body["code"], body["error"], Internal, internalMessage)
+			}
+		})
+	}
+	raw := errors.New("raw")
+	if sanitized := Sanitize(raw); !errors.Is(sanitized, raw) {
+		t.Errorf("got %+v, want the raw error kept", sanitized)
+	}
+}
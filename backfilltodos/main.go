@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/shikang/aws-lambdas/todo"
+)
+
+// backfilltodos gives the todos written before PositionIndex, StatusIndex
+// and DueIndex existed the attributes those indexes are keyed on, so GET
+// /todos lists them and reminders find them again, and the lists written
+// before ListOwnerIndex their OwnerKey and the TodoCount DELETE
+// /lists/{id} goes by. Run it once after creating the indexes; running it
+// again only picks up what is missing. With -search it also rebuilds the
+// search index from the todos, for the todos written before TodoSearch
+// existed or that the lambdas failed to index.
+var (
+	table    = flag.String("table", todo.TableName, "todos table to backfill")
+	endpoint = flag.String("endpoint", "", "DynamoDB endpoint, e.g. http://localhost:8000 for DynamoDB Local")
+	search   = flag.Bool("search", false, "also rebuild the search index")
+)
+
+func main() {
+	flag.Parse()
+
+	config := aws.NewConfig().WithRegion("ap-southeast-1")
+	if *endpoint != "" {
+		config = config.WithEndpoint(*endpoint)
+	}
+	db := dynamodb.New(session.New(), config)
+	store := todo.NewDynamoStore(db, *table)
+	updated, err := store.BackfillIndexKeys()
+	fmt.Printf("Backfilled %d todos\n", updated)
+	if err != nil {
+		fmt.Println("Got error backfilling todos: " + err.Error())
+		os.Exit(1)
+	}
+	updated, err = store.BackfillLists()
+	fmt.Printf("Backfilled %d lists\n", updated)
+	if err != nil {
+		fmt.Println("Got error backfilling lists: " + err.Error())
+		os.Exit(1)
+	}
+	if *search {
+		indexed, err := store.ReindexSearch(todo.NewDynamoSearchIndex(db, todo.SearchTableName))
+		fmt.Printf("Reindexed %d todos\n", indexed)
+		if err != nil {
+			fmt.Println("Got error reindexing todos: " + err.Error())
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/shikang/aws-lambdas/todo"
+)
+
+// benchtodos compares the read capacity consumed by listing open todos
+// with the filtered Scan GetTodosByCompleted used to run and with the
+// StatusIndex Query that replaced it. It seeds todos for a new owner and
+// for other owners first, so run it against DynamoDB Local or a scratch
+// table provisioned with createtables.
+var (
+	endpoint = flag.String("endpoint", "http://localhost:8000", "DynamoDB endpoint, empty for the tables in the region")
+	table    = flag.String("table", todo.TableName, "todos table")
+	mine     = flag.Int("n", 1000, "todos to seed for the benchmark owner")
+	others   = flag.Int("others", 4000, "todos to seed for other owners")
+	done     = flag.Float64("done", 0.9, "fraction of the seeded todos that are completed")
+	limit    = flag.Int64("limit", 10, "page size")
+)
+
+// meter asks every Query and Scan for its consumed capacity and adds it up.
+type meter struct {
+	dynamodbiface.DynamoDBAPI
+	calls    int
+	scanned  int64
+	capacity float64
+}
+
+func (m *meter) reset() {
+	m.calls, m.scanned, m.capacity = 0, 0, 0
+}
+
+func (m *meter) add(capacity *dynamodb.ConsumedCapacity, scanned *int64) {
+	m.calls++
+	m.scanned += aws.Int64Value(scanned)
+	if capacity != nil {
+		m.capacity += aws.Float64Value(capacity.CapacityUnits)
+	}
+}
+
+func (m *meter) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	input.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+	output, err := m.DynamoDBAPI.Query(input)
+	if err == nil {
+		m.add(output.ConsumedCapacity, output.ScannedCount)
+	}
+	return output, err
+}
+
+func (m *meter) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	input.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+	output, err := m.DynamoDBAPI.Scan(input)
+	if err == nil {
+		m.add(output.ConsumedCapacity, output.ScannedCount)
+	}
+	return output, err
+}
+
+// seed adds n todos for owner through the batch handler, so they get the
+// attributes the handlers maintain.
+func seed(handler *todo.Handler, owner string, n int) error {
+	for start := 0; start < n; start += 500 {
+		ops := []todo.BatchOperation{}
+		for i := start; i < n && i < start+500; i++ {
+			completed := float64(i%100) < *done*100
+			ops = append(ops, todo.BatchOperation{Op: "add", Title: "Todo " + strconv.Itoa(i), Completed: &completed})
+		}
+		_, err := handler.BatchTodos(owner, ops)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanOpen lists open todos of owner the way GetTodosByCompleted did
+// before StatusIndex: a Scan filtered on the owner and Completed, read
+// until limit todos matched (all of them for a limit of 0).
+func scanOpen(db dynamodbiface.DynamoDBAPI, owner string, limit int64) (int, error) {
+	filt := expression.Name("Owner").Equal(expression.Value(owner)).
+		And(expression.AttributeNotExists(expression.Name("DeletedAt"))).
+		And(expression.Name("Completed").Equal(expression.Value(false)))
+	expr, err := expression.NewBuilder().WithFilter(filt).Build()
+	if err != nil {
+		return 0, err
+	}
+
+	found := 0
+	var startKey map[string]*dynamodb.AttributeValue
+	for {
+		input := &dynamodb.ScanInput{
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			FilterExpression:          expr.Filter(),
+			TableName:                 aws.String(*table),
+			ExclusiveStartKey:         startKey,
+		}
+		if limit > 0 {
+			input.Limit = aws.Int64(limit - int64(found))
+		}
+		result, err := db.Scan(input)
+		if err != nil {
+			return found, err
+		}
+		found += len(result.Items)
+		startKey = result.LastEvaluatedKey
+		if len(startKey) == 0 || (limit > 0 && int64(found) >= limit) {
+			return found, nil
+		}
+	}
+}
+
+func report(name string, m *meter, found int, took time.Duration) {
+	fmt.Printf("%-28s %6d todos %4d calls %7d read %9.1f RCU %8s\n", name, found, m.calls, m.scanned, m.capacity, took.Round(time.Millisecond))
+}
+
+func main() {
+	flag.Parse()
+
+	config := aws.NewConfig().WithRegion("ap-southeast-1")
+	if *endpoint != "" {
+		config = config.WithEndpoint(*endpoint)
+	}
+	db := &meter{DynamoDBAPI: dynamodb.New(session.New(), config)}
+	store := todo.NewDynamoStore(db, *table)
+	handler := &todo.Handler{Store: store}
+
+	owner := "bench-" + strconv.FormatInt(time.Now().Unix(), 10)
+	fmt.Printf("Seeding %d todos for %s and %d for other owners\n", *mine, owner, *others)
+	if err := seed(handler, owner, *mine); err != nil {
+		fmt.Println("Got error seeding: " + err.Error())
+		os.Exit(1)
+	}
+	for i := 0; i < *others; i += 1000 {
+		n := *others - i
+		if n > 1000 {
+			n = 1000
+		}
+		if err := seed(handler, owner+"-other-"+strconv.Itoa(i), n); err != nil {
+			fmt.Println("Got error seeding: " + err.Error())
+			os.Exit(1)
+		}
+	}
+
+	open := false
+	for _, pageSize := range []int64{*limit, 0} {
+		label := "first page"
+		if pageSize == 0 {
+			label = "all open"
+		}
+
+		db.reset()
+		start := time.Now()
+		found, err := scanOpen(db, owner, pageSize)
+		if err != nil {
+			fmt.Println("Got error scanning: " + err.Error())
+			os.Exit(1)
+		}
+		report("Scan, "+label, db, found, time.Since(start))
+
+		db.reset()
+		start = time.Now()
+		todos, _, err := store.Query(todo.TodoQuery{Owner: owner, Completed: &open, Limit: pageSize})
+		if err != nil {
+			fmt.Println("Got error querying: " + err.Error())
+			os.Exit(1)
+		}
+		report("StatusIndex Query, "+label, db, len(todos), time.Since(start))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/shikang/aws-lambdas/todo"
+)
+
+// createtables creates the DynamoDB tables and indexes of the todo API,
+// or adds what is missing to existing ones. Pass -endpoint to provision
+// DynamoDB Local instead of the tables in the region.
+var (
+	region   = flag.String("region", "ap-southeast-1", "AWS region")
+	endpoint = flag.String("endpoint", "", "DynamoDB endpoint, e.g. http://localhost:8000 for DynamoDB Local")
+)
+
+func main() {
+	flag.Parse()
+
+	config := aws.NewConfig().WithRegion(*region)
+	if *endpoint != "" {
+		config = config.WithEndpoint(*endpoint)
+	}
+	err := todo.Provision(dynamodb.New(session.New(), config))
+	if err != nil {
+		fmt.Println("Got error provisioning tables: " + err.Error())
+		os.Exit(1)
+	}
+	fmt.Println("Tables are ready")
+}
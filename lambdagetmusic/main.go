@@ -2,7 +2,6 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 
@@ -13,14 +12,11 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/shikang/aws-lambdas/apierror"
 )
 
 var db = dynamodb.New(session.New(), aws.NewConfig().WithRegion("ap-southeast-1"))
 
-type ErrorJson struct {
-	ErrorMsg string `json:"error"`
-}
-
 type Music struct {
 	Artist    string `json:"artist"`
 	SongTitle string `json:"songTitle"`
@@ -60,34 +56,24 @@ func getArtistMusic(artist string) ([]Music, error) {
 func getArtistMusicResponse(artist string) (events.APIGatewayProxyResponse, error) {
 	musics, err := getArtistMusic(artist)
 	if err != nil {
-		apiResponse := generateErrorResponse(err.Error(), http.StatusInternalServerError)
-		return apiResponse, err
+		return apierror.Response(apierror.Wrap(apierror.Internal, err), nil)
 	}
 
 	responseBody, err := json.Marshal(musics)
 	if err != nil {
-		apiResponse := generateErrorResponse(err.Error(), http.StatusInternalServerError)
-		return apiResponse, err
+		return apierror.Response(apierror.Wrap(apierror.Internal, err), nil)
 	}
 
 	apiResponse := events.APIGatewayProxyResponse{Body: string(responseBody), StatusCode: http.StatusOK}
 	return apiResponse, nil
 }
 
-func generateErrorResponse(err string, statusCode int) events.APIGatewayProxyResponse {
-	errJSON := &ErrorJson{ErrorMsg: err}
-	errBody, _ := json.Marshal(errJSON)
-	apiResponse := events.APIGatewayProxyResponse{Body: string(errBody), StatusCode: statusCode}
-	return apiResponse
-}
-
 func HandleGetMusicRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	if request.HTTPMethod == "POST" {
 		queryJson := Music{}
 		err := json.Unmarshal([]byte(request.Body), &queryJson)
 		if err != nil {
-			apiResponse := generateErrorResponse(err.Error(), http.StatusInternalServerError)
-			return apiResponse, err
+			return apierror.Response(apierror.Wrap(apierror.ValidationFailed, err), nil)
 		}
 
 		fmt.Print("[POST] Get music from artist: " + queryJson.Artist)
@@ -97,14 +83,10 @@ func HandleGetMusicRequest(request events.APIGatewayProxyRequest) (events.APIGat
 			fmt.Print("[GET] Get music from artist: " + artist)
 			return getArtistMusicResponse(artist)
 		} else {
-			err := errors.New("Empty query string")
-			apiResponse := generateErrorResponse("Empty query string", http.StatusBadGateway)
-			return apiResponse, err
+			return apierror.Response(apierror.New(apierror.ValidationFailed, "Empty query string"), nil)
 		}
 	} else {
-		err := errors.New("Method not allowed")
-		apiResponse := generateErrorResponse("Method Not OK", http.StatusBadGateway)
-		return apiResponse, err
+		return apierror.Response(apierror.Wrap(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed), nil)
 	}
 }
 
@@ -1,161 +1,36 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"net/http"
-	"strconv"
+	"log"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/shikang/aws-lambdas/todo"
 )
 
 var db = dynamodb.New(session.New(), aws.NewConfig().WithRegion("ap-southeast-1"))
 
-type ErrorJson struct {
-	ErrorMsg string `json:"error"`
-}
-
-type Todos struct {
-	ID        string `json:"id"`
-	Title     string `json:"title"`
-	Completed bool   `json:"completed"`
-}
-
-func GetTodosWithoutAnyFilters(limit int64) ([]Todos, error) {
-	// Build the scan input parameters
-	params := &dynamodb.ScanInput{
-		TableName: aws.String("Todos"),
-		Limit:     aws.Int64(limit),
-	}
-
-	// Make the DynamoDB Query API call
-	result, err := db.Scan(params)
-	if err != nil {
-		return nil, err
-	}
-
-	todos := []Todos{}
-	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &todos)
-	if err != nil {
-		return nil, err
-	}
-
-	return todos, nil
-}
-
-func GetTodosByCompleted(val bool, limit int64) ([]Todos, error) {
-	filt := expression.Name("Completed").Equal(expression.Value(val))
-	expr, err := expression.NewBuilder().WithFilter(filt).Build()
-	if err != nil {
-		return nil, err
-	}
-
-	// Build the query input parameters
-	params := &dynamodb.ScanInput{
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		FilterExpression:          expr.Filter(),
-		ProjectionExpression:      expr.Projection(),
-		TableName:                 aws.String("Todos"),
-		Limit:                     aws.Int64(limit),
-	}
-
-	// Make the DynamoDB Query API call
-	result, err := db.Scan(params)
-	if err != nil {
-		return nil, err
-	}
-
-	todos := []Todos{}
-	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &todos)
-	if err != nil {
-		return nil, err
-	}
-
-	return todos, nil
-}
-
-func GetTodos(filter string, val string, limit int64) ([]Todos, error) {
-	if val == "any" {
-		return GetTodosWithoutAnyFilters(limit)
-	}
-
-	switch filter {
-	case "completed":
-		completed, err := strconv.ParseBool(val)
-		if err != nil {
-			return nil, err
-		}
-		return GetTodosByCompleted(completed, limit)
-	default:
-		err := errors.New("Invalid filter")
-		return nil, err
-	}
-}
-
-func GetTodosResponse(filters string, val string, limit int64) (events.APIGatewayProxyResponse, error) {
-	todos, err := GetTodos(filters, val, limit)
+func main() {
+	secret, err := todo.CursorSecretFromEnv()
 	if err != nil {
-		apiResponse := GenerateErrorResponse(err.Error(), http.StatusInternalServerError)
-		return apiResponse, err
+		log.Fatal(err)
 	}
 
-	responseBody, err := json.Marshal(todos)
-	if err != nil {
-		apiResponse := GenerateErrorResponse(err.Error(), http.StatusInternalServerError)
-		return apiResponse, err
+	handler := &todo.Handler{
+		Store:          todo.NewDynamoStore(db, todo.TableName),
+		CursorSecret:   secret,
+		AllowAnonymous: todo.AllowAnonymousFromEnv(),
+		Search:         todo.NewDynamoSearchIndex(db, todo.SearchTableName),
 	}
-
-	apiResponse := events.APIGatewayProxyResponse{
-		Headers: map[string]string{
-			"Access-Control-Allow-Origin": "*",
-		},
-		Body:       string(responseBody),
-		StatusCode: http.StatusOK}
-	return apiResponse, nil
-}
-
-func GenerateErrorResponse(err string, statusCode int) events.APIGatewayProxyResponse {
-	errJSON := &ErrorJson{ErrorMsg: err}
-	errBody, _ := json.Marshal(errJSON)
-	apiResponse := events.APIGatewayProxyResponse{
-		Headers: map[string]string{
-			"Access-Control-Allow-Origin": "*",
-		},
-		Body:       string(errBody),
-		StatusCode: statusCode}
-	return apiResponse
-}
-
-func HandleGetTodosRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	if request.HTTPMethod == "GET" {
-		if completed, ok := request.QueryStringParameters["completed"]; ok {
-			var queryLimit int64 = 10
-			if limit, ok := request.QueryStringParameters["limit"]; ok {
-				queryLimit, _ = strconv.ParseInt(limit, 10, 64)
-			}
-
-			fmt.Print("[GET] Get todos with completed filter: " + completed)
-			return GetTodosResponse("completed", completed, queryLimit)
-		} else {
-			err := errors.New("Empty query string")
-			apiResponse := GenerateErrorResponse("Empty query string", http.StatusBadGateway)
-			return apiResponse, err
+	// Mapped to /todos/{id}/subtree as well, the only resource of this
+	// lambda with an {id}
+	lambda.Start(handler.Authenticated(func(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		if _, ok := request.PathParameters["id"]; ok {
+			return handler.HandleGetSubtreeRequest(request)
 		}
-	} else {
-		err := errors.New("Method not allowed")
-		apiResponse := GenerateErrorResponse("Method Not OK", http.StatusBadGateway)
-		return apiResponse, err
-	}
-}
-
-func main() {
-	lambda.Start(HandleGetTodosRequest)
+		return handler.HandleGetTodosRequest(request)
+	}))
 }
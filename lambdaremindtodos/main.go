@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/ses"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/shikang/aws-lambdas/todo"
+)
+
+var sess = session.New()
+var config = aws.NewConfig().WithRegion("ap-southeast-1")
+var db = dynamodb.New(sess, config)
+
+// notifier picks the notifier from the NOTIFIER environment variable: log
+// (the default), sns (to SNS_TOPIC_ARN) or email (from EMAIL_FROM to the
+// users of the Cognito pool USER_POOL_ID).
+func notifier() todo.Notifier {
+	switch os.Getenv("NOTIFIER") {
+	case "sns":
+		return &todo.SNSNotifier{
+			Client:   sns.New(sess, config),
+			TopicARN: os.Getenv("SNS_TOPIC_ARN"),
+		}
+	case "email":
+		return &todo.EmailNotifier{
+			Client:    ses.New(sess, config),
+			From:      os.Getenv("EMAIL_FROM"),
+			AddressOf: todo.CognitoEmails(cognitoidentityprovider.New(sess, config), os.Getenv("USER_POOL_ID")),
+		}
+	default:
+		return todo.LogNotifier{}
+	}
+}
+
+func main() {
+	reminders := &todo.Reminders{
+		Store:    todo.NewDynamoStore(db, todo.TableName),
+		Log:      todo.NewDynamoReminderLog(db, todo.ReminderTableName),
+		Notifier: notifier(),
+		Window:   todo.ReminderWindowFromEnv(),
+	}
+	lambda.Start(reminders.HandleScheduledEvent)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/shikang/aws-lambdas/todo"
+)
+
+var db = dynamodb.New(session.New(), aws.NewConfig().WithRegion("ap-southeast-1"))
+
+// lambdatodohistory consumes the stream of the Todos table, which has to
+// carry new and old images, and records every write in TodoHistory.
+func main() {
+	recorder := &todo.HistoryRecorder{
+		History: todo.NewDynamoHistoryStore(db, todo.HistoryTableName),
+	}
+	lambda.Start(recorder.HandleStreamEvent)
+}
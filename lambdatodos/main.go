@@ -0,0 +1,30 @@
+package main
+
+import (
+	"log"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/shikang/aws-lambdas/todo"
+)
+
+var db = dynamodb.New(session.New(), aws.NewConfig().WithRegion("ap-southeast-1"))
+
+func main() {
+	secret, err := todo.CursorSecretFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	handler := &todo.Handler{
+		Store:          todo.NewDynamoStore(db, todo.TableName),
+		CursorSecret:   secret,
+		AllowAnonymous: todo.AllowAnonymousFromEnv(),
+		TrashRetention: todo.TrashRetentionFromEnv(),
+		Search:         todo.NewDynamoSearchIndex(db, todo.SearchTableName),
+		History:        todo.NewDynamoHistoryStore(db, todo.HistoryTableName),
+	}
+	lambda.Start(todo.NewTodoRouter(handler).Route)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/shikang/aws-lambdas/todo"
+)
+
+// localtodos serves the todo API on a MemoryStore, so the handlers can be
+// tried without API Gateway or DynamoDB. There is no authorizer locally:
+// the X-Fake-User header (or -user for every request) names the caller,
+// and is passed to the handlers as Cognito claims. Requests naming no
+// caller answer 401 unless -anonymous serves them as the empty owner.
+var (
+	addr      = flag.String("addr", ":8080", "address to listen on")
+	user      = flag.String("user", "", "caller for requests without an X-Fake-User header")
+	anonymous = flag.Bool("anonymous", false, "serve requests without a caller as the empty owner")
+)
+
+func main() {
+	flag.Parse()
+
+	// Writes are recorded as they happen, there is no stream to consume
+	store := todo.NewMemoryStore()
+	history := todo.NewMemoryHistoryStore()
+	recorder := &todo.HistoryRecorder{History: history}
+	store.Stream = func(record todo.StreamRecord) {
+		if err := recorder.Record(record); err != nil {
+			fmt.Println("Got error recording history: " + err.Error())
+		}
+	}
+
+	handler := &todo.Handler{
+		Store:          store,
+		CursorSecret:   []byte("local"),
+		Search:         todo.NewMemorySearchIndex(),
+		History:        history,
+		AllowAnonymous: *anonymous,
+	}
+	router := todo.NewTodoRouter(handler)
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		resource, params, ok := router.Match(r.URL.Path)
+		if !ok {
+			resource = r.URL.Path
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		request := events.APIGatewayProxyRequest{
+			Resource:              resource,
+			Path:                  r.URL.Path,
+			HTTPMethod:            r.Method,
+			Headers:               map[string]string{},
+			QueryStringParameters: map[string]string{},
+			PathParameters:        params,
+			Body:                  string(body),
+		}
+		for name := range r.Header {
+			request.Headers[name] = r.Header.Get(name)
+		}
+		for name := range r.URL.Query() {
+			request.QueryStringParameters[name] = r.URL.Query().Get(name)
+		}
+
+		caller := *user
+		if fake := r.Header.Get("X-Fake-User"); fake != "" {
+			caller = fake
+		}
+		if caller != "" {
+			request = todo.WithFakeClaims(request, caller)
+		}
+
+		response, err := router.Route(request)
+		if err != nil {
+			fmt.Println(r.Method + " " + r.URL.Path + ": " + err.Error())
+		}
+		for name, value := range response.Headers {
+			w.Header().Set(name, value)
+		}
+		w.WriteHeader(response.StatusCode)
+		fmt.Fprint(w, response.Body)
+	})
+
+	log.Println("Serving the todo API on " + *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
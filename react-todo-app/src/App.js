@@ -5,7 +5,7 @@ import Todos from './components/Todos';
 import AddTodo from './components/AddTodo';
 import About from './components/pages/About';
 import axios from 'axios';
-//import uuid from 'uuid'
+import uuid from 'uuid'
 
 import './App.css';
 import Axios from 'axios';
@@ -31,64 +31,185 @@ class App extends Component {
             //    title: 'Meeting with boss',
             //    completed: false
             //}
-        ]
+        ],
+        // Undo-Token of the last write, if it can still be undone
+        undo: null
     }
 
     componentDidMount() {
         //axios.get(`${'https://cors-anywhere.herokuapp.com/'}https://8482ao82ce.execute-api.ap-southeast-1.amazonaws.com/dev/todos?completed=any&limit=10`)
         //    .then(res => this.setState({todos: res.data}));
 
-        axios.get('https://8482ao82ce.execute-api.ap-southeast-1.amazonaws.com/dev/todos?completed=any&limit=10')
-            .then(res => this.setState({todos: res.data}));
+        this.loadTodos('');
+    }
+
+    loadTodos = (cursor) => {
+        axios.get('https://8482ao82ce.execute-api.ap-southeast-1.amazonaws.com/dev/todos',
+            {
+                params: {completed: 'any', limit: 10, cursor: cursor}
+            })
+            .then(res => {
+                this.setState({todos: [...this.state.todos, ...res.data.todos]});
+                if (res.data.next)
+                {
+                    this.loadTodos(res.data.next);
+                }
+            });
+    }
+
+    rememberUndo = (res) => {
+        this.setState({undo: res.headers['undo-token'] || null});
+    }
+
+    // Undoing can touch other todos (subtasks, the next occurrence), so
+    // the list is reloaded; a token that expired or lost to another write
+    // is simply dropped
+    undo = () => {
+        axios.post('https://8482ao82ce.execute-api.ap-southeast-1.amazonaws.com/dev/undo',
+            {
+                token: this.state.undo
+            })
+            .then(() => {
+                this.setState({todos: [], undo: null});
+                this.loadTodos('');
+            })
+            .catch(() => this.setState({undo: null}));
+    }
+
+    replaceTodo = (updated) => {
+        this.setState({todos: this.state.todos.map(todo => (todo.id === updated.id) ? updated : todo)});
+    }
+
+    // A 412 means another tab changed the todo first; show its current state
+    onConflict = (err) => {
+        if (err.response && err.response.status === 412) {
+            this.replaceTodo(err.response.data.current);
+        }
     }
 
     toggleComplete = (id) => {
-        var val = false;
-        this.state.todos.map(todo => {
-            if (todo.id === id) {
-                val = !todo.completed;
-            }
-            return todo;
-        });
+        const todo = this.state.todos.find(todo => todo.id === id);
 
         axios.post('https://8482ao82ce.execute-api.ap-southeast-1.amazonaws.com/dev/todos/update',
             {
                 id: id,
-                completed: val
+                title: todo.title,
+                completed: !todo.completed,
+                version: todo.version
             })
             .then(res => {
                 if (res.data.success)
                 {
-                    this.setState({todos: this.state.todos.map(todo => {
-                        if (todo.id === id) {
-                            todo.completed = val;
-                        }
-                        return todo;
-                    })});
+                    this.replaceTodo(res.data.todo);
+                    this.rememberUndo(res);
                 }
-            });
+            })
+            .catch(this.onConflict);
+    }
+
+    editTodo = (id, title) => {
+        const todo = this.state.todos.find(todo => todo.id === id);
+        axios.post('https://8482ao82ce.execute-api.ap-southeast-1.amazonaws.com/dev/todos/update',
+            {
+                id: id,
+                title: todo.title,
+                newTitle: title,
+                version: todo.version
+            })
+            .then(res => {
+                if (res.data.success)
+                {
+                    this.replaceTodo(res.data.todo);
+                    this.rememberUndo(res);
+                }
+            })
+            .catch(this.onConflict);
     }
 
     deleteTodo = (id) => {
+        const todo = this.state.todos.find(todo => todo.id === id);
         axios.post('https://8482ao82ce.execute-api.ap-southeast-1.amazonaws.com/dev/todos/delete',
             {
                 id: id,
+                title: todo.title,
+                version: todo.version
             })
             .then(res => {
                 if (res.data.success)
                 {
                     this.setState({todos: [...this.state.todos.filter(todo => todo.id !== id)]});
+                    this.rememberUndo(res);
+                }
+            })
+            .catch(this.onConflict);
+    }
+
+    clearCompleted = () => {
+        const completed = this.state.todos.filter(todo => todo.completed);
+        axios.post('https://8482ao82ce.execute-api.ap-southeast-1.amazonaws.com/dev/todos/batch',
+            {
+                operations: completed.map(todo => ({op: 'delete', id: todo.id, title: todo.title, version: todo.version}))
+            })
+            .then(res => {
+                const deleted = res.data.results.filter(result => result.status === 200).map(result => completed[result.index].id);
+                this.setState({todos: [...this.state.todos.filter(todo => !deleted.includes(todo.id))]});
+            });
+    }
+
+    // Moves the todo into the place of the todo it was dropped on, and
+    // tells the server its new neighbours
+    reorderTodo = (id, targetId) => {
+        const todos = this.state.todos.filter(todo => todo.id !== id);
+        const from = this.state.todos.findIndex(todo => todo.id === id);
+        const to = this.state.todos.findIndex(todo => todo.id === targetId);
+        const todo = this.state.todos[from];
+        const index = todos.findIndex(todo => todo.id === targetId) + (from < to ? 1 : 0);
+        todos.splice(index, 0, todo);
+        this.setState({todos: todos});
+
+        const after = todos[index - 1];
+        const before = todos[index + 1];
+        axios.post(`https://8482ao82ce.execute-api.ap-southeast-1.amazonaws.com/dev/todos/${id}/reorder`,
+            {
+                title: todo.title,
+                after: after ? after.id : '',
+                before: before ? before.id : '',
+                version: todo.version
+            })
+            .then(res => {
+                if (res.data.success)
+                {
+                    this.replaceTodo(res.data.todo);
+                }
+            })
+            .catch(err => {
+                // A 409 means the neighbours changed meanwhile; reload the order
+                if (err.response && err.response.status === 409) {
+                    this.setState({todos: []});
+                    this.loadTodos('');
+                } else {
+                    this.onConflict(err);
                 }
             });
     }
 
-    addTodo =  (title) => {
+    // A retry sends the same Idempotency-Key, so the todo is added once
+    addTodo =  (title, key = uuid(), retries = 1) => {
         axios.put('https://8482ao82ce.execute-api.ap-southeast-1.amazonaws.com/dev/todos/add',
             {
                 title: title,
                 completed: false
+            },
+            {headers: {'Idempotency-Key': key}})
+            .then(res => {
+                this.setState({todos: [...this.state.todos, res.data]});
+                this.rememberUndo(res);
             })
-            .then(res => this.setState({todos: [...this.state.todos, res.data]}));
+            .catch(err => {
+                if (!err.response && retries > 0) {
+                    this.addTodo(title, key, retries - 1);
+                }
+            });
         
     }
 
@@ -101,7 +222,9 @@ class App extends Component {
                         <Route exact path="/" render={props => (
                             <React.Fragment>
                                 <AddTodo addTodo={this.addTodo}/>
-                                <Todos todos={this.state.todos} toggleComplete={this.toggleComplete} deleteTodo={this.deleteTodo}/>
+                                <Todos todos={this.state.todos} toggleComplete={this.toggleComplete} deleteTodo={this.deleteTodo} editTodo={this.editTodo} reorderTodo={this.reorderTodo}/>
+                                <button onClick={this.clearCompleted} className="btn" style={{marginTop: '10px'}}>Clear completed</button>
+                                {this.state.undo && <button onClick={this.undo} className="btn" style={{marginTop: '10px', marginLeft: '10px'}}>Undo</button>}
                             </React.Fragment>
                         )} />
                         <Route path="/about" component={About} />
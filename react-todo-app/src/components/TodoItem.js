@@ -2,6 +2,11 @@ import React, { Component } from 'react'
 import PropTypes from 'prop-types';
 
 export class TodoItem extends Component {
+    state = {
+        editing: false,
+        title: ''
+    }
+
     getStyle = () => {
         return {
             backgroundColor: '#f4f4f4',
@@ -11,13 +16,42 @@ export class TodoItem extends Component {
         }
     }
 
+    startEdit = () => {
+        this.setState({editing: true, title: this.props.todo.title});
+    }
+
+    onChange = (e) => {
+        this.setState({title: e.target.value});
+    }
+
+    onSubmit = (e) => {
+        e.preventDefault();
+        if (!this.state.editing) {
+            return;
+        }
+        const title = this.state.title.trim();
+        if (title !== '' && title !== this.props.todo.title) {
+            this.props.editTodo(this.props.todo.id, title);
+        }
+        this.setState({editing: false});
+    }
+
     render() {
         const {id, title, completed} = this.props.todo;
         return (
-            <div style={this.getStyle()}>
+            <div style={this.getStyle()} draggable={!this.state.editing}
+                onDragStart={() => this.props.onDragStart(id)}
+                onDragOver={(e) => e.preventDefault()}
+                onDrop={(e) => { e.preventDefault(); this.props.onDrop(id); }}>
                 <p>
                     <input type="checkbox" checked={completed} onChange={this.props.toggleComplete.bind(this, id)}/>{' '}
-                    {title}
+                    {this.state.editing ? (
+                        <form onSubmit={this.onSubmit} style={{display: 'inline'}}>
+                            <input type="text" value={this.state.title} onChange={this.onChange} onBlur={this.onSubmit} autoFocus/>
+                        </form>
+                    ) : (
+                        <span onDoubleClick={this.startEdit}>{title}</span>
+                    )}
                     <button onClick={this.props.deleteTodo.bind(this, id)} style={btnStyle}>x</button>
                 </p>
             </div>
@@ -3,9 +3,26 @@ import TodoItem from './TodoItem';
 import PropTypes from 'prop-types';
 
 class Todos extends Component {
+    state = {
+        dragging: null
+    }
+
+    onDragStart = (id) => {
+        this.setState({dragging: id});
+    }
+
+    // Dropping a todo on another puts it in that todo's place
+    onDrop = (id) => {
+        if (this.state.dragging && this.state.dragging !== id) {
+            this.props.reorderTodo(this.state.dragging, id);
+        }
+        this.setState({dragging: null});
+    }
+
     render() {
         return this.props.todos.map((todo) => (
-            <TodoItem key={todo.id} todo={todo} toggleComplete={this.props.toggleComplete} deleteTodo={this.props.deleteTodo}/>
+            <TodoItem key={todo.id} todo={todo} toggleComplete={this.props.toggleComplete} deleteTodo={this.props.deleteTodo} editTodo={this.props.editTodo}
+                onDragStart={this.onDragStart} onDrop={this.onDrop}/>
         ));
     }
 }
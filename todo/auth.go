@@ -0,0 +1,73 @@
+package todo
+
+import (
+	"errors"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// ErrUnauthenticated is answered to requests without an authorizer
+// identity.
+var ErrUnauthenticated = errors.New("Not authenticated")
+
+// CallerID returns the user making the request, as authenticated by the
+// API Gateway authorizer: the sub claim of a Cognito user pool or JWT
+// authorizer, or the principalId of a Lambda authorizer. Requests without
+// an authorizer get the empty owner, which holds the todos created before
+// todos had owners; Authenticated only lets them through when anonymous
+// callers are allowed.
+func CallerID(request events.APIGatewayProxyRequest) string {
+	auth := request.RequestContext.Authorizer
+	if sub := claimsSub(auth["claims"]); sub != "" {
+		return sub
+	}
+	if jwt, ok := auth["jwt"].(map[string]interface{}); ok {
+		if sub := claimsSub(jwt["claims"]); sub != "" {
+			return sub
+		}
+	}
+	if principal, ok := auth["principalId"].(string); ok {
+		return principal
+	}
+	return ""
+}
+
+// AllowAnonymousFromEnv reads the ALLOW_ANONYMOUS environment variable,
+// which has to be "true" for requests without an authorizer to be served.
+func AllowAnonymousFromEnv() bool {
+	return os.Getenv("ALLOW_ANONYMOUS") == "true"
+}
+
+// Authenticated wraps fn so that a request without an authorizer identity
+// answers 401 instead of acting as the empty owner, unless the handler
+// allows anonymous callers.
+func (h *Handler) Authenticated(fn HandlerFunc) HandlerFunc {
+	return func(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		if CallerID(request) == "" && !h.AllowAnonymous {
+			return errorResponse(apierror.Unauthorized, ErrUnauthenticated)
+		}
+		return fn(request)
+	}
+}
+
+func claimsSub(claims interface{}) string {
+	if claims, ok := claims.(map[string]interface{}); ok {
+		if sub, ok := claims["sub"].(string); ok {
+			return sub
+		}
+	}
+	return ""
+}
+
+// WithFakeClaims returns the request as a Cognito authorizer would pass it
+// on for the user sub, so the handlers can be run locally as that user.
+func WithFakeClaims(request events.APIGatewayProxyRequest, sub string) events.APIGatewayProxyRequest {
+	request.RequestContext.Authorizer = map[string]interface{}{
+		"claims": map[string]interface{}{
+			"sub": sub,
+		},
+	}
+	return request
+}
@@ -0,0 +1,97 @@
+package todo
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestRouterRequiresCaller(t *testing.T) {
+	cases := []struct {
+		name      string
+		anonymous bool
+		sub       string
+		status    int
+	}{
+		{"no claims", false, "", http.StatusUnauthorized},
+		{"no claims allowed", true, "", http.StatusOK},
+		{"claims", false, "u1", http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := &Handler{Store: NewMemoryStore(), CursorSecret: []byte("secret"), AllowAnonymous: c.anonymous}
+			request := events.APIGatewayProxyRequest{Resource: "/todos", Path: "/todos", HTTPMethod: "GET"}
+			if c.sub != "" {
+				request = WithFakeClaims(request, c.sub)
+			}
+			apiResponse, err := NewTodoRouter(h).Route(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if apiResponse.StatusCode != c.status {
+				t.Errorf("got %d, want %d: %s", apiResponse.StatusCode, c.status, apiResponse.Body)
+			}
+		})
+	}
+}
+
+func TestRouterMatch(t *testing.T) {
+	r := NewTodoRouter(newTestHandler())
+	cases := []struct {
+		path     string
+		resource string
+		id       string
+		ok       bool
+	}{
+		{"/todos", "/todos", "", true},
+		{"/todos/", "/todos", "", true},
+		{"/todos/42", "/todos/{id}", "42", true},
+		{"/todos/batch", "/todos/batch", "", true},
+		{"/todos/restore", "/todos/restore", "", true},
+		{"/todos/42/restore", "/todos/{id}/restore", "42", true},
+		{"/lists/7/todos", "/lists/{id}/todos", "7", true},
+		{"/todos/42/nope", "", "", false},
+		{"/todos/42/restore/now", "", "", false},
+		{"/music", "", "", false},
+		{"/", "", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			resource, params, ok := r.Match(c.path)
+			if ok != c.ok || resource != c.resource || params["id"] != c.id {
+				t.Errorf("got %q %v %v, want %q {id: %q} %v", resource, params, ok, c.resource, c.id, c.ok)
+			}
+		})
+	}
+}
+
+func TestRouterRoute(t *testing.T) {
+	r := NewTodoRouter(newTestHandler())
+	cases := []struct {
+		name     string
+		resource string
+		method   string
+		status   int
+		allow    string
+	}{
+		{"unknown resource", "/nope", "GET", http.StatusNotFound, ""},
+		{"unknown method", "/todos/batch", "GET", http.StatusMethodNotAllowed, "OPTIONS,POST"},
+		{"unknown method of alias", "/todos/delete", "GET", http.StatusMethodNotAllowed, "DELETE,OPTIONS,POST"},
+		{"preflight", "/todos/{id}", "OPTIONS", http.StatusOK, ""},
+		{"handled", "/todos/{id}", "GET", http.StatusNotFound, ""},
+		{"listed", "/lists", "GET", http.StatusOK, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request := events.APIGatewayProxyRequest{Resource: c.resource, HTTPMethod: c.method, PathParameters: map[string]string{"id": "missing"}}
+			apiResponse, err := r.Route(WithFakeClaims(request, "u1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if apiResponse.StatusCode != c.status || apiResponse.Headers["Allow"] != c.allow {
+				t.Errorf("got %d Allow %q, want %d Allow %q: %s", apiResponse.StatusCode, apiResponse.Headers["Allow"], c.status, c.allow, apiResponse.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package todo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	uuid "github.com/satori/go.uuid"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// MaxBatchOperations caps the number of operations of one batch request.
+const MaxBatchOperations = 500
+
+// BatchOperation is one entry of a batch request. Op is "add" (needs Title),
+// "complete" (needs ID and Completed) or "delete" (needs ID). Title may be
+// left out for complete and delete, at the cost of a lookup by ID. An add
+// takes the other fields of the todo as POST /todos does, through the
+// embedded Todos, whose ID, Title, Completed and Version the fields of the
+// operation shadow.
+type BatchOperation struct {
+	Op        string `json:"op"`
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Completed *bool  `json:"completed"`
+	Version   *int64 `json:"version"`
+	Todos
+}
+
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchResult is the outcome of the operation at Index, with an HTTP status
+// code of its own and, when it failed, the error code of that status.
+type BatchResult struct {
+	Index  int           `json:"index"`
+	Status int           `json:"status"`
+	Code   apierror.Code `json:"code,omitempty"`
+	Error  string        `json:"error,omitempty"`
+	Todo   *Todos        `json:"todo,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// batchError maps a store error of a batch item to the error reported for
+// it. Errors of DynamoDB are reported the way apierror.Sanitize answers
+// them, so a result never carries the raw SDK message.
+func batchError(err error) *apierror.Error {
+	switch err {
+	case ErrNotFound, ErrListNotFound:
+		return apierror.Wrap(apierror.NotFound, err)
+	case ErrVersionMismatch:
+		return apierror.Wrap(apierror.PreconditionFailed, err)
+	case ErrThrottled:
+		return apierror.Wrap(apierror.Throttled, err)
+	default:
+		return apierror.Sanitize(err)
+	}
+}
+
+// checkAdd validates and normalizes a todo to add the way
+// HandleAddTodoRequest does, and checks its list and parent. A parent added
+// in the same batch is not there yet, so subtasks go in a later batch.
+func (h *Handler) checkAdd(todo *Todos) error {
+	if err := todo.validate(); err != nil {
+		return apierror.Wrap(apierror.ValidationFailed, err)
+	}
+	if todo.ListID != "" {
+		if _, err := h.ownedList(todo.Owner, todo.ListID); err != nil {
+			return err
+		}
+	}
+	if todo.ParentID != "" {
+		err := h.checkParent(todo.Owner, todo.ParentID)
+		if err == ErrParentNotFound || err == ErrTooDeep {
+			return apierror.Wrap(apierror.ValidationFailed, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// BatchTodos runs the operations of owner, adds through TodoStore.PutAll
+// and completes and deletes through TodoStore.UpdateAll, and reports a
+// result for every operation.
+func (h *Handler) BatchTodos(owner string, ops []BatchOperation) (events.APIGatewayProxyResponse, error) {
+	results := make([]BatchResult, len(ops))
+	fail := func(i int, status int, err error) {
+		results[i] = BatchResult{Index: i, Status: status, Code: apierror.ForStatus(status), Error: err.Error()}
+	}
+	failStore := func(i int, err error) {
+		apiErr := batchError(err)
+		results[i] = BatchResult{Index: i, Status: apiErr.Code.Status(), Code: apiErr.Code, Error: apiErr.Message}
+	}
+
+	now := time.Now().UTC()
+	adds, addIndexes := []Todos{}, []int{}
+	changes, changeIndexes := []TodoChange{}, []int{}
+	seen := map[itemKey]bool{}
+	for i, op := range ops {
+		switch op.Op {
+		case "add":
+			if op.Title == "" || op.Title == "null" {
+				fail(i, http.StatusBadRequest, errors.New("Adding Title not specified"))
+				continue
+			}
+			todo := op.Todos
+			todo.Owner = owner
+			todo.Title = op.Title
+			todo.Completed = op.Completed != nil && *op.Completed
+			if err := h.checkAdd(&todo); err != nil {
+				failStore(i, err)
+				continue
+			}
+			id, err := uuid.NewV4()
+			if err != nil {
+				fail(i, http.StatusInternalServerError, err)
+				continue
+			}
+			adds = append(adds, newTodo(todo, id.String(), now))
+			addIndexes = append(addIndexes, i)
+		case "complete", "delete":
+			if op.ID == "" || op.ID == "null" {
+				fail(i, http.StatusBadRequest, errors.New("ID not specified"))
+				continue
+			}
+			if op.Op == "complete" && op.Completed == nil {
+				fail(i, http.StatusBadRequest, errors.New("Completed not specified"))
+				continue
+			}
+			if op.Title == "" || op.Title == "null" {
+				title, err := h.titleOf(owner, op.ID)
+				if err != nil {
+					failStore(i, err)
+					continue
+				}
+				op.Title = title
+			}
+
+			// A transaction may not touch the same item twice
+			key := itemKey{op.ID, op.Title}
+			if seen[key] {
+				fail(i, http.StatusConflict, errors.New("Duplicate operation on the same todo"))
+				continue
+			}
+			seen[key] = true
+
+			change := TodoChange{Owner: owner, ID: op.ID, Title: op.Title, UpdatedAt: now.Format(time.RFC3339), Actor: owner, Version: op.Version}
+			if op.Op == "complete" {
+				change.Completed = op.Completed
+			} else {
+				change.DeletedAt = now.Format(time.RFC3339)
+				change.ExpiresAt = now.Add(h.trashRetention()).Unix()
+			}
+			changes = append(changes, change)
+			changeIndexes = append(changeIndexes, i)
+		default:
+			fail(i, http.StatusBadRequest, errors.New("Invalid op: "+op.Op))
+		}
+	}
+
+	if err := h.appendPositions(owner, adds); err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	for n, err := range h.Store.PutAll(adds) {
+		i := addIndexes[n]
+		if err != nil {
+			failStore(i, err)
+			continue
+		}
+		added := adds[n]
+		results[i] = BatchResult{Index: i, Status: http.StatusOK, Todo: &added}
+		h.rollup(added)
+		h.reindex(added)
+	}
+
+	changed := []TodoChange{}
+	for n, err := range h.Store.UpdateAll(changes) {
+		i := changeIndexes[n]
+		if err != nil {
+			failStore(i, err)
+			continue
+		}
+		results[i] = BatchResult{Index: i, Status: http.StatusOK}
+		changed = append(changed, changes[n])
+	}
+
+	// Subtasks follow their parents to the trash, parents follow their
+	// subtasks when they auto-complete and completed recurring todos start
+	// their next occurrence
+	for _, change := range changed {
+		if change.DeletedAt != "" {
+			h.trashDescendants(Todos{Owner: owner, ID: change.ID, DeletedAt: change.DeletedAt, ExpiresAt: change.ExpiresAt})
+		}
+	}
+	for _, change := range changed {
+		todo, err := h.Store.Get(change.ID, change.Title)
+		if err != nil {
+			fmt.Println("Got error rolling up " + change.ID + ": " + err.Error())
+			continue
+		}
+		h.rollup(todo)
+		if change.DeletedAt != "" {
+			h.reindex(todo)
+		}
+		if change.Completed != nil && *change.Completed {
+			h.recur(todo)
+		}
+	}
+
+	responseBody, err := json.Marshal(BatchResponse{Results: results})
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	return GenerateResponse(string(responseBody), http.StatusOK), nil
+}
+
+func (h *Handler) HandleBatchTodosRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod == "POST" {
+		batch := BatchRequest{}
+		err := json.Unmarshal([]byte(request.Body), &batch)
+		if err != nil {
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+
+		if len(batch.Operations) == 0 {
+			err := errors.New("No operations specified")
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+		if len(batch.Operations) > MaxBatchOperations {
+			err := fmt.Errorf("At most %d operations per batch", MaxBatchOperations)
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+
+		fmt.Printf("Running batch of %d operations\n", len(batch.Operations))
+		return h.BatchTodos(CallerID(request), batch.Operations)
+	} else {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+}
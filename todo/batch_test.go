@@ -0,0 +1,145 @@
+package todo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// batch runs the operations as u1 and returns their results.
+func batch(t *testing.T, h *Handler, operations string) []BatchResult {
+	t.Helper()
+	status, body := call(t, h.HandleBatchTodosRequest, "POST", "u1", "", `{"operations": [`+operations+`]}`)
+	response := BatchResponse{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil || status != http.StatusOK {
+		t.Fatalf("got %d %s", status, body)
+	}
+	return response.Results
+}
+
+func TestBatchOperations(t *testing.T) {
+	h := newTestHandler()
+	foreign := addTestList(t, h, "u2", "Theirs")
+	open := addTestTodo(t, h, "u1", "walk dog")
+	trash := addTestTodo(t, h, "u1", "old news")
+	other := addTestTodo(t, h, "u1", "call mum")
+
+	cases := []struct {
+		name      string
+		operation string
+		status    int
+		code      apierror.Code
+	}{
+		{"add", `{"op": "add", "title": "buy milk"}`, http.StatusOK, ""},
+		{"add without title", `{"op": "add", "priority": "high"}`, http.StatusBadRequest, apierror.ValidationFailed},
+		{"add invalid priority", `{"op": "add", "title": "x", "priority": "whenever"}`, http.StatusBadRequest, apierror.ValidationFailed},
+		{"add invalid due date", `{"op": "add", "title": "x", "dueAt": "tomorrow"}`, http.StatusBadRequest, apierror.ValidationFailed},
+		{"add recurring without due date", `{"op": "add", "title": "x", "recurrence": "FREQ=DAILY"}`, http.StatusBadRequest, apierror.ValidationFailed},
+		{"add into foreign list", `{"op": "add", "title": "x", "listId": "` + foreign.ID + `"}`, http.StatusNotFound, apierror.NotFound},
+		{"add under missing parent", `{"op": "add", "title": "x", "parentId": "nope"}`, http.StatusBadRequest, apierror.ValidationFailed},
+		{"complete", `{"op": "complete", "id": "` + open.ID + `", "completed": true}`, http.StatusOK, ""},
+		{"complete without completed", `{"op": "complete", "id": "` + open.ID + `"}`, http.StatusBadRequest, apierror.ValidationFailed},
+		{"complete stale version", `{"op": "complete", "id": "` + other.ID + `", "completed": true, "version": 7}`, http.StatusPreconditionFailed, apierror.PreconditionFailed},
+		{"delete", `{"op": "delete", "id": "` + trash.ID + `"}`, http.StatusOK, ""},
+		{"delete missing", `{"op": "delete", "id": "nope"}`, http.StatusNotFound, apierror.NotFound},
+		{"delete without id", `{"op": "delete"}`, http.StatusBadRequest, apierror.ValidationFailed},
+		{"unknown op", `{"op": "archive", "id": "` + open.ID + `"}`, http.StatusBadRequest, apierror.ValidationFailed},
+	}
+	operations := []string{}
+	for _, c := range cases {
+		operations = append(operations, c.operation)
+	}
+	results := batch(t, h, strings.Join(operations, ", "))
+	if len(results) != len(cases) {
+		t.Fatalf("got %d results, want %d", len(results), len(cases))
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := results[i]
+			if result.Index != i || result.Status != c.status || result.Code != c.code {
+				t.Errorf("got %+v, want %d %s", result, c.status, c.code)
+			}
+		})
+	}
+
+	if stored, _ := h.Store.Get(open.ID, open.Title); !stored.Completed {
+		t.Errorf("got %+v, want it completed", stored)
+	}
+	if stored, _ := h.Store.Get(trash.ID, trash.Title); stored.DeletedAt == "" {
+		t.Errorf("got %+v, want it trashed", stored)
+	}
+}
+
+func TestBatchAddFields(t *testing.T) {
+	h := newTestHandler()
+	list := addTestList(t, h, "u1", "Groceries")
+	parent := addTestTodo(t, h, "u1", "shopping")
+
+	results := batch(t, h, `{"op": "add", "title": "buy milk", "completed": true, "listId": "`+list.ID+`",
+		"parentId": "`+parent.ID+`", "description": "semi-skimmed", "dueAt": "2026-03-01T09:00:00Z",
+		"priority": "high", "tags": ["Shop", "shop", "dairy"], "recurrence": "FREQ=WEEKLY",
+		"id": "mine", "version": 9, "createdAt": "2000-01-01T00:00:00Z", "deletedAt": "2000-01-01T00:00:00Z"}`)
+	added := results[0].Todo
+	if results[0].Status != http.StatusOK || added == nil {
+		t.Fatalf("got %+v", results[0])
+	}
+
+	want := Todos{
+		Title: "buy milk", Completed: true, Version: 1, ListID: list.ID, ParentID: parent.ID,
+		Description: "semi-skimmed", DueAt: "2026-03-01T09:00:00Z", Priority: "high",
+		Tags: []string{"dairy", "shop"}, Recurrence: "FREQ=WEEKLY", Occurrence: 1,
+	}
+	got := *added
+	if got.ID == "mine" || got.CreatedAt == "2000-01-01T00:00:00Z" || got.DeletedAt != "" {
+		t.Errorf("got %+v, want the fields managed by the server set by it", got)
+	}
+	got.ID, got.Owner, got.Position, got.OwnerKey, got.Status, got.DueShard = "", "", "", "", "", ""
+	got.CreatedAt, got.UpdatedAt, got.UpdatedBy, got.CompletedAt = "", "", "", ""
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	stored, err := h.Store.GetList(list.ID)
+	if err != nil || stored.TodoCount != 1 {
+		t.Errorf("got TodoCount %d (%v), want the added todo counted", stored.TodoCount, err)
+	}
+}
+
+func TestBatchRequest(t *testing.T) {
+	h := newTestHandler()
+	tooMany := make([]string, MaxBatchOperations+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf(`{"op": "add", "title": "todo %d"}`, i)
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"no operations", "POST", `{"operations": []}`, http.StatusBadRequest},
+		{"too many operations", "POST", `{"operations": [` + strings.Join(tooMany, ", ") + `]}`, http.StatusBadRequest},
+		{"not json", "POST", `{"operations": `, http.StatusBadRequest},
+		{"wrong method", "GET", "", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if status, body := call(t, h.HandleBatchTodosRequest, c.method, "u1", "", c.body); status != c.status {
+				t.Errorf("got %d %s, want %d", status, body, c.status)
+			}
+		})
+	}
+
+	// The same todo twice in one batch fails the second operation
+	todo := addTestTodo(t, h, "u1", "buy milk")
+	results := batch(t, h, `{"op": "complete", "id": "`+todo.ID+`", "completed": true}, {"op": "delete", "id": "`+todo.ID+`"}`)
+	if results[0].Status != http.StatusOK || results[1].Status != http.StatusConflict {
+		t.Errorf("got %+v, want 200 and 409", results)
+	}
+}
@@ -0,0 +1,102 @@
+package todo
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for a cursor that was not issued by us.
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// ErrNoCursorSecret is returned when cursors are to be signed without a
+// secret, which would let anyone forge them.
+var ErrNoCursorSecret = errors.New("CURSOR_SECRET is not set")
+
+// CursorSecretFromEnv reads the CURSOR_SECRET environment variable that
+// cursors and undo tokens are signed with. The lambdas refuse to start
+// without it.
+func CursorSecretFromEnv() ([]byte, error) {
+	secret := os.Getenv("CURSOR_SECRET")
+	if secret == "" {
+		return nil, ErrNoCursorSecret
+	}
+	return []byte(secret), nil
+}
+
+func signCursor(payload string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// EncodeCursor turns a PageKey into the opaque cursor handed to clients.
+// The key is signed so clients cannot make us start a scan anywhere else,
+// which takes a secret.
+func EncodeCursor(key PageKey, secret []byte) (string, error) {
+	return EncodeScopedCursor(key, "", secret)
+}
+
+// EncodeScopedCursor is EncodeCursor for the listing named by scope, such
+// as the history of one todo. The scope is signed along with the key, so
+// the cursor only decodes for the same scope.
+func EncodeScopedCursor(key PageKey, scope string, secret []byte) (string, error) {
+	if key == nil {
+		return "", nil
+	}
+	if len(secret) == 0 {
+		return "", ErrNoCursorSecret
+	}
+
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(keyJSON)
+	return payload + "." + signCursor(scopedPayload(scope, payload), secret), nil
+}
+
+// scopedPayload is what the cursor of a listing is signed over, prefixed
+// with the scope like undo tokens are. Unscoped cursors are signed over
+// the payload alone.
+func scopedPayload(scope string, payload string) string {
+	if scope == "" {
+		return payload
+	}
+	return scope + "." + payload
+}
+
+// DecodeCursor verifies a cursor from EncodeCursor and returns its PageKey.
+// Without a secret no cursor is valid.
+func DecodeCursor(cursor string, secret []byte) (PageKey, error) {
+	return DecodeScopedCursor(cursor, "", secret)
+}
+
+// DecodeScopedCursor verifies a cursor from EncodeScopedCursor, failing
+// with ErrInvalidCursor when it was issued for another scope.
+func DecodeScopedCursor(cursor string, scope string, secret []byte) (PageKey, error) {
+	parts := strings.Split(cursor, ".")
+	if len(secret) == 0 || len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(signCursor(scopedPayload(scope, parts[0]), secret))) {
+		return nil, ErrInvalidCursor
+	}
+
+	keyJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	key := PageKey{}
+	err = json.Unmarshal(keyJSON, &key)
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return key, nil
+}
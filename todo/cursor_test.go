@@ -0,0 +1,118 @@
+package todo
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestCursorRejectsTampering(t *testing.T) {
+	secret := []byte("secret")
+	cursor, err := EncodeCursor(PageKey{"ID": "1", "Title": "a"}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := DecodeCursor(cursor, secret); err != nil || key["ID"] != "1" {
+		t.Fatalf("got %v %v, want the key back", key, err)
+	}
+
+	forged, _ := EncodeCursor(PageKey{"ID": "2", "Title": "b"}, []byte("other"))
+	cases := map[string]string{
+		"changed payload":  "x" + cursor,
+		"other secret":     forged,
+		"no signature":     cursor[:len(cursor)-10],
+		"no separator":     "abc",
+		"empty key signed": "e30." + signCursor("e30", secret),
+	}
+	for name, cursor := range cases {
+		if _, err := DecodeCursor(cursor, secret); err != ErrInvalidCursor {
+			t.Errorf("%s: got %v, want ErrInvalidCursor", name, err)
+		}
+	}
+}
+
+func TestCursorNeedsSecret(t *testing.T) {
+	if _, err := EncodeCursor(PageKey{"ID": "1"}, nil); err != ErrNoCursorSecret {
+		t.Errorf("got %v, want ErrNoCursorSecret", err)
+	}
+	unsigned := "eyJJRCI6IjEifQ." + signCursor("eyJJRCI6IjEifQ", nil)
+	if _, err := DecodeCursor(unsigned, nil); err != ErrInvalidCursor {
+		t.Errorf("got %v, want ErrInvalidCursor for a cursor signed without a secret", err)
+	}
+}
+
+// listPage gets a page of the todos of u1.
+func listPage(t *testing.T, h *Handler, params map[string]string) (int, TodosPage) {
+	t.Helper()
+	request := WithFakeClaims(events.APIGatewayProxyRequest{HTTPMethod: "GET", QueryStringParameters: params}, "u1")
+	apiResponse, err := h.HandleGetTodosRequest(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := TodosPage{}
+	if apiResponse.StatusCode == http.StatusOK {
+		if err := json.Unmarshal([]byte(apiResponse.Body), &page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return apiResponse.StatusCode, page
+}
+
+func TestGetTodosPaging(t *testing.T) {
+	h := newTestHandler()
+	for i := 0; i < 5; i++ {
+		addTestTodo(t, h, "u1", "todo "+strconv.Itoa(i))
+	}
+	addTestTodo(t, h, "u2", "not mine")
+
+	seen := map[string]bool{}
+	params := map[string]string{"limit": "2"}
+	for pages := 0; ; pages++ {
+		if pages == 5 {
+			t.Fatal("paging does not end")
+		}
+		status, page := listPage(t, h, params)
+		if status != http.StatusOK {
+			t.Fatalf("got %d", status)
+		}
+		if len(page.Todos) > 2 {
+			t.Errorf("got %d todos on a page of 2", len(page.Todos))
+		}
+		for _, todo := range page.Todos {
+			if seen[todo.ID] || todo.Title == "not mine" {
+				t.Errorf("got %s twice or of another owner", todo.ID)
+			}
+			seen[todo.ID] = true
+		}
+		if page.Next == "" {
+			break
+		}
+		params = map[string]string{"limit": "2", "cursor": page.Next}
+	}
+	if len(seen) != 5 {
+		t.Errorf("got %d todos, want 5", len(seen))
+	}
+}
+
+func TestGetTodosRejectsBadParameters(t *testing.T) {
+	h := newTestHandler()
+	for i := 0; i < 3; i++ {
+		addTestTodo(t, h, "u1", "todo "+strconv.Itoa(i))
+	}
+	_, page := listPage(t, h, map[string]string{"limit": "1"})
+
+	cases := map[string]map[string]string{
+		"tampered cursor":    {"cursor": "x" + page.Next},
+		"limit not a number": {"limit": "ten"},
+		"limit zero":         {"limit": "0"},
+		"limit negative":     {"limit": "-3"},
+	}
+	for name, params := range cases {
+		if status, _ := listPage(t, h, params); status != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", name, status)
+		}
+	}
+}
@@ -0,0 +1,1951 @@
+package todo
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// DynamoStore is a TodoStore backed by a DynamoDB table, with the todo
+// lists in the TodoLists table, the Idempotency-Keys in the
+// TodoIdempotency table and the undo actions in the TodoUndo table next
+// to it.
+type DynamoStore struct {
+	db    dynamodbiface.DynamoDBAPI
+	table string
+	lists string
+	keys  string
+	undo  string
+}
+
+// NewDynamoStore returns a TodoStore reading and writing the given table.
+func NewDynamoStore(db dynamodbiface.DynamoDBAPI, table string) *DynamoStore {
+	return &DynamoStore{db: db, table: table, lists: ListTableName, keys: IdempotencyTableName, undo: UndoTableName}
+}
+
+func (s *DynamoStore) key(id string, title string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"ID": {
+			S: aws.String(id),
+		},
+		"Title": {
+			S: aws.String(title),
+		},
+	}
+}
+
+// Put writes the todo. A live todo filed under a list is written in one
+// transaction with the TodoCount of the list, which has to exist and
+// belong to the owner of the todo.
+func (s *DynamoStore) Put(todo Todos) error {
+	av, err := dynamodbattribute.MarshalMap(todo)
+	if err != nil {
+		return err
+	}
+
+	if countedIn(todo) == "" {
+		input := &dynamodb.PutItemInput{
+			Item:      av,
+			TableName: aws.String(s.table),
+		}
+
+		_, err = s.db.PutItem(input)
+		return err
+	}
+
+	count, err := s.listCount(todo.ListID, todo.Owner, 1)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					Item:      av,
+					TableName: aws.String(s.table),
+				},
+			},
+			count,
+		},
+	}
+
+	_, err = s.db.TransactWriteItems(input)
+	if conditionFailed(err, 1) {
+		return ErrListNotFound
+	}
+	return err
+}
+
+func (s *DynamoStore) Get(id string, title string) (Todos, error) {
+	input := &dynamodb.GetItemInput{
+		Key:            s.key(id, title),
+		TableName:      aws.String(s.table),
+		ConsistentRead: aws.Bool(true),
+	}
+
+	result, err := s.db.GetItem(input)
+	if err != nil {
+		return Todos{}, err
+	}
+	if result.Item == nil {
+		return Todos{}, ErrNotFound
+	}
+
+	todo := Todos{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &todo)
+	return todo, err
+}
+
+// toPageKey and fromPageKey convert between a LastEvaluatedKey and the
+// store neutral PageKey. Every key attribute of the Todos table is a string.
+func toPageKey(key map[string]*dynamodb.AttributeValue) PageKey {
+	if len(key) == 0 {
+		return nil
+	}
+	pageKey := PageKey{}
+	for name, av := range key {
+		pageKey[name] = aws.StringValue(av.S)
+	}
+	return pageKey
+}
+
+func fromPageKey(pageKey PageKey) map[string]*dynamodb.AttributeValue {
+	if len(pageKey) == 0 {
+		return nil
+	}
+	key := map[string]*dynamodb.AttributeValue{}
+	for name, val := range pageKey {
+		key[name] = &dynamodb.AttributeValue{S: aws.String(val)}
+	}
+	return key
+}
+
+// ownerCondition matches the todos of owner. Todos created without a
+// signed in user have no Owner attribute and belong to the empty owner.
+func ownerCondition(owner string) expression.ConditionBuilder {
+	if owner == "" {
+		return expression.AttributeNotExists(expression.Name("Owner"))
+	}
+	return expression.Name("Owner").Equal(expression.Value(owner))
+}
+
+// queryFilter is the FilterExpression for the query. Trashed todos carry a
+// DeletedAt attribute and are only returned when asked for.
+func queryFilter(query TodoQuery) expression.ConditionBuilder {
+	filt := ownerCondition(query.Owner).And(expression.AttributeNotExists(expression.Name("DeletedAt")))
+	if query.Deleted {
+		filt = ownerCondition(query.Owner).And(expression.AttributeExists(expression.Name("DeletedAt")))
+	}
+	if query.Completed != nil {
+		filt = filt.And(expression.Name("Completed").Equal(expression.Value(*query.Completed)))
+	}
+	if query.Filter != nil {
+		filt = filt.And(query.Filter.Condition())
+	}
+	if query.ID != "" && query.ListID != "" {
+		filt = filt.And(expression.Name("ListId").Equal(expression.Value(query.ListID)))
+	}
+	if (query.ID != "" || query.ListID != "") && query.ParentID != "" {
+		filt = filt.And(expression.Name("ParentId").Equal(expression.Value(query.ParentID)))
+	}
+	return filt
+}
+
+// Query keeps reading pages until Limit matching todos are collected or
+// the table is exhausted. A single Query with a filter may return fewer
+// items than its Limit, so one call is not enough. The todos of an owner
+// are read from PositionIndex in order, or from StatusIndex when only open
+// or completed ones are wanted, so the others are not read at all. The
+// trash is small and short-lived, and only filtered out of both. The todos
+// of a list and the subtasks of a todo are read from ListIndex and
+// ParentIndex, which have no range key, so only the todos of each page are
+// in order.
+func (s *DynamoStore) Query(query TodoQuery) ([]Todos, PageKey, error) {
+	builder := expression.NewBuilder().WithFilter(queryFilter(query))
+	var index *string
+	if query.ID != "" {
+		builder = builder.WithKeyCondition(expression.Key("ID").Equal(expression.Value(query.ID)))
+	} else if query.ListID != "" {
+		builder = builder.WithKeyCondition(expression.Key("ListId").Equal(expression.Value(query.ListID)))
+		index = aws.String(ListIndexName)
+	} else if query.ParentID != "" {
+		builder = builder.WithKeyCondition(expression.Key("ParentId").Equal(expression.Value(query.ParentID)))
+		index = aws.String(ParentIndexName)
+	} else if query.Completed != nil && !query.Deleted {
+		builder = builder.WithKeyCondition(expression.Key("Status").Equal(expression.Value(statusKey(query.Owner, *query.Completed))))
+		index = aws.String(StatusIndexName)
+	} else {
+		builder = builder.WithKeyCondition(expression.Key("OwnerKey").Equal(expression.Value(ownerKey(query.Owner))))
+		index = aws.String(PositionIndexName)
+	}
+	expr, err := builder.Build()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	todos := []Todos{}
+	startKey := fromPageKey(query.StartKey)
+	for {
+		var limit *int64
+		if query.Limit > 0 {
+			limit = aws.Int64(query.Limit - int64(len(todos)))
+		}
+
+		// Build the query input parameters
+		params := &dynamodb.QueryInput{
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			KeyConditionExpression:    expr.KeyCondition(),
+			FilterExpression:          expr.Filter(),
+			TableName:                 aws.String(s.table),
+			IndexName:                 index,
+			ExclusiveStartKey:         startKey,
+			Limit:                     limit,
+		}
+
+		// Make the DynamoDB Query API call
+		result, err := s.db.Query(params)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		page := []Todos{}
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return nil, nil, err
+		}
+		todos = append(todos, page...)
+
+		lastKey := result.LastEvaluatedKey
+		if len(lastKey) == 0 || (query.Limit > 0 && int64(len(todos)) >= query.Limit) {
+			if aws.StringValue(index) == ListIndexName || aws.StringValue(index) == ParentIndexName {
+				sortByPosition(todos)
+			}
+			return todos, toPageKey(lastKey), nil
+		}
+		startKey = lastKey
+	}
+}
+
+func sortByPosition(todos []Todos) {
+	sort.SliceStable(todos, func(i, j int) bool {
+		return todos[i].Position < todos[j].Position
+	})
+}
+
+// LastPosition reads the end of the owner's PositionIndex partition.
+func (s *DynamoStore) LastPosition(owner string) (string, error) {
+	keyCond := expression.Key("OwnerKey").Equal(expression.Value(ownerKey(owner)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return "", err
+	}
+
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		TableName:                 aws.String(s.table),
+		IndexName:                 aws.String(PositionIndexName),
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int64(1),
+	}
+	result, err := s.db.Query(input)
+	if err != nil || len(result.Items) == 0 {
+		return "", err
+	}
+
+	todo := Todos{}
+	err = dynamodbattribute.UnmarshalMap(result.Items[0], &todo)
+	return todo.Position, err
+}
+
+// BackfillIndexKeys gives the todos written before PositionIndex,
+// StatusIndex and DueIndex existed their OwnerKey, Status and, while open,
+// DueShard, and a Position after the other todos of their owner, oldest
+// first, so they show up in listings and reminders again. It returns how
+// many todos it updated, and is safe to run again.
+func (s *DynamoStore) BackfillIndexKeys() (int, error) {
+	filt := expression.AttributeNotExists(expression.Name("Position")).
+		Or(expression.AttributeNotExists(expression.Name("OwnerKey"))).
+		Or(expression.AttributeNotExists(expression.Name("Status"))).
+		Or(expression.Name("Completed").Equal(expression.Value(false)).
+			And(expression.AttributeNotExists(expression.Name("DueShard"))))
+	expr, err := expression.NewBuilder().WithFilter(filt).Build()
+	if err != nil {
+		return 0, err
+	}
+
+	missing := map[string][]Todos{}
+	var startKey map[string]*dynamodb.AttributeValue
+	for {
+		params := &dynamodb.ScanInput{
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			FilterExpression:          expr.Filter(),
+			TableName:                 aws.String(s.table),
+			ExclusiveStartKey:         startKey,
+		}
+		result, err := s.db.Scan(params)
+		if err != nil {
+			return 0, err
+		}
+
+		page := []Todos{}
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return 0, err
+		}
+		for _, todo := range page {
+			missing[todo.Owner] = append(missing[todo.Owner], todo)
+		}
+
+		startKey = result.LastEvaluatedKey
+		if len(startKey) == 0 {
+			break
+		}
+	}
+
+	updated := 0
+	for owner, todos := range missing {
+		sort.Slice(todos, func(i, j int) bool {
+			if todos[i].CreatedAt != todos[j].CreatedAt {
+				return todos[i].CreatedAt < todos[j].CreatedAt
+			}
+			return todos[i].ID < todos[j].ID
+		})
+
+		last, err := s.LastPosition(owner)
+		if err != nil {
+			return updated, err
+		}
+		for _, todo := range todos {
+			position := todo.Position
+			if position == "" {
+				position, err = positionBetween(last, "")
+				if err != nil {
+					return updated, err
+				}
+				last = position
+			}
+
+			// Not conditioned on the version, as this is no change of the
+			// todo, but on the Completed the Status was worked out from
+			update := expression.Set(expression.Name("Position"), expression.Value(position)).
+				Set(expression.Name("OwnerKey"), expression.Value(ownerKey(owner))).
+				Set(expression.Name("Status"), expression.Value(statusKey(owner, todo.Completed))).
+				Set(expression.Name("UpdatedBy"), expression.Value(ActorBackfill))
+			if !todo.Completed {
+				update = update.Set(expression.Name("DueShard"), expression.Value(dueShard(todo.ID)))
+			}
+			cond := expression.AttributeExists(expression.Name("ID")).
+				And(expression.Name("Completed").Equal(expression.Value(todo.Completed)))
+			expr, err := expression.NewBuilder().
+				WithCondition(cond).
+				WithUpdate(update).
+				Build()
+			if err != nil {
+				return updated, err
+			}
+			input := &dynamodb.UpdateItemInput{
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				Key:                       s.key(todo.ID, todo.Title),
+				TableName:                 aws.String(s.table),
+				ConditionExpression:       expr.Condition(),
+				UpdateExpression:          expr.Update(),
+			}
+			_, err = s.db.UpdateItem(input)
+			if isConditionalCheckFailed(err) {
+				continue
+			}
+			if err != nil {
+				return updated, err
+			}
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// errCountRaced is returned by BackfillLists for a list whose todos kept
+// changing while it counted them.
+var errCountRaced = errors.New("List kept changing while its todos were counted")
+
+// BackfillLists gives the lists written before ListOwnerIndex existed
+// their OwnerKey, and counts the live todos filed under every list into
+// its TodoCount. A count is written on condition that the TodoCount did not
+// change while counting, and taken again otherwise, so it is safe to run
+// while the lambdas keep TodoCount. It returns how many lists it updated.
+func (s *DynamoStore) BackfillLists() (int, error) {
+	lists := []TodoList{}
+	var startKey map[string]*dynamodb.AttributeValue
+	for {
+		result, err := s.db.Scan(&dynamodb.ScanInput{TableName: aws.String(s.lists), ExclusiveStartKey: startKey})
+		if err != nil {
+			return 0, err
+		}
+
+		page := []TodoList{}
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return 0, err
+		}
+		lists = append(lists, page...)
+
+		startKey = result.LastEvaluatedKey
+		if len(startKey) == 0 {
+			break
+		}
+	}
+
+	updated := 0
+	for _, list := range lists {
+		done := false
+		for attempt := 0; attempt < maxBatchAttempts && !done; attempt++ {
+			live, _, err := s.Query(TodoQuery{Owner: list.Owner, ListID: list.ID})
+			if err != nil {
+				return updated, err
+			}
+
+			unchanged := expression.Name("TodoCount").Equal(expression.Value(list.TodoCount))
+			if list.TodoCount == 0 {
+				unchanged = expression.AttributeNotExists(expression.Name("TodoCount")).Or(unchanged)
+			}
+			expr, err := expression.NewBuilder().
+				WithCondition(expression.AttributeExists(expression.Name("ID")).And(unchanged)).
+				WithUpdate(expression.Set(expression.Name("OwnerKey"), expression.Value(ownerKey(list.Owner))).
+					Set(expression.Name("TodoCount"), expression.Value(len(live)))).
+				Build()
+			if err != nil {
+				return updated, err
+			}
+			input := &dynamodb.UpdateItemInput{
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				Key:                       s.listKey(list.ID),
+				TableName:                 aws.String(s.lists),
+				ConditionExpression:       expr.Condition(),
+				UpdateExpression:          expr.Update(),
+			}
+			_, err = s.db.UpdateItem(input)
+			if isConditionalCheckFailed(err) {
+				list, err = s.GetList(list.ID)
+				if err == ErrListNotFound {
+					// Deleted in the meantime, nothing to count
+					done = true
+				} else if err != nil {
+					return updated, err
+				}
+				continue
+			}
+			if err != nil {
+				return updated, err
+			}
+			done = true
+			updated++
+		}
+		if !done {
+			return updated, errCountRaced
+		}
+	}
+	return updated, nil
+}
+
+// ReindexSearch rebuilds the search index from the todos table, indexing
+// every live todo and removing every trashed one, which brings back in
+// line what the lambdas failed to index. Index only writes what changed,
+// so it is cheap on an index that is mostly right. It returns how many
+// todos it went through, and stops at the first error.
+func (s *DynamoStore) ReindexSearch(index SearchIndex) (int, error) {
+	done := 0
+	var startKey map[string]*dynamodb.AttributeValue
+	for {
+		result, err := s.db.Scan(&dynamodb.ScanInput{TableName: aws.String(s.table), ExclusiveStartKey: startKey})
+		if err != nil {
+			return done, err
+		}
+
+		page := []Todos{}
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return done, err
+		}
+		for _, todo := range page {
+			if err := reindexTodo(index, todo); err != nil {
+				return done, err
+			}
+			done++
+		}
+
+		startKey = result.LastEvaluatedKey
+		if len(startKey) == 0 {
+			return done, nil
+		}
+	}
+}
+
+// DueTodos queries every shard of DueIndex for the todos due at or before
+// the time, leaving out the trashed ones.
+func (s *DynamoStore) DueTodos(before string) ([]Todos, error) {
+	filt := expression.AttributeNotExists(expression.Name("DeletedAt")).
+		And(expression.Name("Completed").Equal(expression.Value(false)))
+
+	todos := []Todos{}
+	for shard := 0; shard < dueShards; shard++ {
+		keyCond := expression.Key("DueShard").Equal(expression.Value(dueShardKey(shard))).
+			And(expression.Key("DueAt").LessThanEqual(expression.Value(before)))
+		expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithFilter(filt).Build()
+		if err != nil {
+			return nil, err
+		}
+
+		var startKey map[string]*dynamodb.AttributeValue
+		for {
+			params := &dynamodb.QueryInput{
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				KeyConditionExpression:    expr.KeyCondition(),
+				FilterExpression:          expr.Filter(),
+				TableName:                 aws.String(s.table),
+				IndexName:                 aws.String(DueIndexName),
+				ExclusiveStartKey:         startKey,
+			}
+
+			result, err := s.db.Query(params)
+			if err != nil {
+				return nil, err
+			}
+
+			page := []Todos{}
+			err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page)
+			if err != nil {
+				return nil, err
+			}
+			todos = append(todos, page...)
+
+			if len(result.LastEvaluatedKey) == 0 {
+				break
+			}
+			startKey = result.LastEvaluatedKey
+		}
+	}
+	return todos, nil
+}
+
+// writeCondition requires the item to exist, to belong to owner and, when
+// version is given, to be at it. Items written before versions existed
+// have no Version attribute and count as version 0.
+func writeCondition(owner string, version *int64) expression.ConditionBuilder {
+	cond := expression.AttributeExists(expression.Name("ID")).And(ownerCondition(owner))
+	if version == nil {
+		return cond
+	}
+
+	match := expression.Name("Version").Equal(expression.Value(*version))
+	if *version == 0 {
+		match = expression.AttributeNotExists(expression.Name("Version")).Or(match)
+	}
+	return cond.And(match)
+}
+
+// changeUpdate is the update applying the change. Every change bumps the
+// Version, and CompletedAt follows Completed, keeping the first completion
+// time when a todo is completed twice.
+func changeUpdate(change TodoChange) expression.UpdateBuilder {
+	update := expression.Set(expression.Name("Version"),
+		expression.Plus(expression.IfNotExists(expression.Name("Version"), expression.Value(0)), expression.Value(1)))
+	if change.UpdatedAt != "" {
+		update = update.Set(expression.Name("UpdatedAt"), expression.Value(change.UpdatedAt))
+	}
+	if change.Actor != "" {
+		update = update.Set(expression.Name("UpdatedBy"), expression.Value(change.Actor))
+	} else {
+		update = update.Remove(expression.Name("UpdatedBy"))
+	}
+	if change.Completed != nil {
+		update = update.Set(expression.Name("Completed"), expression.Value(*change.Completed)).
+			Set(expression.Name("Status"), expression.Value(statusKey(change.Owner, *change.Completed)))
+		if *change.Completed {
+			update = update.Remove(expression.Name("DueShard"))
+		} else {
+			update = update.Set(expression.Name("DueShard"), expression.Value(dueShard(change.ID)))
+		}
+		if !*change.Completed {
+			update = update.Remove(expression.Name("CompletedAt"))
+		} else if change.UpdatedAt != "" {
+			update = update.Set(expression.Name("CompletedAt"),
+				expression.IfNotExists(expression.Name("CompletedAt"), expression.Value(change.UpdatedAt)))
+		}
+	}
+
+	// Empty values remove the attribute, as DynamoDB cannot store an empty
+	// string set
+	optional := []struct {
+		name string
+		val  *string
+	}{
+		{"ListId", change.ListID},
+		{"Description", change.Description},
+		{"DueAt", change.DueAt},
+		{"Priority", change.Priority},
+		{"Recurrence", change.Recurrence},
+		{"TimeZone", change.TimeZone},
+	}
+	for _, attr := range optional {
+		if attr.val == nil {
+			continue
+		}
+		if *attr.val == "" {
+			update = update.Remove(expression.Name(attr.name))
+		} else {
+			update = update.Set(expression.Name(attr.name), expression.Value(*attr.val))
+		}
+	}
+	if change.Tags != nil {
+		if len(change.Tags) == 0 {
+			update = update.Remove(expression.Name("Tags"))
+		} else {
+			tags := &dynamodb.AttributeValue{SS: aws.StringSlice(change.Tags)}
+			update = update.Set(expression.Name("Tags"), expression.Value(tags))
+		}
+	}
+
+	if change.Occurrence != 0 {
+		update = update.Set(expression.Name("Occurrence"), expression.Value(change.Occurrence))
+	}
+	if change.NextID != "" {
+		update = update.Set(expression.Name("NextId"), expression.Value(change.NextID))
+	}
+	if change.Unlink {
+		update = update.Remove(expression.Name("NextId"))
+	}
+	if change.Position != "" {
+		// Todos from before PositionIndex join it when first moved
+		update = update.Set(expression.Name("Position"), expression.Value(change.Position)).
+			Set(expression.Name("OwnerKey"), expression.Value(ownerKey(change.Owner)))
+	}
+	if change.AutoComplete != nil {
+		if *change.AutoComplete {
+			update = update.Set(expression.Name("AutoComplete"), expression.Value(true))
+		} else {
+			update = update.Remove(expression.Name("AutoComplete"))
+		}
+	}
+
+	if change.DeletedAt != "" {
+		update = update.Set(expression.Name("DeletedAt"), expression.Value(change.DeletedAt)).
+			Set(expression.Name("ExpiresAt"), expression.Value(change.ExpiresAt))
+	}
+	if change.Restore {
+		update = update.Remove(expression.Name("DeletedAt")).Remove(expression.Name("ExpiresAt"))
+	}
+	return update
+}
+
+// changeCondition is the condition the change is written under. A
+// restore applies to a trashed item only, any other change to a live one.
+func changeCondition(change TodoChange) expression.ConditionBuilder {
+	cond := writeCondition(change.Owner, change.Version)
+	if change.Restore {
+		return cond.And(expression.AttributeExists(expression.Name("DeletedAt")))
+	}
+	return cond.And(expression.AttributeNotExists(expression.Name("DeletedAt")))
+}
+
+func isConditionalCheckFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
+
+// Update returns the item as written. A failed condition is
+// ErrVersionMismatch when a version was expected and ErrNotFound otherwise.
+func (s *DynamoStore) Update(change TodoChange) (Todos, error) {
+	expr, err := expression.NewBuilder().
+		WithUpdate(changeUpdate(change)).
+		WithCondition(updateCondition(change)).
+		Build()
+	if err != nil {
+		return Todos{}, err
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		TableName:                 aws.String(s.table),
+		Key:                       s.key(change.ID, change.Title),
+		ReturnValues:              aws.String("ALL_NEW"),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+	}
+
+	result, err := s.db.UpdateItem(input)
+	if isConditionalCheckFailed(err) && changesCount(change) {
+		return s.updateCounted(change)
+	} else if isConditionalCheckFailed(err) {
+		if change.Version != nil {
+			return Todos{}, ErrVersionMismatch
+		}
+		return Todos{}, ErrNotFound
+	} else if err != nil {
+		return Todos{}, err
+	}
+
+	updated := Todos{}
+	err = dynamodbattribute.UnmarshalMap(result.Attributes, &updated)
+	return updated, err
+}
+
+// changesCount tells whether the change trashes or restores a todo, which
+// takes it off or puts it back on the TodoCount of its list.
+func changesCount(change TodoChange) bool {
+	return change.DeletedAt != "" || change.Restore
+}
+
+// updateCondition is changeCondition, narrowed for a change trashing or
+// restoring a todo to a todo filed under no list, so that one filed under
+// a list goes through updateCounted.
+func updateCondition(change TodoChange) expression.ConditionBuilder {
+	if changesCount(change) {
+		return changeCondition(change).And(filedUnder(""))
+	}
+	return changeCondition(change)
+}
+
+// updateCounted trashes or restores a todo in one transaction with the
+// TodoCount of its list, reading the todo for the list first and again
+// when it changed lists in between. A list that turns out to be gone is
+// taken off the todo.
+func (s *DynamoStore) updateCounted(change TodoChange) (Todos, error) {
+	gone := ""
+	for attempt := 0; attempt < maxBatchAttempts; attempt++ {
+		item, err := s.Get(change.ID, change.Title)
+		if err != nil && err != ErrNotFound {
+			return Todos{}, err
+		}
+		if err := change.fails(item, err == nil); err != nil {
+			return Todos{}, err
+		}
+
+		from, to := item.ListID, ""
+		if change.Restore {
+			from, to = "", item.ListID
+		}
+		update, err := s.changeTransactItem(change, changeCondition(change).And(filedUnder(item.ListID)))
+		if err != nil {
+			return Todos{}, err
+		}
+		items, fromAt, toAt, err := s.refile([]*dynamodb.TransactWriteItem{update}, change.Owner, from, to, gone)
+		if err != nil {
+			return Todos{}, err
+		}
+
+		_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+		if conditionFailed(err, 0) {
+			continue
+		} else if conditionFailed(err, fromAt) || conditionFailed(err, toAt) {
+			unfiled := ""
+			change.ListID = &unfiled
+			gone = item.ListID
+			continue
+		} else if err != nil {
+			return Todos{}, err
+		}
+
+		// Transactions do not return the items they wrote
+		return s.Get(change.ID, change.Title)
+	}
+	return Todos{}, ErrThrottled
+}
+
+// Rename reads the old item for the list it is filed under, and moves the
+// TodoCount along when the todo changes lists on the way.
+func (s *DynamoStore) Rename(oldTitle string, todo Todos, version *int64) error {
+	av, err := dynamodbattribute.MarshalMap(todo)
+	if err != nil {
+		return err
+	}
+
+	gone := ""
+	for attempt := 0; attempt < maxBatchAttempts; attempt++ {
+		old, err := s.Get(todo.ID, oldTitle)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		change := TodoChange{Owner: todo.Owner, Version: version}
+		if err := change.fails(old, err == nil); err != nil {
+			return err
+		}
+
+		live := expression.AttributeNotExists(expression.Name("DeletedAt"))
+		cond := writeCondition(todo.Owner, version).And(live).And(filedUnder(old.ListID))
+		delExpr, err := expression.NewBuilder().WithCondition(cond).Build()
+		if err != nil {
+			return err
+		}
+
+		items := []*dynamodb.TransactWriteItem{
+			{
+				Delete: &dynamodb.Delete{
+					ExpressionAttributeNames:  delExpr.Names(),
+					ExpressionAttributeValues: delExpr.Values(),
+					Key:                       s.key(todo.ID, oldTitle),
+					TableName:                 aws.String(s.table),
+					ConditionExpression:       delExpr.Condition(),
+				},
+			},
+			{
+				Put: &dynamodb.Put{
+					Item:                av,
+					TableName:           aws.String(s.table),
+					ConditionExpression: aws.String("attribute_not_exists(ID)"),
+				},
+			},
+		}
+		items, from, to, err := s.refile(items, todo.Owner, old.ListID, todo.ListID, gone)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+		if conditionFailed(err, 0) {
+			// Changed since the read, which the next read sorts out
+			continue
+		} else if conditionFailed(err, 1) {
+			return ErrTitleExists
+		} else if conditionFailed(err, from) {
+			gone = old.ListID
+			continue
+		} else if conditionFailed(err, to) {
+			return ErrListNotFound
+		}
+		return err
+	}
+	return ErrThrottled
+}
+
+// Delete deletes a todo counted in no TodoCount right away. Should the
+// todo be live in a list, it is read for the list and deleted in one
+// transaction with the TodoCount of the list.
+func (s *DynamoStore) Delete(id string, title string, owner string, version *int64) error {
+	cond := writeCondition(owner, version).And(countedUnder(""))
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.DeleteItemInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		Key:                       s.key(id, title),
+		TableName:                 aws.String(s.table),
+		ConditionExpression:       expr.Condition(),
+	}
+
+	_, err = s.db.DeleteItem(input)
+	if isConditionalCheckFailed(err) {
+		return s.deleteFiled(id, title, owner, version)
+	}
+	return err
+}
+
+// deleteFiled deletes the todo together with its count in the TodoCount of
+// its list, reading the todo again when it changed lists in between. A
+// list that is gone is left out.
+func (s *DynamoStore) deleteFiled(id string, title string, owner string, version *int64) error {
+	gone := ""
+	for attempt := 0; attempt < maxBatchAttempts; attempt++ {
+		item, err := s.Get(id, title)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		if err := writeFails(item, err == nil, owner, version); err != nil {
+			return err
+		}
+
+		cond := writeCondition(owner, version).And(countedUnder(countedIn(item)))
+		expr, err := expression.NewBuilder().WithCondition(cond).Build()
+		if err != nil {
+			return err
+		}
+
+		items := []*dynamodb.TransactWriteItem{
+			{
+				Delete: &dynamodb.Delete{
+					ExpressionAttributeNames:  expr.Names(),
+					ExpressionAttributeValues: expr.Values(),
+					Key:                       s.key(id, title),
+					TableName:                 aws.String(s.table),
+					ConditionExpression:       expr.Condition(),
+				},
+			},
+		}
+		items, from, _, err := s.refile(items, owner, countedIn(item), "", gone)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+		if conditionFailed(err, 0) {
+			continue
+		} else if conditionFailed(err, from) {
+			gone = item.ListID
+			continue
+		}
+		return err
+	}
+	return ErrThrottled
+}
+
+const (
+	// DynamoDB limits on the number of items of a single call
+	maxBatchWriteItems    = 25
+	maxTransactWriteItems = 100
+
+	maxBatchAttempts = 5
+	batchBackoff     = 50 * time.Millisecond
+)
+
+// backoff waits before retry number attempt of a batch call, doubling the
+// delay each time.
+func backoff(attempt int) {
+	time.Sleep(batchBackoff << uint(attempt))
+}
+
+// PutAll writes the todos with BatchWriteItem, 25 at a time, retrying the
+// UnprocessedItems of each call with backoff. Live todos filed under a
+// list go through Put one by one instead, which keeps the TodoCount of the
+// list.
+func (s *DynamoStore) PutAll(todos []Todos) []error {
+	errs := make([]error, len(todos))
+	batched := []int{}
+	for i, todo := range todos {
+		if countedIn(todo) != "" {
+			errs[i] = s.Put(todo)
+		} else {
+			batched = append(batched, i)
+		}
+	}
+
+	for start := 0; start < len(batched); start += maxBatchWriteItems {
+		end := start + maxBatchWriteItems
+		if end > len(batched) {
+			end = len(batched)
+		}
+
+		// Unprocessed items come back without their position, so track
+		// pending items by key
+		pending := map[itemKey]int{}
+		requests := []*dynamodb.WriteRequest{}
+		for _, i := range batched[start:end] {
+			av, err := dynamodbattribute.MarshalMap(todos[i])
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			pending[itemKey{todos[i].ID, todos[i].Title}] = i
+			requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: av}})
+		}
+
+		for attempt := 0; len(requests) > 0; attempt++ {
+			if attempt == maxBatchAttempts {
+				for _, i := range pending {
+					errs[i] = ErrThrottled
+				}
+				break
+			}
+			if attempt > 0 {
+				backoff(attempt)
+			}
+
+			input := &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]*dynamodb.WriteRequest{s.table: requests},
+			}
+			result, err := s.db.BatchWriteItem(input)
+			if err != nil {
+				for _, i := range pending {
+					errs[i] = err
+				}
+				break
+			}
+
+			requests = result.UnprocessedItems[s.table]
+			unprocessed := map[itemKey]int{}
+			for _, request := range requests {
+				key := itemKey{aws.StringValue(request.PutRequest.Item["ID"].S), aws.StringValue(request.PutRequest.Item["Title"].S)}
+				unprocessed[key] = pending[key]
+			}
+			pending = unprocessed
+		}
+	}
+	return errs
+}
+
+// changeTransactItem is the transactional update applying the change to an
+// existing item on condition cond, changeCondition or narrower.
+func (s *DynamoStore) changeTransactItem(change TodoChange, cond expression.ConditionBuilder) (*dynamodb.TransactWriteItem, error) {
+	expr, err := expression.NewBuilder().
+		WithUpdate(changeUpdate(change)).
+		WithCondition(cond).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			TableName:                 aws.String(s.table),
+			Key:                       s.key(change.ID, change.Title),
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+		},
+	}, nil
+}
+
+// conditionFailed tells whether item n of the transaction err cancelled
+// failed its condition. Items count in the order of TransactItems, and a
+// negative n never fails.
+func conditionFailed(err error, n int) bool {
+	canceled, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok || n < 0 || n >= len(canceled.CancellationReasons) {
+		return false
+	}
+	return aws.StringValue(canceled.CancellationReasons[n].Code) == "ConditionalCheckFailed"
+}
+
+// filedUnder is the condition that the todo is filed under the list, or
+// under none when listID is empty.
+func filedUnder(listID string) expression.ConditionBuilder {
+	if listID == "" {
+		return expression.AttributeNotExists(expression.Name("ListId"))
+	}
+	return expression.Name("ListId").Equal(expression.Value(listID))
+}
+
+// countedUnder is the condition that the todo counts towards the TodoCount
+// of the list, or of none when listID is empty, as countedIn has it.
+func countedUnder(listID string) expression.ConditionBuilder {
+	live := expression.AttributeNotExists(expression.Name("DeletedAt"))
+	if listID == "" {
+		return filedUnder("").Or(expression.AttributeExists(expression.Name("DeletedAt")))
+	}
+	return filedUnder(listID).And(live)
+}
+
+// listCount is the transactional update adding delta to the TodoCount of
+// the list, which has to exist and belong to owner.
+func (s *DynamoStore) listCount(id string, owner string, delta int64) (*dynamodb.TransactWriteItem, error) {
+	expr, err := expression.NewBuilder().
+		WithUpdate(expression.Add(expression.Name("TodoCount"), expression.Value(delta))).
+		WithCondition(expression.AttributeExists(expression.Name("ID")).And(ownerCondition(owner))).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			TableName:                 aws.String(s.lists),
+			Key:                       s.listKey(id),
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+		},
+	}, nil
+}
+
+// refile appends to items the TodoCount updates of a todo of owner leaving
+// the list from for the list to, either of which may be empty, and returns
+// where in items the update of each list went, or -1 for none. The list
+// gone, which turned out to be deleted, is left out.
+func (s *DynamoStore) refile(items []*dynamodb.TransactWriteItem, owner string, from string, to string, gone string) ([]*dynamodb.TransactWriteItem, int, int, error) {
+	fromAt, toAt := -1, -1
+	if from == to {
+		return items, fromAt, toAt, nil
+	}
+	if from != "" && from != gone {
+		count, err := s.listCount(from, owner, -1)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		fromAt = len(items)
+		items = append(items, count)
+	}
+	if to != "" && to != gone {
+		count, err := s.listCount(to, owner, 1)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		toAt = len(items)
+		items = append(items, count)
+	}
+	return items, fromAt, toAt, nil
+}
+
+// reasonError is the error an item of a canceled transaction failed with,
+// made the AWS error of the code the reason stands for, so that it is
+// answered like that error.
+func reasonError(reason *dynamodb.CancellationReason) error {
+	code := aws.StringValue(reason.Code)
+	switch code {
+	case "ThrottlingError", "ProvisionedThroughputExceeded":
+		return ErrThrottled
+	case "TransactionConflict":
+		code = dynamodb.ErrCodeTransactionConflictException
+	case "ValidationError":
+		code = "ValidationException"
+	case "ItemCollectionSizeLimitExceeded":
+		code = dynamodb.ErrCodeItemCollectionSizeLimitExceededException
+	}
+	return awserr.New(code, aws.StringValue(reason.Message), nil)
+}
+
+// UpdateAll applies the changes with TransactWriteItems, 100 at a time. A
+// transaction is cancelled as a whole when one of its items fails, so an
+// item failing its condition or with an error retrying cannot fix is
+// failed on its own and the rest of the chunk is retried without it.
+// Items that were throttled or conflicted with another transaction are
+// retried with backoff, and fail with that error when they run out of
+// attempts. Items canceled only because another item failed are retried
+// at once, without using up an attempt. Trashing or restoring a todo
+// filed under a list fails the condition of its item too, and is then
+// done on its own, in one transaction with the TodoCount of the list.
+func (s *DynamoStore) UpdateAll(changes []TodoChange) []error {
+	errs := make([]error, len(changes))
+	for start := 0; start < len(changes); start += maxTransactWriteItems {
+		end := start + maxTransactWriteItems
+		if end > len(changes) {
+			end = len(changes)
+		}
+
+		pending := []int{}
+		retried := map[int]error{}
+		transactItems := map[int]*dynamodb.TransactWriteItem{}
+		for i := start; i < end; i++ {
+			item, err := s.changeTransactItem(changes[i], updateCondition(changes[i]))
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			transactItems[i] = item
+			pending = append(pending, i)
+		}
+
+		for attempt := 0; len(pending) > 0; {
+			if attempt == maxBatchAttempts {
+				for _, i := range pending {
+					errs[i] = ErrThrottled
+					if retried[i] != nil {
+						errs[i] = retried[i]
+					}
+				}
+				break
+			}
+
+			items := []*dynamodb.TransactWriteItem{}
+			for _, i := range pending {
+				items = append(items, transactItems[i])
+			}
+
+			_, err := s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+			if err == nil {
+				break
+			}
+
+			canceled, ok := err.(*dynamodb.TransactionCanceledException)
+			if !ok {
+				for _, i := range pending {
+					errs[i] = err
+				}
+				break
+			}
+
+			// Reasons are listed in the order of TransactItems
+			retry := []int{}
+			throttled := false
+			for n, i := range pending {
+				reason := &dynamodb.CancellationReason{}
+				if n < len(canceled.CancellationReasons) {
+					reason = canceled.CancellationReasons[n]
+				}
+				switch code := aws.StringValue(reason.Code); code {
+				case "ConditionalCheckFailed":
+					errs[i] = ErrNotFound
+					if changes[i].Version != nil {
+						errs[i] = ErrVersionMismatch
+					}
+					if changesCount(changes[i]) {
+						// Filed under a list, or failing for good
+						_, errs[i] = s.updateCounted(changes[i])
+					}
+				case "", "None":
+					// Canceled only because another item failed
+					retry = append(retry, i)
+				case "ThrottlingError", "ProvisionedThroughputExceeded", "TransactionConflict":
+					retried[i] = reasonError(reason)
+					retry = append(retry, i)
+					throttled = true
+				default:
+					errs[i] = reasonError(reason)
+				}
+			}
+
+			// Dropping the failed items is retried at once, only throttles
+			// and conflicts, or a round failing nothing, use up an attempt
+			if throttled || len(retry) == len(pending) {
+				attempt++
+				if attempt < maxBatchAttempts {
+					backoff(attempt)
+				}
+			}
+			pending = retry
+		}
+	}
+	return errs
+}
+
+// Move reads the todo for the list it is leaving, then updates it and the
+// TodoCount of both lists in one transaction, so a todo never ends up in a
+// list deleted in the meantime. The update is conditioned on the todo
+// still being in the list read, and reads it again when it moved since.
+func (s *DynamoStore) Move(change TodoChange) (Todos, error) {
+	to := ""
+	if change.ListID != nil {
+		to = *change.ListID
+	}
+
+	gone := ""
+	for attempt := 0; attempt < maxBatchAttempts; attempt++ {
+		current, err := s.Get(change.ID, change.Title)
+		if err != nil && err != ErrNotFound {
+			return Todos{}, err
+		}
+		if err := change.fails(current, err == nil); err != nil {
+			return Todos{}, err
+		}
+
+		update, err := s.changeTransactItem(change, changeCondition(change).And(filedUnder(current.ListID)))
+		if err != nil {
+			return Todos{}, err
+		}
+		items, from, toAt, err := s.refile([]*dynamodb.TransactWriteItem{update}, change.Owner, current.ListID, to, gone)
+		if err != nil {
+			return Todos{}, err
+		}
+
+		_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+		if conditionFailed(err, 0) {
+			continue
+		} else if conditionFailed(err, from) {
+			gone = current.ListID
+			continue
+		} else if conditionFailed(err, toAt) {
+			return Todos{}, ErrListNotFound
+		} else if err != nil {
+			return Todos{}, err
+		}
+
+		// Transactions do not return the items they wrote
+		return s.Get(change.ID, change.Title)
+	}
+	return Todos{}, ErrThrottled
+}
+
+func (s *DynamoStore) listKey(id string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"ID": {
+			S: aws.String(id),
+		},
+	}
+}
+
+// PutList writes the list with its OwnerKey for ListOwnerIndex.
+func (s *DynamoStore) PutList(list TodoList) error {
+	list.OwnerKey = ownerKey(list.Owner)
+	av, err := dynamodbattribute.MarshalMap(list)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(s.lists),
+	}
+
+	_, err = s.db.PutItem(input)
+	return err
+}
+
+func (s *DynamoStore) GetList(id string) (TodoList, error) {
+	input := &dynamodb.GetItemInput{
+		Key:            s.listKey(id),
+		TableName:      aws.String(s.lists),
+		ConsistentRead: aws.Bool(true),
+	}
+
+	result, err := s.db.GetItem(input)
+	if err != nil {
+		return TodoList{}, err
+	}
+	if result.Item == nil {
+		return TodoList{}, ErrListNotFound
+	}
+
+	list := TodoList{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &list)
+	return list, err
+}
+
+// QueryLists reads the lists of owner from ListOwnerIndex.
+func (s *DynamoStore) QueryLists(owner string) ([]TodoList, error) {
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key("OwnerKey").Equal(expression.Value(ownerKey(owner)))).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	lists := []TodoList{}
+	var startKey map[string]*dynamodb.AttributeValue
+	for {
+		params := &dynamodb.QueryInput{
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			KeyConditionExpression:    expr.KeyCondition(),
+			TableName:                 aws.String(s.lists),
+			IndexName:                 aws.String(ListOwnerIndexName),
+			ExclusiveStartKey:         startKey,
+		}
+
+		result, err := s.db.Query(params)
+		if err != nil {
+			return nil, err
+		}
+
+		page := []TodoList{}
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return lists, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+func (s *DynamoStore) UpdateList(list TodoList) (TodoList, error) {
+	expr, err := expression.NewBuilder().
+		WithUpdate(expression.Set(expression.Name("Name"), expression.Value(list.Name)).
+			Set(expression.Name("UpdatedAt"), expression.Value(list.UpdatedAt))).
+		WithCondition(expression.AttributeExists(expression.Name("ID")).And(ownerCondition(list.Owner))).
+		Build()
+	if err != nil {
+		return TodoList{}, err
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		TableName:                 aws.String(s.lists),
+		Key:                       s.listKey(list.ID),
+		ReturnValues:              aws.String("ALL_NEW"),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+	}
+
+	result, err := s.db.UpdateItem(input)
+	if isConditionalCheckFailed(err) {
+		return TodoList{}, ErrListNotFound
+	} else if err != nil {
+		return TodoList{}, err
+	}
+
+	updated := TodoList{}
+	err = dynamodbattribute.UnmarshalMap(result.Attributes, &updated)
+	return updated, err
+}
+
+// DeleteList takes the trashed todos of the list out of it, which they do
+// not count towards, and deletes the list on condition that its TodoCount
+// is 0, the last 99 trashed todos in the same transaction. A todo filed
+// under the list or restored in the meantime fails the delete with
+// ErrListNotEmpty rather than being left in a list that is gone.
+func (s *DynamoStore) DeleteList(id string, owner string) error {
+	trashed, _, err := s.Query(TodoQuery{Owner: owner, ListID: id, Deleted: true})
+	if err != nil {
+		return err
+	}
+
+	// Transactions take 100 items, one of which is the list
+	for len(trashed) >= maxTransactWriteItems {
+		items, err := s.unfileAll(trashed[:maxTransactWriteItems-1], id)
+		if err != nil {
+			return err
+		}
+		_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+		if err != nil {
+			return s.listDeleteError(id, owner, err)
+		}
+		trashed = trashed[maxTransactWriteItems-1:]
+	}
+
+	items, err := s.unfileAll(trashed, id)
+	if err != nil {
+		return err
+	}
+	empty := expression.AttributeNotExists(expression.Name("TodoCount")).
+		Or(expression.Name("TodoCount").Equal(expression.Value(0)))
+	cond := expression.AttributeExists(expression.Name("ID")).And(ownerCondition(owner)).And(empty)
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return err
+	}
+
+	items = append(items, &dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			Key:                       s.listKey(id),
+			TableName:                 aws.String(s.lists),
+			ConditionExpression:       expr.Condition(),
+		},
+	})
+	_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		return s.listDeleteError(id, owner, err)
+	}
+	return nil
+}
+
+// unfileAll is the transactional updates taking the trashed todos out of
+// the list, each on condition that it is still in the list and trashed,
+// bumping their Version.
+func (s *DynamoStore) unfileAll(trashed []Todos, listID string) ([]*dynamodb.TransactWriteItem, error) {
+	items := []*dynamodb.TransactWriteItem{}
+	for _, todo := range trashed {
+		cond := filedUnder(listID).And(expression.AttributeExists(expression.Name("DeletedAt")))
+		update := expression.Remove(expression.Name("ListId")).
+			Set(expression.Name("Version"),
+				expression.Plus(expression.IfNotExists(expression.Name("Version"), expression.Value(0)), expression.Value(1)))
+		expr, err := expression.NewBuilder().WithCondition(cond).WithUpdate(update).Build()
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, &dynamodb.TransactWriteItem{
+			Update: &dynamodb.Update{
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				TableName:                 aws.String(s.table),
+				Key:                       s.key(todo.ID, todo.Title),
+				UpdateExpression:          expr.Update(),
+				ConditionExpression:       expr.Condition(),
+			},
+		})
+	}
+	return items, nil
+}
+
+// listDeleteError is the error of a failed DeleteList transaction. Any
+// failed condition is ErrListNotEmpty, unless the list is gone or belongs
+// to someone else.
+func (s *DynamoStore) listDeleteError(id string, owner string, err error) error {
+	if _, ok := err.(*dynamodb.TransactionCanceledException); !ok {
+		return err
+	}
+	for n := 0; n < maxTransactWriteItems; n++ {
+		if !conditionFailed(err, n) {
+			continue
+		}
+		list, err := s.GetList(id)
+		if err == nil && list.Owner != owner {
+			return ErrListNotFound
+		} else if err != nil {
+			return err
+		}
+		return ErrListNotEmpty
+	}
+	return err
+}
+
+// PutKeyed writes the todo and the record in one transaction, the record
+// on condition that its key is free, along with the TodoCount of the list
+// the todo is filed under. TTL deletes lag behind, so an expired record
+// counts as gone.
+func (s *DynamoStore) PutKeyed(todo Todos, record IdempotencyRecord) error {
+	av, err := dynamodbattribute.MarshalMap(todo)
+	if err != nil {
+		return err
+	}
+	recordAv, err := dynamodbattribute.MarshalMap(record)
+	if err != nil {
+		return err
+	}
+
+	cond := expression.AttributeNotExists(expression.Name("Key")).
+		Or(expression.Name("ExpiresAt").LessThan(expression.Value(time.Now().Unix())))
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return err
+	}
+
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Put: &dynamodb.Put{
+				Item:      av,
+				TableName: aws.String(s.table),
+			},
+		},
+		{
+			Put: &dynamodb.Put{
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				Item:                      recordAv,
+				TableName:                 aws.String(s.keys),
+				ConditionExpression:       expr.Condition(),
+			},
+		},
+	}
+	items, _, listAt, err := s.refile(items, todo.Owner, "", countedIn(todo), "")
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if conditionFailed(err, 1) {
+		return ErrKeyUsed
+	} else if conditionFailed(err, listAt) {
+		return ErrListNotFound
+	}
+	return err
+}
+
+func (s *DynamoStore) GetIdempotencyRecord(key string) (IdempotencyRecord, error) {
+	input := &dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"Key": {
+				S: aws.String(key),
+			},
+		},
+		TableName:      aws.String(s.keys),
+		ConsistentRead: aws.Bool(true),
+	}
+
+	result, err := s.db.GetItem(input)
+	if err != nil {
+		return IdempotencyRecord{}, err
+	}
+	if result.Item == nil {
+		return IdempotencyRecord{}, ErrNotFound
+	}
+
+	record := IdempotencyRecord{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &record)
+	if err == nil && record.ExpiresAt <= time.Now().Unix() {
+		return IdempotencyRecord{}, ErrNotFound
+	}
+	return record, err
+}
+
+func (s *DynamoStore) PutUndo(action UndoAction) error {
+	av, err := dynamodbattribute.MarshalMap(action)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(s.undo),
+	}
+
+	_, err = s.db.PutItem(input)
+	return err
+}
+
+// GetUndo reads the action consistently, so a token works right after the
+// write that handed it out. TTL deletes lag behind, so an expired action
+// counts as gone.
+func (s *DynamoStore) GetUndo(key string) (UndoAction, error) {
+	input := &dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"Key": {
+				S: aws.String(key),
+			},
+		},
+		TableName:      aws.String(s.undo),
+		ConsistentRead: aws.Bool(true),
+	}
+
+	result, err := s.db.GetItem(input)
+	if err != nil {
+		return UndoAction{}, err
+	}
+	if result.Item == nil {
+		return UndoAction{}, ErrNotFound
+	}
+
+	action := UndoAction{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &action)
+	if err == nil && action.ExpiresAt <= time.Now().Unix() {
+		return UndoAction{}, ErrNotFound
+	}
+	return action, err
+}
+
+// DynamoReminderLog is a ReminderLog backed by the TodoReminders table.
+type DynamoReminderLog struct {
+	db    dynamodbiface.DynamoDBAPI
+	table string
+}
+
+func NewDynamoReminderLog(db dynamodbiface.DynamoDBAPI, table string) *DynamoReminderLog {
+	return &DynamoReminderLog{db: db, table: table}
+}
+
+func (l *DynamoReminderLog) key(key string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"Key": {
+			S: aws.String(key),
+		},
+	}
+}
+
+// Claim puts the reminder unless it is there already. TTL deletes lag
+// behind, so an expired claim counts as gone.
+func (l *DynamoReminderLog) Claim(key string, expiresAt int64) (bool, error) {
+	cond := expression.AttributeNotExists(expression.Name("Key")).
+		Or(expression.Name("ExpiresAt").LessThan(expression.Value(time.Now().Unix())))
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return false, err
+	}
+
+	item := l.key(key)
+	item["ExpiresAt"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(expiresAt, 10))}
+	input := &dynamodb.PutItemInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		Item:                      item,
+		TableName:                 aws.String(l.table),
+		ConditionExpression:       expr.Condition(),
+	}
+
+	_, err = l.db.PutItem(input)
+	if isConditionalCheckFailed(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *DynamoReminderLog) Release(key string) error {
+	input := &dynamodb.DeleteItemInput{
+		Key:       l.key(key),
+		TableName: aws.String(l.table),
+	}
+
+	_, err := l.db.DeleteItem(input)
+	return err
+}
+
+// DynamoSearchIndex is a SearchIndex backed by the TodoSearch table. The
+// items of an owner share the partition key PK. Each indexed token of a
+// todo is a posting with the sort key tok#<token>#<ID>, so a prefix search
+// is a single begins_with Query, and the doc#<ID> item remembers the
+// tokens indexed for the todo so that reindexing it only writes what
+// changed.
+type DynamoSearchIndex struct {
+	db    dynamodbiface.DynamoDBAPI
+	table string
+}
+
+func NewDynamoSearchIndex(db dynamodbiface.DynamoDBAPI, table string) *DynamoSearchIndex {
+	return &DynamoSearchIndex{db: db, table: table}
+}
+
+type searchDoc struct {
+	PK      string
+	SK      string
+	Title   string
+	Weights map[string]int
+}
+
+type searchPostingItem struct {
+	PK     string
+	SK     string
+	ID     string
+	Title  string
+	Token  string
+	Weight int
+}
+
+// searchPartition is the partition of an owner. Key attributes cannot be
+// empty, so the prefix also covers todos without an owner.
+func searchPartition(owner string) string {
+	return "owner#" + owner
+}
+
+func (x *DynamoSearchIndex) key(owner string, sk string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"PK": {
+			S: aws.String(searchPartition(owner)),
+		},
+		"SK": {
+			S: aws.String(sk),
+		},
+	}
+}
+
+func (x *DynamoSearchIndex) doc(owner string, id string) (searchDoc, error) {
+	input := &dynamodb.GetItemInput{
+		Key:            x.key(owner, "doc#"+id),
+		TableName:      aws.String(x.table),
+		ConsistentRead: aws.Bool(true),
+	}
+	result, err := x.db.GetItem(input)
+	doc := searchDoc{}
+	if err != nil || result.Item == nil {
+		return doc, err
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &doc)
+	return doc, err
+}
+
+// write runs the requests with BatchWriteItem, 25 at a time, retrying the
+// UnprocessedItems of each call with backoff.
+func (x *DynamoSearchIndex) write(requests []*dynamodb.WriteRequest) error {
+	for start := 0; start < len(requests); start += maxBatchWriteItems {
+		end := start + maxBatchWriteItems
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		pending := requests[start:end]
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == maxBatchAttempts {
+				return ErrThrottled
+			}
+			if attempt > 0 {
+				backoff(attempt)
+			}
+
+			input := &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]*dynamodb.WriteRequest{x.table: pending},
+			}
+			result, err := x.db.BatchWriteItem(input)
+			if err != nil {
+				return err
+			}
+			pending = result.UnprocessedItems[x.table]
+		}
+	}
+	return nil
+}
+
+// Index writes the postings of tokens that are new or changed weight,
+// deletes those of tokens gone and then the doc item. A rename rewrites
+// every posting, as they carry the title.
+func (x *DynamoSearchIndex) Index(todo Todos) error {
+	old, err := x.doc(todo.Owner, todo.ID)
+	if err != nil {
+		return err
+	}
+
+	weights := indexTokens(todo)
+	requests := []*dynamodb.WriteRequest{}
+	for token, weight := range weights {
+		if old.Weights[token] == weight && old.Title == todo.Title {
+			continue
+		}
+		av, err := dynamodbattribute.MarshalMap(searchPostingItem{
+			PK:     searchPartition(todo.Owner),
+			SK:     "tok#" + token + "#" + todo.ID,
+			ID:     todo.ID,
+			Title:  todo.Title,
+			Token:  token,
+			Weight: weight,
+		})
+		if err != nil {
+			return err
+		}
+		requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: av}})
+	}
+	for token := range old.Weights {
+		if _, ok := weights[token]; !ok {
+			requests = append(requests, &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{
+				Key: x.key(todo.Owner, "tok#"+token+"#"+todo.ID),
+			}})
+		}
+	}
+	err = x.write(requests)
+	if err != nil {
+		return err
+	}
+
+	// The doc item goes last, so a failure above is retried in full by the
+	// next reindex
+	av, err := dynamodbattribute.MarshalMap(searchDoc{
+		PK:      searchPartition(todo.Owner),
+		SK:      "doc#" + todo.ID,
+		Title:   todo.Title,
+		Weights: weights,
+	})
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(x.table),
+	}
+	_, err = x.db.PutItem(input)
+	return err
+}
+
+// Remove deletes the postings of the todo and then its doc item.
+func (x *DynamoSearchIndex) Remove(owner string, id string) error {
+	old, err := x.doc(owner, id)
+	if err != nil {
+		return err
+	}
+
+	requests := []*dynamodb.WriteRequest{}
+	for token := range old.Weights {
+		requests = append(requests, &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{
+			Key: x.key(owner, "tok#"+token+"#"+id),
+		}})
+	}
+	requests = append(requests, &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{
+		Key: x.key(owner, "doc#"+id),
+	}})
+	return x.write(requests)
+}
+
+func (x *DynamoSearchIndex) Match(owner string, prefix string) ([]SearchPosting, error) {
+	keyCond := expression.Key("PK").Equal(expression.Value(searchPartition(owner))).
+		And(expression.Key("SK").BeginsWith("tok#" + prefix))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	postings := []SearchPosting{}
+	var startKey map[string]*dynamodb.AttributeValue
+	for {
+		input := &dynamodb.QueryInput{
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			KeyConditionExpression:    expr.KeyCondition(),
+			TableName:                 aws.String(x.table),
+			ExclusiveStartKey:         startKey,
+		}
+		result, err := x.db.Query(input)
+		if err != nil {
+			return nil, err
+		}
+
+		items := []searchPostingItem{}
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &items)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			postings = append(postings, SearchPosting{ID: item.ID, Title: item.Title, Token: item.Token, Weight: item.Weight})
+		}
+
+		startKey = result.LastEvaluatedKey
+		if len(startKey) == 0 {
+			return postings, nil
+		}
+	}
+}
+
+// DynamoHistoryStore is a HistoryStore backed by the TodoHistory table.
+type DynamoHistoryStore struct {
+	db    dynamodbiface.DynamoDBAPI
+	table string
+}
+
+func NewDynamoHistoryStore(db dynamodbiface.DynamoDBAPI, table string) *DynamoHistoryStore {
+	return &DynamoHistoryStore{db: db, table: table}
+}
+
+// Append puts the event unless its key is taken, which never overwrites
+// the history.
+func (x *DynamoHistoryStore) Append(event TodoEvent) error {
+	item, err := dynamodbattribute.MarshalMap(event)
+	if err != nil {
+		return err
+	}
+	cond := expression.AttributeNotExists(expression.Name("TodoId"))
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		ExpressionAttributeNames: expr.Names(),
+		Item:                     item,
+		TableName:                aws.String(x.table),
+		ConditionExpression:      expr.Condition(),
+	}
+	_, err = x.db.PutItem(input)
+	if isConditionalCheckFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// Events queries the todo's partition backwards, reading on while the
+// owner filter leaves a page short, like DynamoStore.Query.
+func (x *DynamoHistoryStore) Events(id string, owner string, limit int64, startKey PageKey) ([]TodoEvent, PageKey, error) {
+	keyCond := expression.Key("TodoId").Equal(expression.Value(id))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithFilter(ownerCondition(owner)).Build()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	history := []TodoEvent{}
+	exclusiveStartKey := fromPageKey(startKey)
+	for {
+		input := &dynamodb.QueryInput{
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			KeyConditionExpression:    expr.KeyCondition(),
+			FilterExpression:          expr.Filter(),
+			TableName:                 aws.String(x.table),
+			ExclusiveStartKey:         exclusiveStartKey,
+			Limit:                     aws.Int64(limit - int64(len(history))),
+			ScanIndexForward:          aws.Bool(false),
+		}
+		result, err := x.db.Query(input)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		page := []TodoEvent{}
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return nil, nil, err
+		}
+		history = append(history, page...)
+
+		lastKey := result.LastEvaluatedKey
+		if len(lastKey) == 0 || int64(len(history)) >= limit {
+			return history, toPageKey(lastKey), nil
+		}
+		exclusiveStartKey = lastKey
+	}
+}
@@ -0,0 +1,185 @@
+package todo
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// rawMessage is what the fake DynamoDB fails with; none of it may reach
+// the client.
+const rawMessage = "Requested resource not found: Table: Todos not found"
+
+// answer is the response a handler gives for a store error.
+func answer(t *testing.T, err error) (int, apierror.Code, string, error) {
+	t.Helper()
+	apiResponse, goErr := errorResponse(apierror.Internal, batchError(err))
+	if strings.Contains(apiResponse.Body, "Todos") || strings.Contains(apiResponse.Body, "FAKE") {
+		t.Errorf("body leaks the AWS error: %s", apiResponse.Body)
+	}
+	body := struct {
+		Code  apierror.Code `json:"code"`
+		Error string        `json:"error"`
+	}{}
+	if err := json.Unmarshal([]byte(apiResponse.Body), &body); err != nil {
+		t.Fatalf("body is not an envelope: %s", apiResponse.Body)
+	}
+	return apiResponse.StatusCode, body.Code, body.Error, goErr
+}
+
+func TestDynamoStoreErrors(t *testing.T) {
+	todo := Todos{ID: "1", Title: "a", Owner: "u1"}
+	change := TodoChange{ID: "1", Title: "a", Owner: "u1", UpdatedAt: "2026-01-01T00:00:00Z"}
+	ops := []struct {
+		name string
+		op   string
+		// conditional is set for writes that turn a failed condition into
+		// ErrNotFound
+		conditional bool
+		run         func(s *DynamoStore) error
+	}{
+		{"Put", "PutItem", false, func(s *DynamoStore) error {
+			return s.Put(todo)
+		}},
+		{"Update", "UpdateItem", true, func(s *DynamoStore) error {
+			_, err := s.Update(change)
+			return err
+		}},
+		{"Delete", "DeleteItem", true, func(s *DynamoStore) error {
+			return s.Delete(todo.ID, todo.Title, todo.Owner, nil)
+		}},
+		{"PutAll", "BatchWriteItem", false, func(s *DynamoStore) error {
+			return s.PutAll([]Todos{todo})[0]
+		}},
+		{"UpdateAll", "TransactWriteItems", false, func(s *DynamoStore) error {
+			return s.UpdateAll([]TodoChange{change})[0]
+		}},
+	}
+	failures := []struct {
+		code    string
+		status  int
+		apiCode apierror.Code
+		message string
+	}{
+		{dynamodb.ErrCodeConditionalCheckFailedException, http.StatusConflict, apierror.Conflict, "The item was changed by another request"},
+		{dynamodb.ErrCodeProvisionedThroughputExceededException, http.StatusTooManyRequests, apierror.Throttled, "Too many requests, try again later"},
+		{dynamodb.ErrCodeResourceNotFoundException, http.StatusServiceUnavailable, apierror.Unavailable, "Storage is not available"},
+		{"ValidationException", http.StatusBadRequest, apierror.ValidationFailed, "The request could not be stored"},
+	}
+
+	for _, op := range ops {
+		for _, failure := range failures {
+			t.Run(op.name+"/"+failure.code, func(t *testing.T) {
+				fake := NewFakeDynamoDB(nil)
+				fake.Errors[op.op] = AWSError(failure.code, rawMessage)
+				err := op.run(NewDynamoStore(fake, TableName))
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				status, code, message := failure.status, failure.apiCode, failure.message
+				if op.conditional && failure.code == dynamodb.ErrCodeConditionalCheckFailedException {
+					status, code, message = http.StatusNotFound, apierror.NotFound, ErrNotFound.Error()
+				}
+				gotStatus, gotCode, gotMessage, goErr := answer(t, err)
+				if gotStatus != status || gotCode != code || gotMessage != message {
+					t.Errorf("got %d %s %q, want %d %s %q", gotStatus, gotCode, gotMessage, status, code, message)
+				}
+				if (goErr != nil) != (status >= http.StatusInternalServerError) {
+					t.Errorf("got Go error %v for status %d", goErr, status)
+				}
+			})
+		}
+	}
+}
+
+func TestUpdateAllCancellationReasons(t *testing.T) {
+	cases := []struct {
+		reason  string
+		status  int
+		apiCode apierror.Code
+		calls   int
+	}{
+		{"ConditionalCheckFailed", http.StatusNotFound, apierror.NotFound, 1},
+		{"ValidationError", http.StatusBadRequest, apierror.ValidationFailed, 1},
+		{"ItemCollectionSizeLimitExceeded", http.StatusBadRequest, apierror.ValidationFailed, 1},
+		{"ThrottlingError", http.StatusTooManyRequests, apierror.Throttled, maxBatchAttempts},
+		{"TransactionConflict", http.StatusConflict, apierror.Conflict, maxBatchAttempts},
+	}
+	for _, c := range cases {
+		t.Run(c.reason, func(t *testing.T) {
+			fake := NewFakeDynamoDB(nil)
+			fake.Errors["TransactWriteItems"] = &dynamodb.TransactionCanceledException{
+				Message_: aws.String("Transaction cancelled on table Todos"),
+				CancellationReasons: []*dynamodb.CancellationReason{
+					{Code: aws.String(c.reason), Message: aws.String("Item of table Todos")},
+				},
+			}
+			err := NewDynamoStore(fake, TableName).UpdateAll([]TodoChange{{ID: "1", Title: "a", Owner: "u1"}})[0]
+
+			status, code, _, _ := answer(t, err)
+			if status != c.status || code != c.apiCode {
+				t.Errorf("got %d %s, want %d %s", status, code, c.status, c.apiCode)
+			}
+			if len(fake.Calls) != c.calls {
+				t.Errorf("got %d calls, want %d", len(fake.Calls), c.calls)
+			}
+		})
+	}
+}
+
+// scriptedDynamoDB fails its TransactWriteItems calls with the errors in
+// turn, and as the FakeDynamoDB does once they run out.
+type scriptedDynamoDB struct {
+	*FakeDynamoDB
+	errs []error
+}
+
+func (s *scriptedDynamoDB) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	if len(s.errs) > 0 {
+		s.Errors["TransactWriteItems"], s.errs = s.errs[0], s.errs[1:]
+	}
+	return s.FakeDynamoDB.TransactWriteItems(input)
+}
+
+func TestUpdateAllRetriesCanceledItems(t *testing.T) {
+	// Every call fails the first item and cancels the rest, which takes
+	// more calls than there are attempts
+	changes := []TodoChange{}
+	errs := []error{}
+	for n := 0; n <= maxBatchAttempts; n++ {
+		changes = append(changes, TodoChange{ID: string(rune('a' + n)), Title: "a", Owner: "u1"})
+		reasons := []*dynamodb.CancellationReason{{Code: aws.String("ValidationError")}}
+		for i := n + 1; i <= maxBatchAttempts; i++ {
+			reasons = append(reasons, &dynamodb.CancellationReason{Code: aws.String("None")})
+		}
+		errs = append(errs, &dynamodb.TransactionCanceledException{CancellationReasons: reasons})
+	}
+	fake := &scriptedDynamoDB{FakeDynamoDB: NewFakeDynamoDB(nil), errs: errs}
+
+	for i, err := range NewDynamoStore(fake, TableName).UpdateAll(changes) {
+		if status, code, _, _ := answer(t, err); status != http.StatusBadRequest {
+			t.Errorf("change %d: got %d %s, want each item failing on its own", i, status, code)
+		}
+	}
+	if len(fake.Calls) != maxBatchAttempts+1 {
+		t.Errorf("got %d calls, want %d", len(fake.Calls), maxBatchAttempts+1)
+	}
+
+	// Canceled without any item failing, they run out of attempts
+	canceled := NewFakeDynamoDB(nil)
+	canceled.Errors["TransactWriteItems"] = &dynamodb.TransactionCanceledException{
+		CancellationReasons: []*dynamodb.CancellationReason{{Code: aws.String("None")}},
+	}
+	if err := NewDynamoStore(canceled, TableName).UpdateAll(changes[:1])[0]; err != ErrThrottled {
+		t.Errorf("got %v, want ErrThrottled", err)
+	}
+	if len(canceled.Calls) != maxBatchAttempts {
+		t.Errorf("got %d calls, want %d", len(canceled.Calls), maxBatchAttempts)
+	}
+}
@@ -0,0 +1,365 @@
+package todo
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// ErrUnknownFormat is returned for a ?format= that is not exported to.
+var ErrUnknownFormat = errors.New("Unknown format, expected one of json, csv, markdown, ics")
+
+// ErrExportTooLarge is returned for an export that does not fit a response.
+var ErrExportTooLarge = fmt.Errorf("Export larger than the %d MB a response holds", maxExportSize>>20)
+
+// maxExportSize is the most an export writes, leaving room in the 6 MB of
+// a lambda response for its envelope and the escaping of the body.
+const maxExportSize = 5 << 20
+
+// ErrNotAcceptable is returned when no format of the Accept header is
+// exported to.
+var ErrNotAcceptable = errors.New("Not acceptable, export is available as application/json, text/csv, text/markdown and text/calendar")
+
+// ExportFormat is a format todos are exported to.
+type ExportFormat struct {
+	Name        string
+	ContentType string
+	Extension   string
+	Write       func(w io.Writer, todos []Todos) error
+}
+
+// ExportFormats lists the export formats, JSON first as the default.
+var ExportFormats = []ExportFormat{
+	{"json", "application/json", "json", writeJSON},
+	{"csv", "text/csv", "csv", writeCSV},
+	{"markdown", "text/markdown", "md", writeMarkdown},
+	{"ics", "text/calendar", "ics", writeICS},
+}
+
+// formatAliases are the other names ?format= and Accept know formats by.
+var formatAliases = map[string]string{
+	"md":              "markdown",
+	"ical":            "ics",
+	"text/x-markdown": "markdown",
+}
+
+func exportFormat(name string) (ExportFormat, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := formatAliases[name]; ok {
+		name = alias
+	}
+	for _, format := range ExportFormats {
+		if format.Name == name || format.ContentType == name {
+			return format, true
+		}
+	}
+	return ExportFormat{}, false
+}
+
+// acceptFormat is the format a media range of an Accept header asks for:
+// */* is the default, and type/* the first format of that type.
+func acceptFormat(name string) (ExportFormat, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "*/*" {
+		return ExportFormats[0], true
+	}
+	if strings.HasSuffix(name, "/*") {
+		for _, format := range ExportFormats {
+			if strings.HasPrefix(format.ContentType, strings.TrimSuffix(name, "*")) {
+				return format, true
+			}
+		}
+		return ExportFormat{}, false
+	}
+	return exportFormat(name)
+}
+
+// negotiateFormat picks the format of the Accept header the client
+// prefers most, by q value and then by order. A missing header means
+// JSON.
+func negotiateFormat(accept string) (ExportFormat, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return ExportFormats[0], true
+	}
+
+	type mediaRange struct {
+		name string
+		q    float64
+	}
+	ranges := []mediaRange{}
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		r := mediaRange{name: strings.TrimSpace(params[0]), q: 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					r.q = q
+				}
+			}
+		}
+		if r.q > 0 {
+			ranges = append(ranges, r)
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, r := range ranges {
+		if format, ok := acceptFormat(r.name); ok {
+			return format, true
+		}
+	}
+	return ExportFormat{}, false
+}
+
+func writeJSON(w io.Writer, todos []Todos) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(todos)
+}
+
+// csvColumns are the columns of the CSV export, named like the json
+// fields. Tags are joined with semicolons.
+var csvColumns = []string{
+	"id", "title", "completed", "dueAt", "priority", "tags", "description", "listId", "parentId",
+	"recurrence", "timeZone", "position", "createdAt", "updatedAt", "completedAt",
+}
+
+func writeCSV(w io.Writer, todos []Todos) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(csvColumns)
+	if err != nil {
+		return err
+	}
+	for _, todo := range todos {
+		err := writer.Write([]string{
+			todo.ID, todo.Title, strconv.FormatBool(todo.Completed), todo.DueAt, todo.Priority,
+			strings.Join(todo.Tags, ";"), todo.Description, todo.ListID, todo.ParentID,
+			todo.Recurrence, todo.TimeZone, todo.Position, todo.CreatedAt, todo.UpdatedAt, todo.CompletedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// markdownDue is the due date as written after due: in a checklist, the
+// bare date when it is midnight UTC.
+func markdownDue(dueAt string) string {
+	if strings.HasSuffix(dueAt, "T00:00:00Z") {
+		return strings.TrimSuffix(dueAt, "T00:00:00Z")
+	}
+	return dueAt
+}
+
+// writeMarkdown writes a checklist with the subtasks indented under their
+// todos. Tags follow the title as #tag, with spaces turned into dashes,
+// and the due date as due:<date>. Descriptions are left out.
+func writeMarkdown(w io.Writer, todos []Todos) error {
+	present := map[string]bool{}
+	for _, todo := range todos {
+		present[todo.ID] = true
+	}
+	children := map[string][]Todos{}
+	for _, todo := range todos {
+		parent := todo.ParentID
+		if !present[parent] {
+			parent = ""
+		}
+		children[parent] = append(children[parent], todo)
+	}
+
+	var write func(parent string, depth int) error
+	write = func(parent string, depth int) error {
+		for _, todo := range children[parent] {
+			box := "[ ]"
+			if todo.Completed {
+				box = "[x]"
+			}
+			line := strings.Repeat("  ", depth) + "- " + box + " " + strings.ReplaceAll(todo.Title, "\n", " ")
+			for _, tag := range todo.Tags {
+				line += " #" + strings.Join(strings.Fields(tag), "-")
+			}
+			if todo.DueAt != "" {
+				line += " due:" + markdownDue(todo.DueAt)
+			}
+			_, err := io.WriteString(w, line+"\n")
+			if err != nil {
+				return err
+			}
+			err = write(todo.ID, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return write("", 0)
+}
+
+// icsPriorities maps priorities to the iCalendar PRIORITY, 1 the highest.
+var icsPriorities = map[string]int{"urgent": 1, "high": 3, "medium": 5, "low": 9}
+
+// icsTime converts an RFC 3339 time to an iCalendar UTC date-time.
+func icsTime(stamp string) string {
+	t, err := time.Parse(time.RFC3339, stamp)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icsText escapes a TEXT value.
+func icsText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// icsLine writes a content line, folded after 75 octets without splitting
+// a character, and ended with CRLF.
+func icsLine(w io.Writer, line string) error {
+	var b strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// The leading space of a continuation counts against the line
+		limit = 74
+	}
+	b.WriteString(line + "\r\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeICS writes a calendar with one VTODO per todo. A recurring todo
+// starts at its due date, as RRULE needs a DTSTART.
+func writeICS(w io.Writer, todos []Todos) error {
+	lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//shikang//aws-lambdas todo//EN"}
+	now := time.Now().UTC().Format("20060102T150405Z")
+	for _, todo := range todos {
+		lines = append(lines, "BEGIN:VTODO", "UID:"+todo.ID, "DTSTAMP:"+now, "SUMMARY:"+icsText(todo.Title))
+		if todo.Description != "" {
+			lines = append(lines, "DESCRIPTION:"+icsText(todo.Description))
+		}
+		if due := icsTime(todo.DueAt); due != "" {
+			if todo.Recurrence != "" {
+				lines = append(lines, "DTSTART:"+due, "RRULE:"+todo.Recurrence)
+			}
+			lines = append(lines, "DUE:"+due)
+		}
+		if todo.Completed {
+			lines = append(lines, "STATUS:COMPLETED")
+			if completed := icsTime(todo.CompletedAt); completed != "" {
+				lines = append(lines, "COMPLETED:"+completed)
+			}
+		} else {
+			lines = append(lines, "STATUS:NEEDS-ACTION")
+		}
+		if priority, ok := icsPriorities[todo.Priority]; ok {
+			lines = append(lines, "PRIORITY:"+strconv.Itoa(priority))
+		}
+		if len(todo.Tags) > 0 {
+			categories := []string{}
+			for _, tag := range todo.Tags {
+				categories = append(categories, icsText(tag))
+			}
+			lines = append(lines, "CATEGORIES:"+strings.Join(categories, ","))
+		}
+		if todo.ParentID != "" {
+			lines = append(lines, "RELATED-TO:"+todo.ParentID)
+		}
+		if created := icsTime(todo.CreatedAt); created != "" {
+			lines = append(lines, "CREATED:"+created)
+		}
+		if modified := icsTime(todo.UpdatedAt); modified != "" {
+			lines = append(lines, "LAST-MODIFIED:"+modified)
+		}
+		lines = append(lines, "END:VTODO")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		err := icsLine(w, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportFilename is the file an export of owner is saved as, stamped with
+// the day it was made.
+func exportFilename(format ExportFormat, now time.Time) string {
+	return "todos-" + now.UTC().Format("2006-01-02") + "." + format.Extension
+}
+
+// ExportTodos writes every live todo of owner, in order, in the format.
+// API Gateway takes the response in one piece, so the export is written
+// to a buffer, and one over maxExportSize answers 422 instead.
+func (h *Handler) ExportTodos(owner string, format ExportFormat) (events.APIGatewayProxyResponse, error) {
+	todos, _, err := h.Store.Query(TodoQuery{Owner: owner})
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	var body bytes.Buffer
+	err = format.Write(&body, todos)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	if body.Len() > maxExportSize {
+		return errorResponse(apierror.Unprocessable, ErrExportTooLarge)
+	}
+
+	apiResponse := GenerateResponse(body.String(), http.StatusOK)
+	apiResponse.Headers["Content-Type"] = format.ContentType + "; charset=utf-8"
+	apiResponse.Headers["Content-Disposition"] = `attachment; filename="` + exportFilename(format, time.Now()) + `"`
+	return apiResponse, nil
+}
+
+// HandleExportTodosRequest exports the todos of the caller in the format
+// named by ?format=, or else the one the Accept header prefers.
+func (h *Handler) HandleExportTodosRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "GET" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	var format ExportFormat
+	if name, ok := request.QueryStringParameters["format"]; ok && name != "" {
+		found := false
+		format, found = exportFormat(name)
+		if !found {
+			return errorResponse(apierror.ValidationFailed, ErrUnknownFormat)
+		}
+	} else {
+		accept, _ := getHeader(request, "Accept")
+		found := false
+		format, found = negotiateFormat(accept)
+		if !found {
+			return errorResponse(apierror.NotAcceptable, ErrNotAcceptable)
+		}
+	}
+
+	fmt.Println("[GET] Export todos as " + format.Name)
+	return h.ExportTodos(CallerID(request), format)
+}
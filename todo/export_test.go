@@ -0,0 +1,88 @@
+package todo
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := []struct {
+		accept string
+		format string
+	}{
+		{"", "json"},
+		{"*/*", "json"},
+		{"text/*", "csv"},
+		{"application/*", "json"},
+		{"text/markdown", "markdown"},
+		{"TEXT/CALENDAR; charset=utf-8", "ics"},
+		{"text/csv;q=0.5, text/markdown", "markdown"},
+		{"image/png, */*;q=0.1", "json"},
+		{"image/*", ""},
+		{"text/csv;q=0", ""},
+	}
+	for _, c := range cases {
+		format, ok := negotiateFormat(c.accept)
+		if ok != (c.format != "") || format.Name != c.format {
+			t.Errorf("%q: got %q %v, want %q", c.accept, format.Name, ok, c.format)
+		}
+	}
+}
+
+func TestExportTodos(t *testing.T) {
+	h := newTestHandler()
+	addTestTodo(t, h, "u1", "buy milk")
+
+	cases := []struct {
+		name        string
+		format      string
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"format", "markdown", "text/csv", http.StatusOK, "text/markdown"},
+		{"accept any text", "", "text/*", http.StatusOK, "text/csv"},
+		{"accept anything", "", "*/*", http.StatusOK, "application/json"},
+		{"unknown format", "pdf", "", http.StatusBadRequest, ""},
+		{"not acceptable", "", "image/*", http.StatusNotAcceptable, ""},
+	}
+	for _, c := range cases {
+		request := events.APIGatewayProxyRequest{HTTPMethod: "GET", Headers: map[string]string{"accept": c.accept}}
+		if c.format != "" {
+			request.QueryStringParameters = map[string]string{"format": c.format}
+		}
+		apiResponse, err := h.HandleExportTodosRequest(WithFakeClaims(request, "u1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if apiResponse.StatusCode != c.status {
+			t.Errorf("%s: got %d %s, want %d", c.name, apiResponse.StatusCode, apiResponse.Body, c.status)
+			continue
+		}
+		if c.status == http.StatusOK {
+			if !strings.HasPrefix(apiResponse.Headers["Content-Type"], c.contentType) || !strings.Contains(apiResponse.Body, "buy milk") {
+				t.Errorf("%s: got %s %s", c.name, apiResponse.Headers["Content-Type"], apiResponse.Body)
+			}
+		}
+	}
+}
+
+func TestExportTooLarge(t *testing.T) {
+	h := newTestHandler()
+	store := h.Store.(*MemoryStore)
+	description := strings.Repeat("x", 1<<20)
+	for i := 0; i < 6; i++ {
+		todo := newTodo(Todos{Owner: "u1", Title: "big", Description: description}, string(rune('a'+i)), time.Now())
+		if err := store.Put(todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	apiResponse, err := h.ExportTodos("u1", ExportFormats[0])
+	if err != nil || apiResponse.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("got %d %v, want 422", apiResponse.StatusCode, err)
+	}
+}
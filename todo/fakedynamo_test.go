@@ -0,0 +1,121 @@
+package todo
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// FakeDynamoDB is a DynamoDB client that fails the operations named in
+// Errors, by their API name such as "PutItem", with the error set for
+// them, so a DynamoStore can be run against DynamoDB failures without
+// DynamoDB. Other calls go to the wrapped client, or succeed with an empty
+// output when there is none. Calls lists the operations called.
+type FakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	Errors map[string]error
+	Calls  []string
+}
+
+// NewFakeDynamoDB returns a FakeDynamoDB over the client, which may be nil.
+func NewFakeDynamoDB(db dynamodbiface.DynamoDBAPI) *FakeDynamoDB {
+	return &FakeDynamoDB{DynamoDBAPI: db, Errors: map[string]error{}}
+}
+
+// AWSError returns the error the SDK reports for a request DynamoDB failed
+// with the code, with a request ID as DynamoDB sends one.
+func AWSError(code string, message string) error {
+	status := http.StatusBadRequest
+	if code == dynamodb.ErrCodeInternalServerError {
+		status = http.StatusInternalServerError
+	}
+	return awserr.NewRequestFailure(awserr.New(code, message, nil), status, "FAKE"+code)
+}
+
+// fail records the call and returns the error set for the operation.
+func (f *FakeDynamoDB) fail(op string) error {
+	f.Calls = append(f.Calls, op)
+	return f.Errors[op]
+}
+
+func (f *FakeDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	if err := f.fail("GetItem"); err != nil {
+		return nil, err
+	}
+	if f.DynamoDBAPI == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return f.DynamoDBAPI.GetItem(input)
+}
+
+func (f *FakeDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	if err := f.fail("PutItem"); err != nil {
+		return nil, err
+	}
+	if f.DynamoDBAPI == nil {
+		return &dynamodb.PutItemOutput{}, nil
+	}
+	return f.DynamoDBAPI.PutItem(input)
+}
+
+func (f *FakeDynamoDB) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	if err := f.fail("UpdateItem"); err != nil {
+		return nil, err
+	}
+	if f.DynamoDBAPI == nil {
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+	return f.DynamoDBAPI.UpdateItem(input)
+}
+
+func (f *FakeDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	if err := f.fail("DeleteItem"); err != nil {
+		return nil, err
+	}
+	if f.DynamoDBAPI == nil {
+		return &dynamodb.DeleteItemOutput{}, nil
+	}
+	return f.DynamoDBAPI.DeleteItem(input)
+}
+
+func (f *FakeDynamoDB) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	if err := f.fail("Query"); err != nil {
+		return nil, err
+	}
+	if f.DynamoDBAPI == nil {
+		return &dynamodb.QueryOutput{}, nil
+	}
+	return f.DynamoDBAPI.Query(input)
+}
+
+func (f *FakeDynamoDB) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	if err := f.fail("Scan"); err != nil {
+		return nil, err
+	}
+	if f.DynamoDBAPI == nil {
+		return &dynamodb.ScanOutput{}, nil
+	}
+	return f.DynamoDBAPI.Scan(input)
+}
+
+func (f *FakeDynamoDB) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := f.fail("BatchWriteItem"); err != nil {
+		return nil, err
+	}
+	if f.DynamoDBAPI == nil {
+		return &dynamodb.BatchWriteItemOutput{}, nil
+	}
+	return f.DynamoDBAPI.BatchWriteItem(input)
+}
+
+func (f *FakeDynamoDB) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := f.fail("TransactWriteItems"); err != nil {
+		return nil, err
+	}
+	if f.DynamoDBAPI == nil {
+		return &dynamodb.TransactWriteItemsOutput{}, nil
+	}
+	return f.DynamoDBAPI.TransactWriteItems(input)
+}
@@ -0,0 +1,518 @@
+package todo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// Filters are the ?filter= of GET /todos, a small query language such as
+//
+//	completed:false tag:work due<2026-11-01 priority>=high
+//	(tag:home OR tag:garden) -title:"lawn"
+//
+// Terms are field, operator and value. Terms next to each other must all
+// match; OR, NOT (or a leading -) and parentheses combine them otherwise,
+// NOT binding tightest and OR loosest. A filter is parsed into an AST of
+// Filter nodes, which DynamoStore compiles into a FilterExpression and
+// MemoryStore evaluates against its todos.
+const (
+	maxFilterLength = 1000
+	maxFilterTerms  = 20
+)
+
+// Filter is a node of a parsed filter.
+type Filter interface {
+	// Match evaluates the filter against a todo the way DynamoDB evaluates
+	// its condition: comparing a missing attribute is false.
+	Match(todo Todos) bool
+	// Condition is the filter as a DynamoDB condition.
+	Condition() expression.ConditionBuilder
+}
+
+// FilterError points at the token of a filter that could not be parsed.
+// Pos is the 1-based character position of Token in the filter.
+type FilterError struct {
+	Msg   string `json:"error"`
+	Token string `json:"token"`
+	Pos   int    `json:"position"`
+}
+
+func (e *FilterError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+	}
+	return fmt.Sprintf("%s at position %d: %q", e.Msg, e.Pos, e.Token)
+}
+
+// filterErrorResponse answers 400 with the error and where it is.
+func filterErrorResponse(err *FilterError) (events.APIGatewayProxyResponse, error) {
+	apiErr := apierror.New(apierror.ValidationFailed, err.Msg).With("token", err.Token).With("position", err.Pos)
+	apiErr.Err = err
+	return apierror.Response(apiErr, GenerateHeaders())
+}
+
+type filterAnd struct {
+	left, right Filter
+}
+
+func (f filterAnd) Match(todo Todos) bool {
+	return f.left.Match(todo) && f.right.Match(todo)
+}
+
+func (f filterAnd) Condition() expression.ConditionBuilder {
+	return expression.And(f.left.Condition(), f.right.Condition())
+}
+
+type filterOr struct {
+	left, right Filter
+}
+
+func (f filterOr) Match(todo Todos) bool {
+	return f.left.Match(todo) || f.right.Match(todo)
+}
+
+func (f filterOr) Condition() expression.ConditionBuilder {
+	return expression.Or(f.left.Condition(), f.right.Condition())
+}
+
+type filterNot struct {
+	filter Filter
+}
+
+func (f filterNot) Match(todo Todos) bool {
+	return !f.filter.Match(todo)
+}
+
+func (f filterNot) Condition() expression.ConditionBuilder {
+	return expression.Not(f.filter.Condition())
+}
+
+// filterTerm compares the attribute of a field. Comparisons are of
+// strings, as the attributes compared hold RFC 3339 times and the
+// priority operators are turned into a set of priorities. Op is one of
+// "=", "<", "<=", ">", ">=", "contains", "in" or "missing".
+type filterTerm struct {
+	attr   string
+	op     string
+	values []string
+}
+
+// field returns the attribute of the todo behind a term, and false when
+// the todo has no such attribute.
+func (f filterTerm) field(todo Todos) (string, bool) {
+	var val string
+	switch f.attr {
+	case "Completed":
+		val = strconv.FormatBool(todo.Completed)
+	case "Title":
+		val = todo.Title
+	case "Priority":
+		val = todo.Priority
+	case "DueAt":
+		val = todo.DueAt
+	case "CreatedAt":
+		val = todo.CreatedAt
+	case "UpdatedAt":
+		val = todo.UpdatedAt
+	case "ListId":
+		val = todo.ListID
+	case "ParentId":
+		val = todo.ParentID
+	}
+	return val, val != ""
+}
+
+func (f filterTerm) Match(todo Todos) bool {
+	if f.attr == "Tags" {
+		if f.op == "missing" {
+			return len(todo.Tags) == 0
+		}
+		for _, tag := range todo.Tags {
+			if tag == f.values[0] {
+				return true
+			}
+		}
+		return false
+	}
+
+	val, ok := f.field(todo)
+	if f.op == "missing" {
+		return !ok
+	}
+	if !ok {
+		return false
+	}
+	switch f.op {
+	case "=":
+		return val == f.values[0]
+	case "<":
+		return val < f.values[0]
+	case "<=":
+		return val <= f.values[0]
+	case ">":
+		return val > f.values[0]
+	case ">=":
+		return val >= f.values[0]
+	case "contains":
+		return strings.Contains(val, f.values[0])
+	case "in":
+		for _, v := range f.values {
+			if val == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f filterTerm) Condition() expression.ConditionBuilder {
+	name := expression.Name(f.attr)
+	switch f.op {
+	case "<":
+		return name.LessThan(expression.Value(f.values[0]))
+	case "<=":
+		return name.LessThanEqual(expression.Value(f.values[0]))
+	case ">":
+		return name.GreaterThan(expression.Value(f.values[0]))
+	case ">=":
+		return name.GreaterThanEqual(expression.Value(f.values[0]))
+	case "contains":
+		return expression.Contains(name, f.values[0])
+	case "missing":
+		return expression.AttributeNotExists(name)
+	case "in":
+		others := []expression.OperandBuilder{}
+		for _, v := range f.values[1:] {
+			others = append(others, expression.Value(v))
+		}
+		return name.In(expression.Value(f.values[0]), others...)
+	}
+	if f.attr == "Completed" {
+		completed, _ := strconv.ParseBool(f.values[0])
+		return name.Equal(expression.Value(completed))
+	}
+	return name.Equal(expression.Value(f.values[0]))
+}
+
+// filterToken is a token of a filter: a parenthesis, a keyword or a term,
+// which is split into field, operator and value.
+type filterToken struct {
+	text  string
+	pos   int
+	field string
+	op    string
+	value string
+	// valuePos is the position of the value within the filter
+	valuePos int
+}
+
+var filterOperators = []string{"<=", ">=", ":", "<", ">"}
+
+// lexFilter splits the filter into tokens. Values may be quoted with "
+// to hold spaces or parentheses.
+func lexFilter(s string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		if r == ' ' || r == '\t' || r == '\n' {
+			i++
+			continue
+		}
+		if r == '(' || r == ')' {
+			tokens = append(tokens, filterToken{text: string(r), pos: i + 1})
+			i++
+			continue
+		}
+		if r == '-' {
+			tokens = append(tokens, filterToken{text: "-", pos: i + 1})
+			i++
+			continue
+		}
+
+		start := i
+		quoted := false
+		for i < len(runes) {
+			r := runes[i]
+			if r == '"' {
+				quoted = !quoted
+			} else if !quoted && (r == ' ' || r == '\t' || r == '\n' || r == '(' || r == ')') {
+				break
+			}
+			i++
+		}
+		if quoted {
+			return nil, &FilterError{Msg: "Unterminated quote", Token: string(runes[start:i]), Pos: start + 1}
+		}
+
+		token := filterToken{text: string(runes[start:i]), pos: start + 1}
+		for _, op := range filterOperators {
+			n := strings.Index(token.text, op)
+			if n <= 0 || strings.Contains(token.text[:n], "\"") {
+				continue
+			}
+			if token.op == "" || n < len(token.field) || (n == len(token.field) && len(op) > len(token.op)) {
+				token.field = token.text[:n]
+				token.op = op
+			}
+		}
+		if token.op != "" {
+			value := token.text[len(token.field)+len(token.op):]
+			token.valuePos = token.pos + len([]rune(token.field+token.op))
+			if strings.HasPrefix(value, "\"") {
+				if len(value) < 2 || !strings.HasSuffix(value, "\"") || strings.Count(value, "\"") != 2 {
+					return nil, &FilterError{Msg: "Invalid quoted value", Token: value, Pos: token.valuePos}
+				}
+				value = value[1 : len(value)-1]
+			}
+			token.value = value
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// filterParser is a recursive descent parser of the grammar
+//
+//	or   = and { "OR" and }
+//	and  = not { ["AND"] not }
+//	not  = ("NOT" | "-") not | "(" or ")" | term
+type filterParser struct {
+	tokens []filterToken
+	next   int
+	terms  int
+	end    int
+}
+
+func (p *filterParser) peek() *filterToken {
+	if p.next < len(p.tokens) {
+		return &p.tokens[p.next]
+	}
+	return nil
+}
+
+func isKeyword(token *filterToken, keyword string) bool {
+	return token != nil && token.op == "" && strings.EqualFold(token.text, keyword)
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.peek(), "OR") {
+		p.next++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = filterOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token := p.peek()
+		if token == nil || token.text == ")" || isKeyword(token, "OR") {
+			return left, nil
+		}
+		if isKeyword(token, "AND") {
+			p.next++
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = filterAnd{left, right}
+	}
+}
+
+func (p *filterParser) parseNot() (Filter, error) {
+	token := p.peek()
+	if token == nil {
+		return nil, &FilterError{Msg: "Unexpected end of filter", Pos: p.end}
+	}
+	p.next++
+
+	if token.text == "-" || isKeyword(token, "NOT") {
+		filter, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{filter}, nil
+	}
+	if token.text == "(" {
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing := p.peek()
+		if closing == nil || closing.text != ")" {
+			return nil, &FilterError{Msg: "Missing closing parenthesis", Token: token.text, Pos: token.pos}
+		}
+		p.next++
+		return filter, nil
+	}
+	if token.text == ")" {
+		return nil, &FilterError{Msg: "Unexpected closing parenthesis", Token: token.text, Pos: token.pos}
+	}
+	if isKeyword(token, "AND") || isKeyword(token, "OR") {
+		return nil, &FilterError{Msg: "Expected a term", Token: token.text, Pos: token.pos}
+	}
+
+	p.terms++
+	if p.terms > maxFilterTerms {
+		return nil, &FilterError{Msg: fmt.Sprintf("More than %d terms", maxFilterTerms), Token: token.text, Pos: token.pos}
+	}
+	return parseTerm(*token)
+}
+
+// filterFields maps the fields of the language to their attributes.
+var filterFields = map[string]string{
+	"completed": "Completed",
+	"title":     "Title",
+	"tag":       "Tags",
+	"priority":  "Priority",
+	"due":       "DueAt",
+	"created":   "CreatedAt",
+	"updated":   "UpdatedAt",
+	"list":      "ListId",
+	"parent":    "ParentId",
+}
+
+func parseTerm(token filterToken) (Filter, error) {
+	if token.op == "" {
+		return nil, &FilterError{Msg: "Expected field:value", Token: token.text, Pos: token.pos}
+	}
+	attr, ok := filterFields[strings.ToLower(token.field)]
+	if !ok {
+		return nil, &FilterError{Msg: "Unknown field", Token: token.field, Pos: token.pos}
+	}
+	if token.value == "" {
+		return nil, &FilterError{Msg: "Missing value", Token: token.text, Pos: token.valuePos}
+	}
+	opError := &FilterError{Msg: "Operator not supported for " + token.field, Token: token.op, Pos: token.pos + len([]rune(token.field))}
+	valueError := func(msg string) error {
+		return &FilterError{Msg: msg, Token: token.value, Pos: token.valuePos}
+	}
+
+	// Absent optional attributes are asked for as none
+	if token.op == ":" && strings.EqualFold(token.value, "none") && attr != "Completed" && attr != "Title" {
+		return filterTerm{attr: attr, op: "missing", values: []string{""}}, nil
+	}
+
+	switch attr {
+	case "Completed":
+		if token.op != ":" {
+			return nil, opError
+		}
+		completed, err := strconv.ParseBool(token.value)
+		if err != nil {
+			return nil, valueError("Expected true or false")
+		}
+		return filterTerm{attr: attr, op: "=", values: []string{strconv.FormatBool(completed)}}, nil
+	case "Title":
+		if token.op != ":" {
+			return nil, opError
+		}
+		return filterTerm{attr: attr, op: "contains", values: []string{token.value}}, nil
+	case "Tags":
+		if token.op != ":" {
+			return nil, opError
+		}
+		return filterTerm{attr: attr, op: "contains", values: []string{strings.ToLower(strings.TrimSpace(token.value))}}, nil
+	case "ListId", "ParentId":
+		if token.op != ":" {
+			return nil, opError
+		}
+		return filterTerm{attr: attr, op: "=", values: []string{token.value}}, nil
+	case "Priority":
+		rank := PriorityRank(strings.ToLower(token.value))
+		if rank < 0 {
+			return nil, valueError("Expected one of " + strings.Join(Priorities, ", "))
+		}
+		values := []string{}
+		for i, priority := range Priorities {
+			if (token.op == ":" && i == rank) || (token.op == "<" && i < rank) || (token.op == "<=" && i <= rank) ||
+				(token.op == ">" && i > rank) || (token.op == ">=" && i >= rank) {
+				values = append(values, priority)
+			}
+		}
+		if len(values) == 0 {
+			return nil, valueError("No priority is " + token.op + " " + token.value)
+		}
+		return filterTerm{attr: attr, op: "in", values: values}, nil
+	default:
+		return parseTimeTerm(attr, token.op, token.value, valueError)
+	}
+}
+
+// parseTimeTerm compares a timestamp attribute with a date (a whole day in
+// UTC) or an RFC 3339 time.
+func parseTimeTerm(attr string, op string, value string, valueError func(string) error) (Filter, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		stamp := t.UTC().Format(time.RFC3339)
+		if op == ":" {
+			op = "="
+		}
+		return filterTerm{attr: attr, op: op, values: []string{stamp}}, nil
+	}
+
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, valueError("Expected a date (YYYY-MM-DD), an RFC 3339 time or none")
+	}
+	start := day.Format(time.RFC3339)
+	end := day.AddDate(0, 0, 1).Format(time.RFC3339)
+	switch op {
+	case ":":
+		return filterAnd{
+			filterTerm{attr: attr, op: ">=", values: []string{start}},
+			filterTerm{attr: attr, op: "<", values: []string{end}},
+		}, nil
+	case "<":
+		return filterTerm{attr: attr, op: "<", values: []string{start}}, nil
+	case "<=":
+		return filterTerm{attr: attr, op: "<", values: []string{end}}, nil
+	case ">":
+		return filterTerm{attr: attr, op: ">=", values: []string{end}}, nil
+	default:
+		return filterTerm{attr: attr, op: ">=", values: []string{start}}, nil
+	}
+}
+
+// ParseFilter parses a filter, returning a *FilterError pointing at the
+// offending token when it is invalid.
+func ParseFilter(s string) (Filter, error) {
+	if len(s) > maxFilterLength {
+		return nil, &FilterError{Msg: fmt.Sprintf("Filter longer than %d characters", maxFilterLength), Pos: maxFilterLength + 1}
+	}
+	tokens, err := lexFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, &FilterError{Msg: "Empty filter", Pos: 1}
+	}
+
+	p := &filterParser{tokens: tokens, end: len([]rune(s)) + 1}
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token != nil {
+		return nil, &FilterError{Msg: "Unexpected closing parenthesis", Token: token.text, Pos: token.pos}
+	}
+	return filter, nil
+}
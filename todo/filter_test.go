@@ -0,0 +1,60 @@
+package todo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFilterErrors(t *testing.T) {
+	cases := []struct {
+		filter string
+		msg    string
+		token  string
+		pos    int
+	}{
+		{"", "Empty filter", "", 1},
+		{"completed", "Expected field:value", "completed", 1},
+		{"color:red", "Unknown field", "color", 1},
+		{"tag:", "Missing value", "tag:", 5},
+		{"tag>work", "Operator not supported for tag", ">", 4},
+		{"completed:maybe", "Expected true or false", "maybe", 11},
+		{"priority:highest", "Expected one of " + strings.Join(Priorities, ", "), "highest", 10},
+		{"due<tomorrow", "Expected a date (YYYY-MM-DD), an RFC 3339 time or none", "tomorrow", 5},
+		{`title:"buy milk`, "Unterminated quote", `title:"buy milk`, 1},
+		{"(tag:work", "Missing closing parenthesis", "(", 1},
+		{"tag:work)", "Unexpected closing parenthesis", ")", 9},
+		{"tag:work OR", "Unexpected end of filter", "", 12},
+		{"NOT OR", "Expected a term", "OR", 5},
+	}
+	for _, c := range cases {
+		_, err := ParseFilter(c.filter)
+		filterErr, ok := err.(*FilterError)
+		if !ok {
+			t.Errorf("%q: got %v, want a FilterError", c.filter, err)
+			continue
+		}
+		if filterErr.Msg != c.msg || filterErr.Token != c.token || filterErr.Pos != c.pos {
+			t.Errorf("%q: got %q %q at %d, want %q %q at %d", c.filter, filterErr.Msg, filterErr.Token, filterErr.Pos, c.msg, c.token, c.pos)
+		}
+	}
+
+	if _, err := ParseFilter(strings.Repeat("x", maxFilterLength+1)); err == nil {
+		t.Error("a filter over the length limit was parsed")
+	}
+	if _, err := ParseFilter(strings.TrimSpace(strings.Repeat("tag:a ", maxFilterTerms+1))); err == nil {
+		t.Error("a filter over the term limit was parsed")
+	}
+}
+
+func TestParseFilterTagsIgnoreCase(t *testing.T) {
+	todo := Todos{Title: "a", Tags: []string{"work"}}
+	for _, filter := range []string{"tag:Work", `tag:" WORK "`} {
+		f, err := ParseFilter(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !f.Match(todo) {
+			t.Errorf("%s does not match the tag work", filter)
+		}
+	}
+}
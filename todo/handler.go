@@ -0,0 +1,746 @@
+package todo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	uuid "github.com/satori/go.uuid"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// Handler serves the todo API on top of a TodoStore, so the same handlers
+// run against DynamoDB in the lambdas and against a MemoryStore offline.
+type Handler struct {
+	Store TodoStore
+	// CursorSecret signs the pagination cursors handed out by GetTodos.
+	CursorSecret []byte
+	// TrashRetention is how long deleted todos stay restorable, 30 days
+	// when zero.
+	TrashRetention time.Duration
+	// Search indexes todos as they are written and answers ?q= searches.
+	// Without one todos are not indexed and searching is not enabled.
+	Search SearchIndex
+	// UndoWindow is how long the undo tokens handed out by writes stay
+	// valid, 5 minutes when zero. They are signed with CursorSecret.
+	UndoWindow time.Duration
+	// History answers the change history of a todo, which the stream
+	// consumer records. Without one the history is not enabled.
+	History HistoryStore
+	// IdempotencyTTL is how long the Idempotency-Key of a create is
+	// remembered, 24 hours when zero.
+	IdempotencyTTL time.Duration
+	// AllowAnonymous serves requests without an authorizer identity as the
+	// empty owner, which holds the todos created before todos had owners.
+	// Without it they answer 401.
+	AllowAnonymous bool
+}
+
+// parseRef reads the todo named by a delete request from its body, if any,
+// and takes the ID from the {id} path parameter when routed through one.
+func parseRef(request events.APIGatewayProxyRequest) (TodoRef, error) {
+	ref := TodoRef{}
+	if request.Body != "" {
+		err := json.Unmarshal([]byte(request.Body), &ref)
+		if err != nil {
+			return ref, err
+		}
+	}
+
+	if id, ok := request.PathParameters["id"]; ok {
+		ref.ID = id
+	}
+	return ref, nil
+}
+
+// ErrInvalidLimit is returned for a ?limit= that is not a positive number.
+var ErrInvalidLimit = errors.New("Invalid limit, expected a positive number")
+
+// queryLimit reads the ?limit= of a listing, fallback when there is none.
+func queryLimit(request events.APIGatewayProxyRequest, fallback int64) (int64, error) {
+	val, ok := request.QueryStringParameters["limit"]
+	if !ok {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || parsed <= 0 {
+		return 0, ErrInvalidLimit
+	}
+	return parsed, nil
+}
+
+// getHeader looks up a request header regardless of the case it was sent in.
+func getHeader(request events.APIGatewayProxyRequest, name string) (string, bool) {
+	for key, val := range request.Headers {
+		if strings.EqualFold(key, name) {
+			return val, true
+		}
+	}
+	return "", false
+}
+
+func etag(version int64) string {
+	return "\"" + strconv.FormatInt(version, 10) + "\""
+}
+
+// requestVersion returns the version a write expects the todo to be at,
+// from the If-Match header or else the version field of the body. A nil
+// version makes the write unconditional.
+func requestVersion(request events.APIGatewayProxyRequest, bodyVersion *int64) (*int64, error) {
+	match, ok := getHeader(request, "If-Match")
+	if !ok {
+		return bodyVersion, nil
+	}
+
+	match = strings.TrimSpace(match)
+	if match == "*" {
+		return nil, nil
+	}
+	match = strings.TrimPrefix(match, "W/")
+	version, err := strconv.ParseInt(strings.Trim(match, "\""), 10, 64)
+	if err != nil {
+		return nil, errors.New("Invalid If-Match header")
+	}
+	return &version, nil
+}
+
+// todoResponse returns the todo as the body, with its version as the ETag.
+func todoResponse(todo Todos, statusCode int) (events.APIGatewayProxyResponse, error) {
+	responseBody, err := json.Marshal(todo)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	apiResponse := GenerateResponse(string(responseBody), statusCode)
+	apiResponse.Headers["ETag"] = etag(todo.Version)
+	return apiResponse, nil
+}
+
+// conflictResponse answers a write that lost against another one under
+// the code, with the current todo in the envelope and its version as the
+// ETag.
+func conflictResponse(code apierror.Code, err error, current Todos) (events.APIGatewayProxyResponse, error) {
+	apiResponse, err := apierror.Response(apierror.Wrap(code, err).With("current", current), GenerateHeaders())
+	apiResponse.Headers["ETag"] = etag(current.Version)
+	return apiResponse, err
+}
+
+// successResponse is the body of a successful write, with the written item
+// and its version as the ETag.
+func successResponse(todo Todos) (events.APIGatewayProxyResponse, error) {
+	return successNextResponse(todo, nil)
+}
+
+// successNextResponse is successResponse for a write that may have started
+// the next occurrence of a recurring todo.
+func successNextResponse(todo Todos, next *Todos) (events.APIGatewayProxyResponse, error) {
+	responseBody, err := json.Marshal(SuccessJson{Success: true, Todo: &todo, Next: next})
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	apiResponse := GenerateResponse(string(responseBody), http.StatusOK)
+	apiResponse.Headers["ETag"] = etag(todo.Version)
+	return apiResponse, nil
+}
+
+// preconditionFailed answers a conditional write of owner to a live todo
+// that lost against another one: 412 with the current item, or 404 if the
+// item is gone, trashed or belongs to someone else.
+func (h *Handler) preconditionFailed(owner string, id string, title string) (events.APIGatewayProxyResponse, error) {
+	return h.writeLost(owner, id, title, false)
+}
+
+// writeLost is preconditionFailed for a write to a trashed todo when
+// trashed is set.
+func (h *Handler) writeLost(owner string, id string, title string, trashed bool) (events.APIGatewayProxyResponse, error) {
+	current, err := h.Store.Get(id, title)
+	if err == nil && (current.Owner != owner || (current.DeletedAt != "") != trashed) {
+		err = ErrNotFound
+	}
+	if err == ErrNotFound {
+		return errorResponse(apierror.NotFound, err)
+	} else if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	return conflictResponse(apierror.PreconditionFailed, ErrVersionMismatch, current)
+}
+
+// newTodo returns the todo as created under id at now, with the fields
+// managed by the server set and whatever the client sent for them dropped.
+func newTodo(todo Todos, id string, now time.Time) Todos {
+	stamp := now.UTC().Format(time.RFC3339)
+	todo.ID = id
+	todo.Version = 1
+	todo.CreatedAt = stamp
+	todo.UpdatedAt = stamp
+	todo.UpdatedBy = todo.Owner
+	todo.CompletedAt = ""
+	if todo.Completed {
+		todo.CompletedAt = stamp
+	}
+	todo.DeletedAt = ""
+	todo.ExpiresAt = 0
+	todo.Occurrence = 0
+	if todo.Recurrence != "" {
+		todo.Occurrence = 1
+	}
+	todo.NextID = ""
+	todo.Position = ""
+	todo.OwnerKey = ownerKey(todo.Owner)
+	todo.Status = statusKey(todo.Owner, todo.Completed)
+	todo.DueShard = ""
+	if !todo.Completed {
+		todo.DueShard = dueShard(todo.ID)
+	}
+	return todo
+}
+
+func (h *Handler) AddTodo(todo Todos) (events.APIGatewayProxyResponse, error) {
+	return h.addTodo(todo, nil)
+}
+
+// addTodo creates the todo, recording its response under the key of the
+// record when there is one.
+func (h *Handler) addTodo(todo Todos, record *IdempotencyRecord) (events.APIGatewayProxyResponse, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	idStr := id.String()
+	fmt.Println("New uuid: " + idStr)
+	todo = newTodo(todo, idStr, time.Now())
+
+	// New todos go to the end
+	todos := []Todos{todo}
+	err = h.appendPositions(todo.Owner, todos)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	todo = todos[0]
+
+	todoByte, err := json.Marshal(todo)
+	if err == nil {
+		fmt.Println(string(todoByte))
+	}
+
+	// The response is made up front, a retry under the same key replays it
+	apiResponse, err := todoResponse(todo, http.StatusOK)
+	apiResponse, err = h.withUndo(apiResponse, err, UndoAction{Op: undoRemove, Owner: todo.Owner, ID: todo.ID, Title: todo.Title, Version: todo.Version})
+	if err != nil {
+		return apiResponse, err
+	}
+
+	if record == nil {
+		err = h.Store.Put(todo)
+	} else {
+		now := time.Now()
+		record.TodoID = todo.ID
+		record.Status = apiResponse.StatusCode
+		record.Body = apiResponse.Body
+		record.Headers = map[string]string{}
+		for _, name := range []string{"ETag", "Undo-Token"} {
+			if value, ok := apiResponse.Headers[name]; ok {
+				record.Headers[name] = value
+			}
+		}
+		record.CreatedAt = now.UTC().Format(time.RFC3339)
+		record.ExpiresAt = now.Add(h.idempotencyTTL()).Unix()
+		err = h.Store.PutKeyed(todo, *record)
+		if err == ErrKeyUsed {
+			var replayed events.APIGatewayProxyResponse
+			var found bool
+			replayed, found, err = h.replayKey(record.Key, record.RequestHash)
+			if found {
+				return replayed, err
+			}
+			// The key was taken but its record is gone again, the client can
+			// retry with it
+			return errorResponse(apierror.Conflict, ErrKeyUsed)
+		}
+	}
+	if err == ErrListNotFound {
+		// Deleted since it was checked
+		return listError(err)
+	} else if err != nil {
+		fmt.Println("Got error calling PutItem")
+		return errorResponse(apierror.Internal, err)
+	}
+	h.rollup(todo)
+	h.reindex(todo)
+
+	return apiResponse, nil
+}
+
+func (h *Handler) HandleAddTodoRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod == "POST" || request.HTTPMethod == "PUT" {
+		newTodo := Todos{}
+		err := json.Unmarshal([]byte(request.Body), &newTodo)
+		if err != nil {
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+
+		newTodo.Owner = CallerID(request)
+
+		// A retry under the same Idempotency-Key answers as the first try
+		key, keyed := getHeader(request, "Idempotency-Key")
+		hash := requestHash(request.Body)
+		if keyed {
+			if key == "" || len(key) > maxIdempotencyKeyLength {
+				return errorResponse(apierror.ValidationFailed, ErrInvalidIdempotencyKey)
+			}
+			key = idempotencyKey(newTodo.Owner, key)
+			apiResponse, found, err := h.replayKey(key, hash)
+			if found {
+				return apiResponse, err
+			}
+		}
+
+		if newTodo.Title != "" && newTodo.Title != "null" {
+			err := newTodo.validate()
+			if err != nil {
+				return errorResponse(apierror.ValidationFailed, err)
+			}
+
+			if newTodo.ListID != "" {
+				_, err := h.ownedList(newTodo.Owner, newTodo.ListID)
+				if err != nil {
+					return listError(err)
+				}
+			}
+			if newTodo.ParentID != "" {
+				err := h.checkParent(newTodo.Owner, newTodo.ParentID)
+				if err == ErrParentNotFound || err == ErrTooDeep {
+					return errorResponse(apierror.ValidationFailed, err)
+				} else if err != nil {
+					return errorResponse(apierror.Internal, err)
+				}
+			}
+
+			fmt.Println("Adding title: " + newTodo.Title)
+			if keyed {
+				return h.AddTodoOnce(newTodo, key, hash)
+			}
+			return h.AddTodo(newTodo)
+		} else {
+			err := errors.New("Adding Title not specified")
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+	} else {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+}
+
+func (h *Handler) GetTodosByID(owner string, val string, limit int64) ([]Todos, error) {
+	todos, _, err := h.Store.Query(TodoQuery{Owner: owner, ID: val, Limit: limit})
+	return todos, err
+}
+
+// todoByID looks up the todo with the ID for requests naming only the ID,
+// among the trashed todos of owner when deleted is set and the live ones
+// otherwise. It answers not found when owner has no such todo and a
+// conflict listing the titles when the ID is on more than one item, as
+// guessing one of them could act on the wrong todo.
+func (h *Handler) todoByID(owner string, id string, deleted bool) (Todos, error) {
+	todos, _, err := h.Store.Query(TodoQuery{Owner: owner, ID: id, Deleted: deleted, Limit: 2})
+	if err != nil {
+		return Todos{}, err
+	}
+	if len(todos) == 0 {
+		return Todos{}, apierror.Wrap(apierror.NotFound, ErrNotFound)
+	}
+	if len(todos) > 1 {
+		titles := []string{}
+		for _, todo := range todos {
+			titles = append(titles, todo.Title)
+		}
+		return Todos{}, apierror.Wrap(apierror.Conflict, ErrAmbiguousID).With("titles", titles)
+	}
+	return todos[0], nil
+}
+
+// titleOf is the Title of the live todo todoByID finds.
+func (h *Handler) titleOf(owner string, id string) (string, error) {
+	todo, err := h.todoByID(owner, id, false)
+	return todo.Title, err
+}
+
+func (h *Handler) GetTodosWithoutAnyFilters(query TodoQuery) ([]Todos, PageKey, error) {
+	return h.Store.Query(query)
+}
+
+func (h *Handler) GetTodosByCompleted(val bool, query TodoQuery) ([]Todos, PageKey, error) {
+	query.Completed = &val
+	return h.Store.Query(query)
+}
+
+// GetTodos applies the filter to the query, which carries the paging and
+// the trash selection of the request.
+func (h *Handler) GetTodos(filter string, val string, query TodoQuery) ([]Todos, PageKey, error) {
+	if val == "any" {
+		return h.GetTodosWithoutAnyFilters(query)
+	}
+
+	switch filter {
+	case "completed":
+		completed, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, nil, apierror.New(apierror.ValidationFailed, "Invalid completed filter")
+		}
+		return h.GetTodosByCompleted(completed, query)
+	default:
+		return nil, nil, apierror.New(apierror.ValidationFailed, "Invalid filter")
+	}
+}
+
+func (h *Handler) GetTodosResponse(filters string, val string, query TodoQuery) (events.APIGatewayProxyResponse, error) {
+	todos, next, err := h.GetTodos(filters, val, query)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	cursor, err := EncodeCursor(next, h.CursorSecret)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	responseBody, err := json.Marshal(TodosPage{Todos: todos, Next: cursor})
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	return GenerateResponse(string(responseBody), http.StatusOK), nil
+}
+
+// HandleGetTodosRequest lists a page of todos. Without a completed query
+// string every todo is listed, as GET /todos does not require one, and
+// ?deleted=true lists the trash instead. The next cursor of the response
+// is passed back as ?cursor= for the next page. Routed through
+// /lists/{id}/todos it lists the todos of that list only, and ?parentId=
+// lists the subtasks of a todo. ?q= searches the titles, tags and
+// descriptions instead, best matches first, within the same filters.
+// ?filter= narrows the todos down with the filter language of ParseFilter.
+func (h *Handler) HandleGetTodosRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod == "GET" {
+		completed, ok := request.QueryStringParameters["completed"]
+		if !ok {
+			completed = "any"
+		}
+
+		limit, err := queryLimit(request, 10)
+		if err != nil {
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+
+		query := TodoQuery{Owner: CallerID(request), Limit: limit}
+		if listID, ok := request.PathParameters["id"]; ok {
+			_, err := h.ownedList(query.Owner, listID)
+			if err != nil {
+				return listError(err)
+			}
+			query.ListID = listID
+		}
+		if parentID, ok := request.QueryStringParameters["parentId"]; ok {
+			query.ParentID = parentID
+		}
+		if cursor, ok := request.QueryStringParameters["cursor"]; ok && cursor != "" {
+			key, err := DecodeCursor(cursor, h.CursorSecret)
+			if err != nil {
+				return errorResponse(apierror.ValidationFailed, err)
+			}
+			query.StartKey = key
+		}
+
+		if filter, ok := request.QueryStringParameters["filter"]; ok && strings.TrimSpace(filter) != "" {
+			parsed, err := ParseFilter(filter)
+			if ferr, ok := err.(*FilterError); ok {
+				return filterErrorResponse(ferr)
+			} else if err != nil {
+				return errorResponse(apierror.ValidationFailed, err)
+			}
+			query.Filter = parsed
+		}
+
+		if deleted, ok := request.QueryStringParameters["deleted"]; ok {
+			val, err := strconv.ParseBool(deleted)
+			if err != nil {
+				return errorResponse(apierror.ValidationFailed, errors.New("Invalid deleted filter"))
+			}
+			query.Deleted = val
+		}
+
+		if q, ok := request.QueryStringParameters["q"]; ok && strings.TrimSpace(q) != "" {
+			if query.Deleted {
+				err := errors.New("Search does not cover deleted todos")
+				return errorResponse(apierror.ValidationFailed, err)
+			}
+			if completed != "any" {
+				val, err := strconv.ParseBool(completed)
+				if err != nil {
+					return errorResponse(apierror.ValidationFailed, errors.New("Invalid completed filter"))
+				}
+				query.Completed = &val
+			}
+			fmt.Println("[GET] Search todos: " + q)
+			return h.SearchTodosResponse(q, query)
+		}
+
+		fmt.Print("[GET] Get todos with completed filter: " + completed)
+		return h.GetTodosResponse("completed", completed, query)
+	} else {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+}
+
+// HandleGetTodoRequest returns the todo named by the {id} path parameter.
+func (h *Handler) HandleGetTodoRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "GET" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	id := request.PathParameters["id"]
+	fmt.Print("[GET] Get todo: " + id)
+	todo, err := h.todoByID(CallerID(request), id, false)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	return todoResponse(todo, http.StatusOK)
+}
+
+// UpdateTodo applies the change to the todo. A change with a Version is
+// only written while the stored item is still at it. The todo is read
+// first for the undo token, which is only handed out when no other write
+// came in between. A change of the due date or recurrence is checked
+// against the todo it is merged with, and written at the version read.
+func (h *Handler) UpdateTodo(change TodoChange) (events.APIGatewayProxyResponse, error) {
+	before, beforeErr := h.Store.Get(change.ID, change.Title)
+	if change.DueAt != nil || change.Recurrence != nil {
+		if beforeErr != nil && beforeErr != ErrNotFound {
+			return errorResponse(apierror.Internal, beforeErr)
+		}
+		if beforeErr == nil && before.Owner == change.Owner {
+			err := change.apply(before).checkRecurrence()
+			if err != nil {
+				return errorResponse(apierror.ValidationFailed, err)
+			}
+			if change.Version == nil {
+				change.Version = &before.Version
+			}
+		}
+	}
+	updated, err := h.Store.Update(change)
+	if err == ErrNotFound {
+		return errorResponse(apierror.NotFound, err)
+	} else if err == ErrVersionMismatch {
+		return h.preconditionFailed(change.Owner, change.ID, change.Title)
+	} else if err != nil {
+		fmt.Println("Got error calling UpdateItem")
+		return errorResponse(apierror.Internal, err)
+	}
+	written := updated.Version
+
+	if change.AutoComplete != nil && *change.AutoComplete {
+		completed, changed, err := h.completeFromChildren(updated, nil)
+		if err != nil {
+			fmt.Println("Got error auto-completing " + updated.ID + ": " + err.Error())
+		}
+		if changed {
+			updated = completed
+			h.rollup(updated)
+		}
+	}
+	if change.Completed != nil {
+		h.rollup(updated)
+	}
+	if change.Description != nil || change.Tags != nil {
+		h.reindex(updated)
+	}
+	var next *Todos
+	if change.Completed != nil && *change.Completed {
+		updated, next = h.recur(updated)
+	}
+
+	apiResponse, err := successNextResponse(updated, next)
+	if beforeErr != nil || written != before.Version+1 {
+		return apiResponse, err
+	}
+	return h.withUndo(apiResponse, err, revertAction(before, updated, next))
+}
+
+// RenameTodo moves the todo to update.NewTitle, applying the other changes
+// of the same request to the renamed item. The move is conditioned on the
+// version read here, so a concurrent write is never lost.
+func (h *Handler) RenameTodo(update TodoUpdate) (events.APIGatewayProxyResponse, error) {
+	current, err := h.Store.Get(update.ID, update.Title)
+	if err == nil && (current.Owner != update.Owner || current.DeletedAt != "") {
+		err = ErrNotFound
+	}
+	if err == ErrNotFound {
+		return errorResponse(apierror.NotFound, err)
+	} else if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	if update.Version != nil && *update.Version != current.Version {
+		return conflictResponse(apierror.PreconditionFailed, ErrVersionMismatch, current)
+	}
+
+	renamed := update.change(time.Now().UTC().Format(time.RFC3339)).apply(current)
+	renamed.Title = update.NewTitle
+	err = renamed.checkRecurrence()
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+
+	err = h.Store.Rename(update.Title, renamed, &current.Version)
+	if err == ErrNotFound {
+		return errorResponse(apierror.NotFound, err)
+	} else if err == ErrVersionMismatch {
+		return h.preconditionFailed(update.Owner, update.ID, update.Title)
+	} else if err == ErrTitleExists {
+		return errorResponse(apierror.Conflict, err)
+	} else if err != nil {
+		fmt.Println("Got error calling TransactWriteItems")
+		return errorResponse(apierror.Internal, err)
+	}
+	h.reindex(renamed)
+	var next *Todos
+	if update.Completed != nil {
+		h.rollup(renamed)
+		if *update.Completed {
+			renamed, next = h.recur(renamed)
+		}
+	}
+
+	apiResponse, err := successNextResponse(renamed, next)
+	return h.withUndo(apiResponse, err, revertAction(current, renamed, next))
+}
+
+func (h *Handler) HandleUpdateTodoRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod == "POST" || request.HTTPMethod == "PUT" || request.HTTPMethod == "PATCH" {
+		update := TodoUpdate{}
+		if request.Body != "" {
+			err := json.Unmarshal([]byte(request.Body), &update)
+			if err != nil {
+				return errorResponse(apierror.ValidationFailed, err)
+			}
+		}
+		if id, ok := request.PathParameters["id"]; ok {
+			update.ID = id
+		}
+		update.Owner = CallerID(request)
+
+		version, err := requestVersion(request, update.Version)
+		if err != nil {
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+		update.Version = version
+
+		err = update.validate()
+		if err != nil {
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+
+		if update.ID != "" && update.ID != "null" {
+			if update.Title == "" || update.Title == "null" {
+				title, err := h.titleOf(update.Owner, update.ID)
+				if err != nil {
+					return errorResponse(apierror.Internal, err)
+				}
+				update.Title = title
+			}
+
+			if update.NewTitle != "" && update.NewTitle != "null" && update.NewTitle != update.Title {
+				fmt.Println("Renaming: " + update.ID + " - " + update.Title + " to " + update.NewTitle)
+				return h.RenameTodo(update)
+			}
+
+			if update.empty() {
+				err := errors.New("Nothing to update")
+				return errorResponse(apierror.ValidationFailed, err)
+			}
+
+			fmt.Println("Updating: " + update.ID + " - " + update.Title)
+			return h.UpdateTodo(update.change(time.Now().UTC().Format(time.RFC3339)))
+		} else {
+			err := errors.New("ID not specified")
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+	} else {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+}
+
+// DeleteTodo moves the todo to the trash, from where it can be restored
+// until its TTL purges it. A non-nil version makes the delete conditional
+// on the stored item still being at it.
+func (h *Handler) DeleteTodo(ref TodoRef) (events.APIGatewayProxyResponse, error) {
+	now := time.Now().UTC()
+	change := TodoChange{
+		Owner:     ref.Owner,
+		ID:        ref.ID,
+		Title:     ref.Title,
+		UpdatedAt: now.Format(time.RFC3339),
+		Actor:     ref.Owner,
+		DeletedAt: now.Format(time.RFC3339),
+		ExpiresAt: now.Add(h.trashRetention()).Unix(),
+		Version:   ref.Version,
+	}
+
+	trashed, err := h.Store.Update(change)
+	if err == ErrNotFound {
+		return errorResponse(apierror.NotFound, err)
+	} else if err == ErrVersionMismatch {
+		return h.preconditionFailed(ref.Owner, ref.ID, ref.Title)
+	} else if err != nil {
+		fmt.Println("Got error calling UpdateItem")
+		return errorResponse(apierror.Internal, err)
+	}
+	h.trashDescendants(trashed)
+	h.rollup(trashed)
+	h.reindex(trashed)
+
+	apiResponse, err := successResponse(trashed)
+	return h.withUndo(apiResponse, err, UndoAction{Op: undoRestore, Owner: trashed.Owner, ID: trashed.ID, Title: trashed.Title, Version: trashed.Version})
+}
+
+func (h *Handler) HandleDeleteTodoRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod == "POST" || request.HTTPMethod == "DELETE" {
+		delTodo, err := parseRef(request)
+		if err != nil {
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+		delTodo.Owner = CallerID(request)
+
+		version, err := requestVersion(request, delTodo.Version)
+		if err != nil {
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+		delTodo.Version = version
+
+		if delTodo.ID != "" && delTodo.ID != "null" {
+			if delTodo.Title == "" || delTodo.Title == "null" {
+				title, err := h.titleOf(delTodo.Owner, delTodo.ID)
+				if err != nil {
+					return errorResponse(apierror.Internal, err)
+				}
+				delTodo.Title = title
+			}
+
+			fmt.Println("Deleting: " + delTodo.ID + " - " + delTodo.Title)
+			return h.DeleteTodo(delTodo)
+		} else {
+			err := errors.New("Deleting ID not specified")
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+	} else {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+}
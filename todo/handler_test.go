@@ -0,0 +1,541 @@
+package todo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func newTestHandler() *Handler {
+	return &Handler{Store: NewMemoryStore(), CursorSecret: []byte("secret")}
+}
+
+// call runs fn as owner, with the id as the {id} path parameter when it is
+// set, and returns the status and body it answered with.
+func call(t *testing.T, fn HandlerFunc, method string, owner string, id string, body string) (int, string) {
+	t.Helper()
+	request := events.APIGatewayProxyRequest{HTTPMethod: method, Body: body, Headers: map[string]string{}}
+	if id != "" {
+		request.PathParameters = map[string]string{"id": id}
+	}
+	apiResponse, err := fn(WithFakeClaims(request, owner))
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, id, err)
+	}
+	return apiResponse.StatusCode, apiResponse.Body
+}
+
+func addTestTodo(t *testing.T, h *Handler, owner string, title string) Todos {
+	t.Helper()
+	body, _ := json.Marshal(Todos{Title: title})
+	status, responseBody := call(t, h.HandleAddTodoRequest, "POST", owner, "", string(body))
+	if status != http.StatusOK {
+		t.Fatalf("adding %q: got %d %s", title, status, responseBody)
+	}
+	todo := Todos{}
+	if err := json.Unmarshal([]byte(responseBody), &todo); err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+// writtenTodo reads the todo of a write response.
+func writtenTodo(t *testing.T, body string) Todos {
+	t.Helper()
+	success := SuccessJson{}
+	if err := json.Unmarshal([]byte(body), &success); err != nil || success.Todo == nil {
+		t.Fatalf("not a write response: %s", body)
+	}
+	return *success.Todo
+}
+
+func TestAddTodo(t *testing.T) {
+	h := newTestHandler()
+	todo := addTestTodo(t, h, "u1", "buy milk")
+	if todo.ID == "" || todo.Title != "buy milk" || todo.Completed || todo.Version != 1 {
+		t.Errorf("got %+v", todo)
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"no title", "POST", `{"completed": true}`, http.StatusBadRequest},
+		{"not json", "POST", `{"title":`, http.StatusBadRequest},
+		{"wrong method", "GET", `{"title": "x"}`, http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		if status, body := call(t, h.HandleAddTodoRequest, c.method, "u1", "", c.body); status != c.status {
+			t.Errorf("%s: got %d %s, want %d", c.name, status, body, c.status)
+		}
+	}
+}
+
+func TestGetTodo(t *testing.T) {
+	h := newTestHandler()
+	todo := addTestTodo(t, h, "u1", "buy milk")
+
+	cases := []struct {
+		name   string
+		owner  string
+		id     string
+		status int
+	}{
+		{"own todo", "u1", todo.ID, http.StatusOK},
+		{"other owner", "u2", todo.ID, http.StatusNotFound},
+		{"missing", "u1", "nope", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		status, body := call(t, h.HandleGetTodoRequest, "GET", c.owner, c.id, "")
+		if status != c.status {
+			t.Errorf("%s: got %d %s, want %d", c.name, status, body, c.status)
+		}
+	}
+}
+
+func TestUpdateTodo(t *testing.T) {
+	h := newTestHandler()
+	todo := addTestTodo(t, h, "u1", "buy milk")
+
+	status, body := call(t, h.HandleUpdateTodoRequest, "PATCH", "u1", todo.ID, `{"completed": true}`)
+	if status != http.StatusOK {
+		t.Fatalf("got %d %s", status, body)
+	}
+	updated := writtenTodo(t, body)
+	if !updated.Completed || updated.CompletedAt == "" || updated.Version != 2 {
+		t.Errorf("got %+v", updated)
+	}
+
+	cases := []struct {
+		name   string
+		owner  string
+		id     string
+		body   string
+		status int
+	}{
+		{"nothing to update", "u1", todo.ID, `{}`, http.StatusBadRequest},
+		{"other owner", "u2", todo.ID, `{"completed": false}`, http.StatusNotFound},
+		{"missing", "u1", "nope", `{"completed": false}`, http.StatusNotFound},
+		{"missing title", "u1", todo.ID, `{"title": "nope", "completed": false}`, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		status, body := call(t, h.HandleUpdateTodoRequest, "PATCH", c.owner, c.id, c.body)
+		if status != c.status {
+			t.Errorf("%s: got %d %s, want %d", c.name, status, body, c.status)
+		}
+	}
+}
+
+func TestFieldLimits(t *testing.T) {
+	tags := func(n int) []string {
+		tags := []string{}
+		for i := 0; i < n; i++ {
+			tags = append(tags, fmt.Sprintf("tag%02d", i))
+		}
+		return tags
+	}
+
+	cases := []struct {
+		name   string
+		field  string
+		value  interface{}
+		status int
+		want   interface{}
+	}{
+		{"longest description", "description", strings.Repeat("a", maxDescriptionLength), http.StatusOK, strings.Repeat("a", maxDescriptionLength)},
+		{"description too long", "description", strings.Repeat("a", maxDescriptionLength+1), http.StatusBadRequest, nil},
+		{"most tags", "tags", tags(maxTags), http.StatusOK, tags(maxTags)},
+		{"too many tags", "tags", tags(maxTags + 1), http.StatusBadRequest, nil},
+		{"duplicates count once", "tags", append(tags(maxTags), "TAG00 "), http.StatusOK, tags(maxTags)},
+		{"longest tag", "tags", []string{strings.Repeat("t", maxTagLength)}, http.StatusOK, []string{strings.Repeat("t", maxTagLength)}},
+		{"tag too long", "tags", []string{strings.Repeat("t", maxTagLength+1)}, http.StatusBadRequest, nil},
+		{"empty tag", "tags", []string{" "}, http.StatusBadRequest, nil},
+		{"tags normalized", "tags", []string{"Work", " home", "work"}, http.StatusOK, []string{"home", "work"}},
+		{"due date in UTC", "dueAt", "2026-03-01T10:00:00+02:00", http.StatusOK, "2026-03-01T08:00:00Z"},
+		{"due date not RFC 3339", "dueAt", "2026-03-01", http.StatusBadRequest, nil},
+		{"priority", "priority", "urgent", http.StatusOK, "urgent"},
+		{"unknown priority", "priority", "whenever", http.StatusBadRequest, nil},
+		{"time zone", "timeZone", "Europe/Berlin", http.StatusOK, "Europe/Berlin"},
+		{"unknown time zone", "timeZone", "Mars/Olympus", http.StatusBadRequest, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := newTestHandler()
+			existing := addTestTodo(t, h, "u1", "walk dog")
+			add, _ := json.Marshal(map[string]interface{}{"title": "buy milk", c.field: c.value})
+			update, _ := json.Marshal(map[string]interface{}{c.field: c.value})
+
+			for _, write := range []struct {
+				name   string
+				fn     HandlerFunc
+				method string
+				id     string
+				body   []byte
+			}{
+				{"add", h.HandleAddTodoRequest, "POST", "", add},
+				{"update", h.HandleUpdateTodoRequest, "PATCH", existing.ID, update},
+			} {
+				status, body := call(t, write.fn, write.method, "u1", write.id, string(write.body))
+				if status != c.status {
+					t.Fatalf("%s: got %d %s, want %d", write.name, status, body, c.status)
+				}
+				if status != http.StatusOK {
+					continue
+				}
+
+				written := map[string]interface{}{}
+				if err := json.Unmarshal([]byte(body), &written); err != nil {
+					t.Fatal(err)
+				}
+				if todo, ok := written["todo"].(map[string]interface{}); ok {
+					written = todo
+				}
+				want, _ := json.Marshal(c.want)
+				got, _ := json.Marshal(written[c.field])
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got %s %s, want %s", write.name, c.field, got, want)
+				}
+			}
+		})
+	}
+}
+
+// addSubtask adds a todo of u1 under the parent, or at the top when
+// parentID is empty.
+func addSubtask(t *testing.T, h *Handler, title string, parentID string, autoComplete bool) Todos {
+	t.Helper()
+	body, _ := json.Marshal(Todos{Title: title, ParentID: parentID, AutoComplete: autoComplete})
+	status, responseBody := call(t, h.HandleAddTodoRequest, "POST", "u1", "", string(body))
+	if status != http.StatusOK {
+		t.Fatalf("adding %q: got %d %s", title, status, responseBody)
+	}
+	todo := Todos{}
+	if err := json.Unmarshal([]byte(responseBody), &todo); err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+func TestSubtaskDepth(t *testing.T) {
+	h := newTestHandler()
+	chain := []Todos{addSubtask(t, h, "level 0", "", false)}
+	for depth := 1; depth < maxTodoDepth; depth++ {
+		chain = append(chain, addSubtask(t, h, fmt.Sprintf("level %d", depth), chain[depth-1].ID, false))
+	}
+	trashed := addTestTodo(t, h, "u1", "trashed")
+	if status, body := call(t, h.HandleDeleteTodoRequest, "DELETE", "u1", trashed.ID, ""); status != http.StatusOK {
+		t.Fatalf("got %d %s", status, body)
+	}
+	foreign := addTestTodo(t, h, "u2", "theirs")
+
+	cases := []struct {
+		name     string
+		parentID string
+		status   int
+	}{
+		{"under the top", chain[0].ID, http.StatusOK},
+		{"under the second deepest", chain[maxTodoDepth-2].ID, http.StatusOK},
+		{"under the deepest", chain[maxTodoDepth-1].ID, http.StatusBadRequest},
+		{"missing parent", "nope", http.StatusBadRequest},
+		{"trashed parent", trashed.ID, http.StatusBadRequest},
+		{"foreign parent", foreign.ID, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			body, _ := json.Marshal(Todos{Title: "sub", ParentID: c.parentID})
+			if status, responseBody := call(t, h.HandleAddTodoRequest, "POST", "u1", "", string(body)); status != c.status {
+				t.Errorf("got %d %s, want %d", status, responseBody, c.status)
+			}
+		})
+	}
+}
+
+func TestSubtaskRollup(t *testing.T) {
+	h := newTestHandler()
+	root := addSubtask(t, h, "move house", "", true)
+	parent := addSubtask(t, h, "pack", root.ID, true)
+	books := addSubtask(t, h, "books", parent.ID, false)
+	plates := addSubtask(t, h, "plates", parent.ID, false)
+	manual := addSubtask(t, h, "call movers", "", false)
+	under := addSubtask(t, h, "book van", manual.ID, false)
+
+	write := func(t *testing.T, fn HandlerFunc, method string, id string, body string) {
+		t.Helper()
+		if status, responseBody := call(t, fn, method, "u1", id, body); status != http.StatusOK {
+			t.Fatalf("%s %s: got %d %s", method, id, status, responseBody)
+		}
+	}
+	var added Todos
+	steps := []struct {
+		name   string
+		do     func(t *testing.T)
+		parent bool
+		root   bool
+	}{
+		{"one of two done", func(t *testing.T) { write(t, h.HandleUpdateTodoRequest, "PATCH", books.ID, `{"completed": true}`) }, false, false},
+		{"all done", func(t *testing.T) { write(t, h.HandleUpdateTodoRequest, "PATCH", plates.ID, `{"completed": true}`) }, true, true},
+		{"open subtask added", func(t *testing.T) { added = addSubtask(t, h, "mugs", parent.ID, false) }, false, false},
+		{"open subtask trashed", func(t *testing.T) { write(t, h.HandleDeleteTodoRequest, "DELETE", added.ID, "") }, true, true},
+		{"done subtask reopened", func(t *testing.T) { write(t, h.HandleUpdateTodoRequest, "PATCH", books.ID, `{"completed": false}`) }, false, false},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			step.do(t)
+			for _, want := range []struct {
+				todo      Todos
+				completed bool
+			}{{parent, step.parent}, {root, step.root}} {
+				stored, err := h.Store.Get(want.todo.ID, want.todo.Title)
+				if err != nil || stored.Completed != want.completed {
+					t.Errorf("%s: got completed %v (%v), want %v", want.todo.Title, stored.Completed, err, want.completed)
+				}
+			}
+		})
+	}
+
+	// Without AutoComplete a parent is left alone
+	write(t, h.HandleUpdateTodoRequest, "PATCH", under.ID, `{"completed": true}`)
+	if stored, _ := h.Store.Get(manual.ID, manual.Title); stored.Completed {
+		t.Errorf("got %+v, want a parent without autoComplete left open", stored)
+	}
+}
+
+func TestDeleteTodo(t *testing.T) {
+	h := newTestHandler()
+	todo := addTestTodo(t, h, "u1", "buy milk")
+
+	if status, body := call(t, h.HandleDeleteTodoRequest, "DELETE", "u2", todo.ID, ""); status != http.StatusNotFound {
+		t.Errorf("other owner: got %d %s, want 404", status, body)
+	}
+	status, body := call(t, h.HandleDeleteTodoRequest, "DELETE", "u1", todo.ID, "")
+	if status != http.StatusOK {
+		t.Fatalf("got %d %s", status, body)
+	}
+	if deleted := writtenTodo(t, body); deleted.DeletedAt == "" {
+		t.Errorf("got %+v, want it in the trash", deleted)
+	}
+	if status, _ := call(t, h.HandleGetTodoRequest, "GET", "u1", todo.ID, ""); status != http.StatusNotFound {
+		t.Errorf("deleted todo: got %d, want 404", status)
+	}
+	if status, _ := call(t, h.HandleDeleteTodoRequest, "DELETE", "u1", "nope", ""); status != http.StatusNotFound {
+		t.Errorf("missing: got %d, want 404", status)
+	}
+}
+
+func TestAmbiguousAndMissingIDs(t *testing.T) {
+	h := newTestHandler()
+	store := h.Store.(*MemoryStore)
+	trashedAt := time.Now().UTC().Format(time.RFC3339)
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	for _, todo := range []Todos{
+		{ID: "twice", Title: "one", Owner: "u1", Position: "a0"},
+		{ID: "twice", Title: "two", Owner: "u1", Position: "a1"},
+		{ID: "solo", Title: "three", Owner: "u1", Position: "a2"},
+		{ID: "trashed", Title: "one", Owner: "u1", DeletedAt: trashedAt, ExpiresAt: expiresAt},
+		{ID: "trashed", Title: "two", Owner: "u1", DeletedAt: trashedAt, ExpiresAt: expiresAt},
+	} {
+		if err := store.Put(todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name   string
+		fn     HandlerFunc
+		method string
+		twice  string
+		body   string
+	}{
+		{"get", h.HandleGetTodoRequest, "GET", "twice", ""},
+		{"subtree", h.HandleGetSubtreeRequest, "GET", "twice", ""},
+		{"update", h.HandleUpdateTodoRequest, "PATCH", "twice", `{"completed": true}`},
+		{"delete", h.HandleDeleteTodoRequest, "DELETE", "twice", ""},
+		{"move", h.HandleMoveTodoRequest, "POST", "twice", `{"listId": ""}`},
+		{"skip", h.HandleSkipTodoRequest, "POST", "twice", ""},
+		{"reorder", h.HandleReorderTodoRequest, "POST", "twice", `{"before": "solo"}`},
+		{"restore", h.HandleRestoreTodoRequest, "POST", "trashed", ""},
+	}
+	for _, c := range cases {
+		status, body := call(t, c.fn, c.method, "u1", c.twice, c.body)
+		envelope := struct {
+			Titles []string `json:"titles"`
+		}{}
+		json.Unmarshal([]byte(body), &envelope)
+		if status != http.StatusConflict || len(envelope.Titles) != 2 {
+			t.Errorf("%s of an ambiguous ID: got %d %s, want 409 with both titles", c.name, status, body)
+		}
+		if status, body := call(t, c.fn, c.method, "u1", "missing", c.body); status != http.StatusNotFound {
+			t.Errorf("%s of a missing ID: got %d %s, want 404", c.name, status, body)
+		}
+	}
+
+	status, body := call(t, h.HandleReorderTodoRequest, "POST", "u1", "solo", `{"after": "twice"}`)
+	if status != http.StatusConflict {
+		t.Errorf("reorder after an ambiguous ID: got %d %s, want 409", status, body)
+	}
+
+	status, body = call(t, h.HandleBatchTodosRequest, "POST", "u1", "",
+		`{"operations": [{"op": "complete", "id": "twice", "completed": true}, {"op": "delete", "id": "missing"}]}`)
+	batch := BatchResponse{}
+	if err := json.Unmarshal([]byte(body), &batch); err != nil || status != http.StatusOK {
+		t.Fatalf("batch: got %d %s", status, body)
+	}
+	if batch.Results[0].Status != http.StatusConflict || batch.Results[1].Status != http.StatusNotFound {
+		t.Errorf("batch: got %+v, want 409 and 404", batch.Results)
+	}
+}
+
+func TestTrashedTodoTakesNoChanges(t *testing.T) {
+	h := newTestHandler()
+	todo := addTestTodo(t, h, "u1", "buy milk")
+	status, body := call(t, h.HandleDeleteTodoRequest, "DELETE", "u1", todo.ID, "")
+	if status != http.StatusOK {
+		t.Fatalf("got %d %s", status, body)
+	}
+	trashed := writtenTodo(t, body)
+
+	cases := []struct {
+		name   string
+		fn     HandlerFunc
+		method string
+		body   string
+	}{
+		{"update", h.HandleUpdateTodoRequest, "PATCH", `{"title": "buy milk", "completed": true}`},
+		{"delete", h.HandleDeleteTodoRequest, "DELETE", `{"title": "buy milk"}`},
+	}
+	for _, c := range cases {
+		if status, body := call(t, c.fn, c.method, "u1", todo.ID, c.body); status != http.StatusNotFound {
+			t.Errorf("%s of a trashed todo: got %d %s, want 404", c.name, status, body)
+		}
+	}
+	stored, err := h.Store.Get(todo.ID, todo.Title)
+	if err != nil || stored.Completed || stored.DeletedAt != trashed.DeletedAt || stored.Version != trashed.Version {
+		t.Errorf("got %+v %v, want it untouched in the trash", stored, err)
+	}
+
+	if status, body := call(t, h.HandleRestoreTodoRequest, "POST", "u1", todo.ID, ""); status != http.StatusOK {
+		t.Errorf("restore: got %d %s", status, body)
+	}
+}
+
+func TestRenameTodo(t *testing.T) {
+	h := newTestHandler()
+	store := h.Store.(*MemoryStore)
+	for _, todo := range []Todos{
+		{ID: "1", Title: "one", Owner: "u1", Version: 1},
+		{ID: "1", Title: "two", Owner: "u1", Version: 1},
+	} {
+		if err := store.Put(todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name   string
+		owner  string
+		body   string
+		status int
+	}{
+		{"onto another title of the ID", "u1", `{"title": "one", "newTitle": "two"}`, http.StatusConflict},
+		{"other owner", "u2", `{"title": "one", "newTitle": "three"}`, http.StatusNotFound},
+		{"missing title", "u1", `{"title": "nope", "newTitle": "three"}`, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		if status, body := call(t, h.HandleUpdateTodoRequest, "PATCH", c.owner, "1", c.body); status != c.status {
+			t.Errorf("%s: got %d %s, want %d", c.name, status, body, c.status)
+		}
+	}
+	for _, title := range []string{"one", "two"} {
+		if todo, err := store.Get("1", title); err != nil || todo.Version != 1 {
+			t.Errorf("%s: got %+v %v, want it untouched", title, todo, err)
+		}
+	}
+
+	status, body := call(t, h.HandleUpdateTodoRequest, "PATCH", "u1", "1", `{"title": "one", "newTitle": "three", "completed": true}`)
+	if status != http.StatusOK {
+		t.Fatalf("got %d %s", status, body)
+	}
+	if renamed := writtenTodo(t, body); renamed.Title != "three" || !renamed.Completed || renamed.Version != 2 {
+		t.Errorf("got %+v", renamed)
+	}
+	if _, err := store.Get("1", "one"); err != ErrNotFound {
+		t.Errorf("got %v, want the old title gone", err)
+	}
+}
+
+// callIfMatch is call with an If-Match header, returning the response.
+func callIfMatch(t *testing.T, fn HandlerFunc, method string, id string, match string, body string) events.APIGatewayProxyResponse {
+	t.Helper()
+	request := events.APIGatewayProxyRequest{
+		HTTPMethod:     method,
+		Body:           body,
+		Headers:        map[string]string{"If-Match": match},
+		PathParameters: map[string]string{"id": id},
+	}
+	apiResponse, err := fn(WithFakeClaims(request, "u1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return apiResponse
+}
+
+func TestIfMatch(t *testing.T) {
+	h := newTestHandler()
+	todo := addTestTodo(t, h, "u1", "buy milk")
+	status, _ := call(t, h.HandleUpdateTodoRequest, "PATCH", "u1", todo.ID, `{"completed": true}`)
+	if status != http.StatusOK {
+		t.Fatalf("got %d", status)
+	}
+
+	get := callIfMatch(t, h.HandleGetTodoRequest, "GET", todo.ID, "", "")
+	if get.Headers["ETag"] != `"2"` {
+		t.Errorf("got ETag %q, want \"2\"", get.Headers["ETag"])
+	}
+
+	cases := []struct {
+		name   string
+		fn     HandlerFunc
+		method string
+		match  string
+		body   string
+		status int
+	}{
+		{"stale update", h.HandleUpdateTodoRequest, "PATCH", `"1"`, `{"completed": false}`, http.StatusPreconditionFailed},
+		{"stale weak update", h.HandleUpdateTodoRequest, "PATCH", `W/"1"`, `{"completed": false}`, http.StatusPreconditionFailed},
+		{"stale rename", h.HandleUpdateTodoRequest, "PATCH", `"1"`, `{"newTitle": "buy oat milk"}`, http.StatusPreconditionFailed},
+		{"stale delete", h.HandleDeleteTodoRequest, "DELETE", `"1"`, "", http.StatusPreconditionFailed},
+		{"invalid", h.HandleUpdateTodoRequest, "PATCH", "abc", `{"completed": false}`, http.StatusBadRequest},
+		{"current update", h.HandleUpdateTodoRequest, "PATCH", `"2"`, `{"completed": false}`, http.StatusOK},
+		{"any version", h.HandleUpdateTodoRequest, "PATCH", "*", `{"completed": true}`, http.StatusOK},
+	}
+	for _, c := range cases {
+		apiResponse := callIfMatch(t, c.fn, c.method, todo.ID, c.match, c.body)
+		if apiResponse.StatusCode != c.status {
+			t.Errorf("%s: got %d %s, want %d", c.name, apiResponse.StatusCode, apiResponse.Body, c.status)
+			continue
+		}
+		if c.status != http.StatusPreconditionFailed {
+			continue
+		}
+		envelope := struct {
+			Current Todos `json:"current"`
+		}{}
+		json.Unmarshal([]byte(apiResponse.Body), &envelope)
+		if envelope.Current.Version != 2 || apiResponse.Headers["ETag"] != `"2"` {
+			t.Errorf("%s: got %s with ETag %q, want the current todo at version 2", c.name, apiResponse.Body, apiResponse.Headers["ETag"])
+		}
+	}
+
+	status, body := call(t, h.HandleUpdateTodoRequest, "PATCH", "u1", todo.ID, `{"version": 1, "completed": false}`)
+	if status != http.StatusPreconditionFailed {
+		t.Errorf("stale version in the body: got %d %s, want 412", status, body)
+	}
+}
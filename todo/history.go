@@ -0,0 +1,387 @@
+package todo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// HistoryTableName is the DynamoDB table holding the change history of the
+// todos, keyed by TodoId (hash) and EventKey (range).
+const HistoryTableName = "TodoHistory"
+
+// Actors of the writes no user made, as recorded in UpdatedBy.
+const (
+	ActorAutoComplete = "system:auto-complete"
+	ActorBackfill     = "system:backfill"
+	ActorRecurrence   = "system:recurrence"
+	ActorTTL          = "system:ttl"
+)
+
+// Kinds of history events.
+const (
+	EventCreated   = "created"
+	EventUpdated   = "updated"
+	EventCompleted = "completed"
+	EventReopened  = "reopened"
+	EventRenamed   = "renamed"
+	EventTrashed   = "trashed"
+	EventRestored  = "restored"
+	EventDeleted   = "deleted"
+	EventPurged    = "purged"
+)
+
+const defaultHistoryLimit = 50
+
+// ErrHistoryDisabled is returned for history requests when the handler
+// has no HistoryStore.
+var ErrHistoryDisabled = errors.New("History is not enabled")
+
+// TodoEvent is one entry of the change history of a todo: the item before
+// and after the write, the fields that changed and who changed them. Old
+// is nil for a created todo and New for a deleted or purged one. Key
+// orders the events of a todo by time and stream sequence.
+type TodoEvent struct {
+	TodoID  string   `json:"todoId" dynamodbav:"TodoId"`
+	Key     string   `json:"-" dynamodbav:"EventKey"`
+	Owner   string   `json:"-" dynamodbav:"Owner,omitempty"`
+	At      string   `json:"at" dynamodbav:"At"`
+	Kind    string   `json:"kind" dynamodbav:"Kind"`
+	Actor   string   `json:"actor,omitempty" dynamodbav:"Actor,omitempty"`
+	Changed []string `json:"changed,omitempty" dynamodbav:"Changed,omitempty"`
+	Old     *Todos   `json:"old,omitempty" dynamodbav:"Old,omitempty"`
+	New     *Todos   `json:"new,omitempty" dynamodbav:"New,omitempty"`
+}
+
+// TodoEventsPage is one page of the history of a todo, newest first. Next
+// is empty on the last page.
+type TodoEventsPage struct {
+	Events []TodoEvent `json:"events"`
+	Next   string      `json:"next,omitempty"`
+}
+
+// HistoryStore keeps the change history of the todos. It is append-only.
+type HistoryStore interface {
+	// Append records the event. Appending an event with a key that is
+	// already recorded does nothing, so a redelivered stream record is
+	// recorded once.
+	Append(event TodoEvent) error
+	// Events returns up to limit events of the todo belonging to owner,
+	// newest first, from startKey on.
+	Events(id string, owner string, limit int64, startKey PageKey) ([]TodoEvent, PageKey, error)
+}
+
+// StreamRecord is a write to the Todos table as its stream reports it:
+// the item before and after, either nil for an insert or a remove.
+// Expired marks a remove made by the TTL. Seq, a decimal number, orders
+// the records of an item written within the same second.
+type StreamRecord struct {
+	Old     *Todos
+	New     *Todos
+	Expired bool
+	At      time.Time
+	Seq     string
+}
+
+// eventKind tells what the write did to the todo. The insert of a renamed
+// todo carries on the version of the item it replaces.
+func eventKind(record StreamRecord) string {
+	old, updated := record.Old, record.New
+	switch {
+	case old == nil && updated.Version > 1:
+		return EventRenamed
+	case old == nil:
+		return EventCreated
+	case updated == nil && record.Expired:
+		return EventPurged
+	case updated == nil:
+		return EventDeleted
+	case old.Title != updated.Title:
+		return EventRenamed
+	case old.DeletedAt == "" && updated.DeletedAt != "":
+		return EventTrashed
+	case old.DeletedAt != "" && updated.DeletedAt == "":
+		return EventRestored
+	case !old.Completed && updated.Completed:
+		return EventCompleted
+	case old.Completed && !updated.Completed:
+		return EventReopened
+	}
+	return EventUpdated
+}
+
+// changedFields lists, by their json names, the fields of the todo that
+// differ between old and updated. The version and timestamp every write
+// bumps are left out.
+func changedFields(old *Todos, updated *Todos) ([]string, error) {
+	if old == nil || updated == nil {
+		return nil, nil
+	}
+	var before, after map[string]interface{}
+	for _, field := range []struct {
+		todo *Todos
+		into *map[string]interface{}
+	}{{old, &before}, {updated, &after}} {
+		data, err := json.Marshal(field.todo)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, field.into); err != nil {
+			return nil, err
+		}
+	}
+
+	changed := []string{}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			after[name] = nil
+		}
+	}
+	for name, val := range after {
+		if name == "version" || name == "updatedAt" {
+			continue
+		}
+		if !reflect.DeepEqual(before[name], val) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// NewTodoEvent turns a write to the Todos table into a history event.
+func NewTodoEvent(record StreamRecord) (TodoEvent, error) {
+	current := record.New
+	if current == nil {
+		current = record.Old
+	}
+	changed, err := changedFields(record.Old, record.New)
+	if err != nil {
+		return TodoEvent{}, err
+	}
+
+	// Sequence numbers are decimal strings of varying length, padded so
+	// they sort as numbers
+	seq := record.Seq
+	if len(seq) < 40 {
+		seq = strings.Repeat("0", 40-len(seq)) + seq
+	}
+	at := record.At.UTC().Format(time.RFC3339)
+	event := TodoEvent{
+		TodoID:  current.ID,
+		Key:     at + "#" + seq,
+		Owner:   current.Owner,
+		At:      at,
+		Kind:    eventKind(record),
+		Changed: changed,
+		Old:     record.Old,
+		New:     record.New,
+	}
+	if record.New != nil {
+		event.Actor = record.New.UpdatedBy
+	} else if record.Expired {
+		event.Actor = ActorTTL
+	}
+	return event, nil
+}
+
+// streamImage reads an image of a stream record as a todo. The attribute
+// values of the lambda events marshal to the same JSON as those of the
+// SDK, so the image is converted through JSON.
+func streamImage(image map[string]events.DynamoDBAttributeValue) (*Todos, error) {
+	if len(image) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(image)
+	if err != nil {
+		return nil, err
+	}
+	item := map[string]*dynamodb.AttributeValue{}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+	todo := Todos{}
+	if err := dynamodbattribute.UnmarshalMap(item, &todo); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// streamRecord decodes a record of the Todos table stream, which has to
+// carry new and old images.
+func streamRecord(record events.DynamoDBEventRecord) (StreamRecord, error) {
+	old, err := streamImage(record.Change.OldImage)
+	if err != nil {
+		return StreamRecord{}, err
+	}
+	updated, err := streamImage(record.Change.NewImage)
+	if err != nil {
+		return StreamRecord{}, err
+	}
+	if old == nil && updated == nil {
+		return StreamRecord{}, errors.New("Stream record " + record.EventID + " has no images")
+	}
+
+	identity := record.UserIdentity
+	return StreamRecord{
+		Old:     old,
+		New:     updated,
+		Expired: identity != nil && identity.Type == "Service" && identity.PrincipalID == "dynamodb.amazonaws.com",
+		At:      record.Change.ApproximateCreationDateTime.Time,
+		Seq:     record.Change.SequenceNumber,
+	}, nil
+}
+
+// pairRenames merges the remove and the insert a rename makes into one
+// record, as a rename is a single change to the todo. A pair split over
+// two batches is recorded as a delete and a rename.
+func pairRenames(records []StreamRecord) []StreamRecord {
+	paired := []StreamRecord{}
+	used := map[int]bool{}
+	for i, record := range records {
+		if used[i] {
+			continue
+		}
+		if record.Old != nil && record.New == nil && !record.Expired {
+			for j := range records {
+				other := records[j]
+				if used[j] || j == i || other.Old != nil || other.New == nil ||
+					other.New.ID != record.Old.ID || other.New.Version != record.Old.Version+1 {
+					continue
+				}
+				used[j] = true
+				record.New = other.New
+				break
+			}
+		} else if record.Old == nil && record.New.Version > 1 {
+			// The insert came first, wait for the remove to pick it up
+			waiting := false
+			for j := i + 1; j < len(records); j++ {
+				other := records[j]
+				if other.Old != nil && other.New == nil && !other.Expired &&
+					other.Old.ID == record.New.ID && record.New.Version == other.Old.Version+1 {
+					waiting = true
+					break
+				}
+			}
+			if waiting {
+				continue
+			}
+		}
+		used[i] = true
+		paired = append(paired, record)
+	}
+	return paired
+}
+
+// HistoryRecorder is the consumer of the Todos table stream writing the
+// change history.
+type HistoryRecorder struct {
+	History HistoryStore
+}
+
+// Record appends the history event of a write.
+func (r *HistoryRecorder) Record(record StreamRecord) error {
+	event, err := NewTodoEvent(record)
+	if err != nil {
+		return err
+	}
+	return r.History.Append(event)
+}
+
+// HandleStreamEvent records a batch of the Todos table stream. An error
+// makes Lambda retry the batch, which appending events again makes safe.
+func (r *HistoryRecorder) HandleStreamEvent(event events.DynamoDBEvent) error {
+	records := []StreamRecord{}
+	for _, record := range event.Records {
+		decoded, err := streamRecord(record)
+		if err != nil {
+			return err
+		}
+		records = append(records, decoded)
+	}
+
+	for _, record := range pairRenames(records) {
+		if err := r.Record(record); err != nil {
+			fmt.Println("Got error recording history: " + err.Error())
+			return err
+		}
+	}
+	fmt.Println("Recorded " + strconv.Itoa(len(records)) + " stream records")
+	return nil
+}
+
+// historyScope is the cursor scope of the history of the todo of owner.
+func historyScope(owner string, id string) string {
+	return "history " + owner + " " + id
+}
+
+// HandleGetHistoryRequest answers the change history of the todo named by
+// the {id} path parameter, newest first, paged with ?limit= and ?cursor=.
+func (h *Handler) HandleGetHistoryRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "GET" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+	if h.History == nil {
+		return errorResponse(apierror.NotImplemented, ErrHistoryDisabled)
+	}
+
+	limit, err := queryLimit(request, defaultHistoryLimit)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+
+	// Cursors page the history of one todo for one caller only
+	owner := CallerID(request)
+	id := request.PathParameters["id"]
+	scope := historyScope(owner, id)
+	var startKey PageKey
+	if cursor, ok := request.QueryStringParameters["cursor"]; ok && cursor != "" {
+		key, err := DecodeScopedCursor(cursor, scope, h.CursorSecret)
+		if err != nil {
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+		startKey = key
+	}
+
+	fmt.Print("[GET] Get history: " + id)
+	history, lastKey, err := h.History.Events(id, owner, limit, startKey)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	// A todo from before the history has none, but it is still there
+	if len(history) == 0 && startKey == nil {
+		live, _, err := h.Store.Query(TodoQuery{Owner: owner, ID: id, Limit: 1})
+		if err == nil && len(live) == 0 {
+			live, _, err = h.Store.Query(TodoQuery{Owner: owner, ID: id, Deleted: true, Limit: 1})
+		}
+		if err != nil {
+			return errorResponse(apierror.Internal, err)
+		}
+		if len(live) == 0 {
+			return errorResponse(apierror.NotFound, ErrNotFound)
+		}
+	}
+
+	next, err := EncodeScopedCursor(lastKey, scope, h.CursorSecret)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	responseBody, err := json.Marshal(TodoEventsPage{Events: history, Next: next})
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	return GenerateResponse(string(responseBody), http.StatusOK), nil
+}
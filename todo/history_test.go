@@ -0,0 +1,165 @@
+package todo
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestEventKind(t *testing.T) {
+	live := &Todos{ID: "1", Title: "a", Version: 1}
+	cases := []struct {
+		name   string
+		record StreamRecord
+		want   string
+	}{
+		{"insert", StreamRecord{New: live}, EventCreated},
+		{"insert of a rename", StreamRecord{New: &Todos{ID: "1", Title: "b", Version: 2}}, EventRenamed},
+		{"remove", StreamRecord{Old: live}, EventDeleted},
+		{"ttl remove", StreamRecord{Old: live, Expired: true}, EventPurged},
+		{"paired rename", StreamRecord{Old: live, New: &Todos{ID: "1", Title: "b", Version: 2}}, EventRenamed},
+		{"trash", StreamRecord{Old: live, New: &Todos{ID: "1", Title: "a", DeletedAt: "2026-01-01T00:00:00Z"}}, EventTrashed},
+		{"restore", StreamRecord{Old: &Todos{ID: "1", Title: "a", DeletedAt: "2026-01-01T00:00:00Z"}, New: live}, EventRestored},
+		{"complete", StreamRecord{Old: live, New: &Todos{ID: "1", Title: "a", Completed: true}}, EventCompleted},
+		{"reopen", StreamRecord{Old: &Todos{ID: "1", Title: "a", Completed: true}, New: live}, EventReopened},
+		{"other change", StreamRecord{Old: live, New: &Todos{ID: "1", Title: "a", Priority: "high"}}, EventUpdated},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := eventKind(c.record); got != c.want {
+				t.Errorf("got %s, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	old := &Todos{ID: "1", Title: "a", Version: 1, UpdatedAt: "2026-01-01T00:00:00Z", Tags: []string{"work"}}
+	cases := []struct {
+		name    string
+		updated *Todos
+		want    []string
+	}{
+		{"only version and time", &Todos{ID: "1", Title: "a", Version: 2, UpdatedAt: "2026-01-02T00:00:00Z", Tags: []string{"work"}}, []string{}},
+		{"field set", &Todos{ID: "1", Title: "a", Priority: "high", Tags: []string{"work"}}, []string{"priority"}},
+		{"removed field", &Todos{ID: "1", Title: "a"}, []string{"tags"}},
+		{"several, sorted", &Todos{ID: "1", Title: "b", Completed: true, Tags: []string{"home"}}, []string{"completed", "tags", "title"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := changedFields(old, c.updated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	if got, _ := changedFields(nil, old); got != nil {
+		t.Errorf("got %v for an insert, want nil", got)
+	}
+}
+
+func TestPairRenames(t *testing.T) {
+	old := &Todos{ID: "1", Title: "a", Version: 3}
+	renamed := &Todos{ID: "1", Title: "b", Version: 4}
+	other := &Todos{ID: "2", Title: "c", Version: 1}
+	cases := []struct {
+		name    string
+		records []StreamRecord
+		want    []StreamRecord
+	}{
+		{"remove then insert", []StreamRecord{{Old: old}, {New: renamed}}, []StreamRecord{{Old: old, New: renamed}}},
+		{"insert then remove", []StreamRecord{{New: renamed}, {Old: old}}, []StreamRecord{{Old: old, New: renamed}}},
+		{"with other writes between", []StreamRecord{{Old: old}, {New: other}, {New: renamed}},
+			[]StreamRecord{{Old: old, New: renamed}, {New: other}}},
+		{"remove alone", []StreamRecord{{Old: old}}, []StreamRecord{{Old: old}}},
+		{"insert alone", []StreamRecord{{New: renamed}}, []StreamRecord{{New: renamed}}},
+		{"ttl remove", []StreamRecord{{Old: old, Expired: true}, {New: renamed}},
+			[]StreamRecord{{Old: old, Expired: true}, {New: renamed}}},
+		{"version gap", []StreamRecord{{Old: old}, {New: &Todos{ID: "1", Title: "b", Version: 5}}},
+			[]StreamRecord{{Old: old}, {New: &Todos{ID: "1", Title: "b", Version: 5}}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := pairRenames(c.records); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+// historyPage gets a page of the history of the todo as owner.
+func historyPage(t *testing.T, h *Handler, owner string, id string, params map[string]string) (int, TodoEventsPage) {
+	t.Helper()
+	request := events.APIGatewayProxyRequest{
+		HTTPMethod:            "GET",
+		PathParameters:        map[string]string{"id": id},
+		QueryStringParameters: params,
+	}
+	apiResponse, err := h.HandleGetHistoryRequest(WithFakeClaims(request, owner))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := TodoEventsPage{}
+	if apiResponse.StatusCode == http.StatusOK {
+		if err := json.Unmarshal([]byte(apiResponse.Body), &page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return apiResponse.StatusCode, page
+}
+
+func TestHistoryCursorScope(t *testing.T) {
+	h := newTestHandler()
+	history := NewMemoryHistoryStore()
+	recorder := &HistoryRecorder{History: history}
+	h.Store.(*MemoryStore).Stream = func(record StreamRecord) {
+		if err := recorder.Record(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.History = history
+
+	todo := addTestTodo(t, h, "u1", "buy milk")
+	other := addTestTodo(t, h, "u1", "buy eggs")
+	for _, body := range []string{`{"completed": true}`, `{"completed": false}`} {
+		if status, _ := call(t, h.HandleUpdateTodoRequest, "PATCH", "u1", todo.ID, body); status != http.StatusOK {
+			t.Fatalf("got %d", status)
+		}
+	}
+
+	status, first := historyPage(t, h, "u1", todo.ID, map[string]string{"limit": "2"})
+	if status != http.StatusOK || len(first.Events) != 2 || first.Next == "" {
+		t.Fatalf("got %d %+v, want 2 events and a cursor", status, first)
+	}
+	cursor := map[string]string{"limit": "2", "cursor": first.Next}
+	if status, second := historyPage(t, h, "u1", todo.ID, cursor); status != http.StatusOK || len(second.Events) != 1 {
+		t.Errorf("got %d %+v, want the last event", status, second)
+	}
+
+	// The cursor only pages the history it came from
+	if status, _ := historyPage(t, h, "u1", other.ID, cursor); status != http.StatusBadRequest {
+		t.Errorf("got %d for the cursor of another todo, want 400", status)
+	}
+	if status, _ := historyPage(t, h, "u2", todo.ID, cursor); status != http.StatusBadRequest {
+		t.Errorf("got %d for the cursor of another user, want 400", status)
+	}
+	todosCursor := map[string]string{"cursor": first.Next}
+	if status, _ := listPage(t, h, todosCursor); status != http.StatusBadRequest {
+		t.Errorf("got %d for a history cursor on /todos, want 400", status)
+	}
+
+	// A limit of 0 reads everything
+	if all, _, err := history.Events(todo.ID, "u1", 0, nil); err != nil || len(all) != 3 {
+		t.Errorf("got %d events (%v), want 3", len(all), err)
+	}
+	if none, key, err := history.Events("nope", "u1", 0, nil); err != nil || len(none) != 0 || key != nil {
+		t.Errorf("got %v %v %v for a todo without history", none, key, err)
+	}
+}
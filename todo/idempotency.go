@@ -0,0 +1,93 @@
+package todo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// IdempotencyTableName is the table remembering the Idempotency-Keys todos
+// were created under, hash key Key, with TTL on ExpiresAt.
+const IdempotencyTableName = "TodoIdempotency"
+
+const (
+	defaultIdempotencyTTL   = 24 * time.Hour
+	maxIdempotencyKeyLength = 255
+)
+
+var (
+	ErrKeyUsed               = errors.New("Idempotency-Key already used")
+	ErrKeyReused             = errors.New("Idempotency-Key was used for a different request")
+	ErrInvalidIdempotencyKey = fmt.Errorf("Invalid Idempotency-Key, expected 1 to %d characters", maxIdempotencyKeyLength)
+)
+
+// IdempotencyRecord is the response a create answered with under an
+// Idempotency-Key, stored with the todo it created. Key is the key scoped
+// to the owner and RequestHash the SHA-256 of the request body, which a
+// retry has to repeat. ExpiresAt is the TTL in Unix seconds.
+type IdempotencyRecord struct {
+	Key         string            `dynamodbav:"Key"`
+	RequestHash string            `dynamodbav:"RequestHash"`
+	TodoID      string            `dynamodbav:"TodoId"`
+	Status      int               `dynamodbav:"Status"`
+	Body        string            `dynamodbav:"Body"`
+	Headers     map[string]string `dynamodbav:"Headers"`
+	CreatedAt   string            `dynamodbav:"CreatedAt"`
+	ExpiresAt   int64             `dynamodbav:"ExpiresAt"`
+}
+
+func (h *Handler) idempotencyTTL() time.Duration {
+	if h.IdempotencyTTL > 0 {
+		return h.IdempotencyTTL
+	}
+	return defaultIdempotencyTTL
+}
+
+// idempotencyKey scopes the key a client sent to owner, so callers cannot
+// replay each other's requests.
+func idempotencyKey(owner string, key string) string {
+	return ownerKey(owner) + "#" + key
+}
+
+func requestHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// replayKey answers a request under a key that was used before: the
+// response recorded for it when the body is the same, 422 when it is not.
+// found is false when the key was not used yet, or expired.
+func (h *Handler) replayKey(key string, hash string) (events.APIGatewayProxyResponse, bool, error) {
+	record, err := h.Store.GetIdempotencyRecord(key)
+	if err == ErrNotFound {
+		return events.APIGatewayProxyResponse{}, false, nil
+	} else if err != nil {
+		apiResponse, err := errorResponse(apierror.Internal, err)
+		return apiResponse, true, err
+	}
+	if record.RequestHash != hash {
+		apiResponse, err := errorResponse(apierror.Unprocessable, ErrKeyReused)
+		return apiResponse, true, err
+	}
+
+	fmt.Println("Replaying add of " + record.TodoID)
+	apiResponse := GenerateResponse(record.Body, record.Status)
+	for name, value := range record.Headers {
+		apiResponse.Headers[name] = value
+	}
+	apiResponse.Headers["Idempotent-Replayed"] = "true"
+	return apiResponse, true, nil
+}
+
+// AddTodoOnce is AddTodo under an Idempotency-Key: the todo and the record
+// of the key are written together, and when the key turns out to be taken
+// by a concurrent retry nothing is written and that request's response is
+// replayed instead.
+func (h *Handler) AddTodoOnce(todo Todos, key string, hash string) (events.APIGatewayProxyResponse, error) {
+	return h.addTodo(todo, &IdempotencyRecord{Key: key, RequestHash: hash})
+}
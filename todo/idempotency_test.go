@@ -0,0 +1,71 @@
+package todo
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// keyedAdd adds a todo of u1 under the Idempotency-Key.
+func keyedAdd(t *testing.T, h *Handler, key string, body string) events.APIGatewayProxyResponse {
+	t.Helper()
+	request := events.APIGatewayProxyRequest{HTTPMethod: "POST", Body: body, Headers: map[string]string{"Idempotency-Key": key}}
+	apiResponse, err := h.HandleAddTodoRequest(WithFakeClaims(request, "u1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return apiResponse
+}
+
+func TestIdempotencyKeyReplay(t *testing.T) {
+	h := newTestHandler()
+	first := keyedAdd(t, h, "k1", `{"title": "buy milk"}`)
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("got %d %s", first.StatusCode, first.Body)
+	}
+
+	retry := keyedAdd(t, h, "k1", `{"title": "buy milk"}`)
+	if retry.StatusCode != first.StatusCode || retry.Body != first.Body || retry.Headers["Idempotent-Replayed"] != "true" {
+		t.Errorf("got %d %s %v, want the first response replayed", retry.StatusCode, retry.Body, retry.Headers)
+	}
+	if retry.Headers["ETag"] != first.Headers["ETag"] {
+		t.Errorf("got ETag %q, want %q", retry.Headers["ETag"], first.Headers["ETag"])
+	}
+	todos, _, err := h.Store.Query(TodoQuery{Owner: "u1"})
+	if err != nil || len(todos) != 1 {
+		t.Errorf("got %v %v, want a single todo", todos, err)
+	}
+
+	cases := []struct {
+		name   string
+		key    string
+		body   string
+		status int
+	}{
+		{"different body", "k1", `{"title": "buy eggs"}`, http.StatusUnprocessableEntity},
+		{"empty key", "", `{"title": "buy milk"}`, http.StatusBadRequest},
+		{"other key", "k2", `{"title": "buy milk"}`, http.StatusOK},
+	}
+	for _, c := range cases {
+		if apiResponse := keyedAdd(t, h, c.key, c.body); apiResponse.StatusCode != c.status {
+			t.Errorf("%s: got %d %s, want %d", c.name, apiResponse.StatusCode, apiResponse.Body, c.status)
+		}
+	}
+}
+
+// racedKeyStore has every key taken by a request whose record is not there.
+type racedKeyStore struct {
+	*MemoryStore
+}
+
+func (s racedKeyStore) PutKeyed(todo Todos, record IdempotencyRecord) error {
+	return ErrKeyUsed
+}
+
+func TestIdempotencyKeyTakenWithoutRecord(t *testing.T) {
+	h := &Handler{Store: racedKeyStore{NewMemoryStore()}, CursorSecret: []byte("secret")}
+	if apiResponse := keyedAdd(t, h, "k1", `{"title": "buy milk"}`); apiResponse.StatusCode != http.StatusConflict {
+		t.Errorf("got %d %s, want 409", apiResponse.StatusCode, apiResponse.Body)
+	}
+}
@@ -0,0 +1,608 @@
+package todo
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	uuid "github.com/satori/go.uuid"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// MaxImportTodos caps the number of todos one import adds, like a batch.
+const MaxImportTodos = MaxBatchOperations
+
+var (
+	ErrUnknownImportFormat = errors.New("Unknown import format, expected one of csv, todotxt, markdown")
+	ErrNothingToImport     = errors.New("No todos to import")
+	ErrNoTitleColumn       = errors.New("CSV has no title column")
+)
+
+// importLine is a todo read from line Line of an import. Ref names it for
+// the other lines and ParentRef names its parent, either another line or
+// an existing todo. CreatedAt and CompletedAt are kept from the file. A
+// line that could not be read has Err set.
+type importLine struct {
+	Line        int
+	Todo        Todos
+	Ref         string
+	ParentRef   string
+	CreatedAt   string
+	CompletedAt string
+	Err         error
+}
+
+// ImportFormat is a format todos are imported from.
+type ImportFormat struct {
+	Name        string
+	ContentType string
+	Parse       func(body string) ([]importLine, error)
+}
+
+// ImportFormats lists the import formats.
+var ImportFormats = []ImportFormat{
+	{"csv", "text/csv", parseCSV},
+	{"todotxt", "text/plain", parseTodoTxt},
+	{"markdown", "text/markdown", parseMarkdown},
+}
+
+// importAliases are the other names ?format= and Content-Type know import
+// formats by.
+var importAliases = map[string]string{
+	"todo.txt":        "todotxt",
+	"txt":             "todotxt",
+	"md":              "markdown",
+	"text/x-markdown": "markdown",
+}
+
+func importFormat(name string) (ImportFormat, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := importAliases[name]; ok {
+		name = alias
+	}
+	for _, format := range ImportFormats {
+		if format.Name == name || format.ContentType == name {
+			return format, true
+		}
+	}
+	return ImportFormat{}, false
+}
+
+// ImportResult is the outcome of the todo on Line, with an HTTP status
+// code of its own and, when it failed, the error code of that status.
+type ImportResult struct {
+	Line   int           `json:"line"`
+	Status int           `json:"status"`
+	Code   apierror.Code `json:"code,omitempty"`
+	Error  string        `json:"error,omitempty"`
+	Todo   *Todos        `json:"todo,omitempty"`
+}
+
+type ImportResponse struct {
+	DryRun   bool           `json:"dryRun"`
+	Imported int            `json:"imported"`
+	Failed   int            `json:"failed"`
+	Results  []ImportResult `json:"results"`
+}
+
+// importTime reads a date or an RFC 3339 time of an import. A bare date is
+// midnight UTC, as the exports write it.
+func importTime(value string) string {
+	value = strings.TrimSpace(value)
+	day, err := time.Parse("2006-01-02", value)
+	if err == nil {
+		return day.UTC().Format(time.RFC3339)
+	}
+	return value
+}
+
+func isImportDate(value string) bool {
+	_, err := time.Parse("2006-01-02", value)
+	return err == nil
+}
+
+// parseCSV reads a CSV file with a header row naming its columns like the
+// CSV export does, in any order and case. Tags are split on semicolons and
+// ids only link parentId to the other rows; the server managed columns
+// other than createdAt and completedAt are ignored.
+func parseCSV(body string) ([]importLine, error) {
+	reader := csv.NewReader(strings.NewReader(body))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, ErrNothingToImport
+	} else if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, ErrNoTitleColumn
+	}
+
+	lines := []importLine{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if perr, ok := err.(*csv.ParseError); ok {
+			lines = append(lines, importLine{Line: perr.StartLine, Err: perr.Err})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		n, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			i, ok := columns[strings.ToLower(name)]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		line := importLine{
+			Line:        n,
+			Ref:         field("id"),
+			ParentRef:   field("parentId"),
+			CreatedAt:   field("createdAt"),
+			CompletedAt: field("completedAt"),
+			Todo: Todos{
+				Title:       field("title"),
+				DueAt:       importTime(field("dueAt")),
+				Priority:    strings.ToLower(field("priority")),
+				Description: field("description"),
+				ListID:      field("listId"),
+				Recurrence:  field("recurrence"),
+				TimeZone:    field("timeZone"),
+			},
+		}
+		if completed := field("completed"); completed != "" {
+			line.Todo.Completed, err = strconv.ParseBool(completed)
+			if err != nil {
+				line.Err = errors.New("Invalid completed, expected true or false")
+			}
+		}
+		for _, tag := range strings.Split(field("tags"), ";") {
+			if strings.TrimSpace(tag) != "" {
+				line.Todo.Tags = append(line.Todo.Tags, tag)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// todoTxtPriorities maps the priorities of todo.txt onto ours: A is urgent,
+// B high, C medium and every other letter low.
+var todoTxtPriorities = map[string]string{"A": "urgent", "B": "high", "C": "medium"}
+
+var todoTxtPriority = regexp.MustCompile(`^\(([A-Z])\)$`)
+
+func todoTxtPriorityOf(letter string) string {
+	if priority, ok := todoTxtPriorities[letter]; ok {
+		return priority
+	}
+	return "low"
+}
+
+// parseTodoTxt reads the todo.txt format, one todo a line: an x and the
+// completion date for a completed todo, a priority (A) to (Z), a creation
+// date, then the title. +project and @context words become tags, keeping
+// their sign, and due:YYYY-MM-DD the due date. pri:A, which completed
+// todos carry their priority in, is read as well; other key:value words
+// stay in the title.
+func parseTodoTxt(body string) ([]importLine, error) {
+	lines := []importLine{}
+	for i, text := range strings.Split(body, "\n") {
+		words := strings.Fields(text)
+		if len(words) == 0 {
+			continue
+		}
+		line := importLine{Line: i + 1}
+
+		if words[0] == "x" {
+			line.Todo.Completed = true
+			words = words[1:]
+			if len(words) > 0 && isImportDate(words[0]) {
+				line.CompletedAt = words[0]
+				words = words[1:]
+			}
+		} else if m := todoTxtPriority.FindStringSubmatch(words[0]); m != nil {
+			line.Todo.Priority = todoTxtPriorityOf(m[1])
+			words = words[1:]
+		}
+		if len(words) > 0 && isImportDate(words[0]) {
+			line.CreatedAt = words[0]
+			words = words[1:]
+		}
+
+		title := []string{}
+		for _, word := range words {
+			switch {
+			case len(word) > 1 && (word[0] == '+' || word[0] == '@'):
+				line.Todo.Tags = append(line.Todo.Tags, word)
+			case strings.HasPrefix(word, "due:") && len(word) > len("due:"):
+				line.Todo.DueAt = importTime(word[len("due:"):])
+			case strings.HasPrefix(word, "pri:") && len(word) == len("pri:A") && word[4] >= 'A' && word[4] <= 'Z':
+				line.Todo.Priority = todoTxtPriorityOf(word[4:])
+			default:
+				title = append(title, word)
+			}
+		}
+		line.Todo.Title = strings.Join(title, " ")
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+var markdownItem = regexp.MustCompile(`^(\s*)(?:[-*+]|\d+[.)])\s+\[([ xX])\]\s*(.*)$`)
+
+// parseMarkdown reads a checklist the way the Markdown export writes it:
+// - [ ] and - [x] items, also with * or + or numbered, and an item
+// indented below another is its subtask. #tag and due:<date> words at the
+// end of an item are its tags and due date. Lines that are not checklist
+// items, such as headings and notes, are skipped.
+func parseMarkdown(body string) ([]importLine, error) {
+	type open struct {
+		indent int
+		ref    string
+	}
+	lines := []importLine{}
+	stack := []open{}
+	for i, text := range strings.Split(body, "\n") {
+		m := markdownItem.FindStringSubmatch(strings.TrimRight(text, "\r"))
+		if m == nil {
+			continue
+		}
+		indent := len(strings.ReplaceAll(m[1], "\t", "    "))
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		line := importLine{Line: i + 1, Ref: "line:" + strconv.Itoa(i+1)}
+		if len(stack) > 0 {
+			line.ParentRef = stack[len(stack)-1].ref
+		}
+		stack = append(stack, open{indent, line.Ref})
+
+		line.Todo.Completed = m[2] != " "
+		words := strings.Fields(m[3])
+		end := len(words)
+		for ; end > 0; end-- {
+			word := words[end-1]
+			if len(word) > 1 && word[0] == '#' {
+				line.Todo.Tags = append([]string{word[1:]}, line.Todo.Tags...)
+			} else if strings.HasPrefix(word, "due:") && len(word) > len("due:") {
+				line.Todo.DueAt = importTime(word[len("due:"):])
+			} else {
+				break
+			}
+		}
+		line.Todo.Title = strings.Join(words[:end], " ")
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// importStatus maps the error of an import line to its status code, the
+// one HandleAddTodoRequest answers with.
+func importStatus(err error) int {
+	switch err {
+	case ErrListNotFound:
+		return http.StatusNotFound
+	case ErrThrottled:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusBadRequest
+}
+
+// ImportTodos adds the todos read from an import for owner, each checked
+// like HandleAddTodoRequest checks a new todo, and reports a result for
+// every line. Lines can be the parents of other lines, which are written
+// first; a line whose parent fails, or cannot be written, fails too. A
+// dry run checks everything and returns the todos as they would be added,
+// without writing them or keeping their IDs.
+func (h *Handler) ImportTodos(owner string, lines []importLine, dryRun bool) (events.APIGatewayProxyResponse, error) {
+	now := time.Now().UTC()
+	results := make([]ImportResult, len(lines))
+	fail := func(i int, status int, err error) {
+		results[i] = ImportResult{Line: lines[i].Line, Status: status, Code: apierror.ForStatus(status), Error: err.Error()}
+	}
+	failStore := func(i int, err error) {
+		apiErr := batchError(err)
+		results[i] = ImportResult{Line: lines[i].Line, Status: apiErr.Code.Status(), Code: apiErr.Code, Error: apiErr.Message}
+	}
+
+	refs := map[string]int{}
+	for i, line := range lines {
+		if line.Ref == "" {
+			continue
+		}
+		if _, ok := refs[line.Ref]; ok {
+			lines[i].Err = errors.New("Duplicate id " + line.Ref)
+			continue
+		}
+		refs[line.Ref] = i
+	}
+
+	// Check every line on its own and give it its ID
+	lists := map[string]error{}
+	for i := range lines {
+		line := &lines[i]
+		if line.Err != nil {
+			continue
+		}
+		todo := line.Todo
+		todo.Owner = owner
+		if todo.Title == "" || todo.Title == "null" {
+			line.Err = errors.New("Adding Title not specified")
+			continue
+		}
+		err := todo.validate()
+		if err != nil {
+			line.Err = err
+			continue
+		}
+		if todo.ListID != "" {
+			err, checked := lists[todo.ListID]
+			if !checked {
+				_, err = h.ownedList(owner, todo.ListID)
+				lists[todo.ListID] = err
+			}
+			if err != nil {
+				line.Err = err
+				continue
+			}
+		}
+		createdAt, err := importStamp("createdAt", line.CreatedAt)
+		if err != nil {
+			line.Err = err
+			continue
+		}
+		completedAt, err := importStamp("completedAt", line.CompletedAt)
+		if err != nil {
+			line.Err = err
+			continue
+		}
+
+		id, err := uuid.NewV4()
+		if err != nil {
+			line.Err = err
+			continue
+		}
+		todo.ParentID = ""
+		todo = newTodo(todo, id.String(), now)
+		if createdAt != "" {
+			todo.CreatedAt = createdAt
+		}
+		if completedAt != "" && todo.Completed {
+			todo.CompletedAt = completedAt
+		}
+		line.Todo = todo
+	}
+
+	// Link the subtasks to their parents, which have to be imported along
+	// with them or exist already, and check how deep they nest. levels
+	// counts the parents of a line up to the first existing todo, roots
+	// that todo.
+	const resolving = -1
+	levels := map[int]int{}
+	roots := map[int]string{}
+	nesting := map[string]error{}
+	checkNesting := func(parentID string, n int) error {
+		key := parentID + "#" + strconv.Itoa(n)
+		err, checked := nesting[key]
+		if !checked {
+			err = h.checkNesting(owner, parentID, n)
+			nesting[key] = err
+		}
+		return err
+	}
+	var level func(i int) (int, error)
+	level = func(i int) (int, error) {
+		line := &lines[i]
+		if n, ok := levels[i]; ok {
+			if n == resolving {
+				return 0, errors.New("Subtasks form a cycle")
+			}
+			return n, nil
+		}
+		if line.Err != nil {
+			return 0, line.Err
+		}
+
+		n, err := 0, error(nil)
+		if p, ok := refs[line.ParentRef]; ok && line.ParentRef != "" {
+			levels[i] = resolving
+			n, err = level(p)
+			if err != nil && lines[p].Err != nil {
+				err = fmt.Errorf("Parent on line %d not imported", lines[p].Line)
+			} else if err == nil {
+				n++
+				line.Todo.ParentID = lines[p].Todo.ID
+				roots[i] = roots[p]
+				if n >= maxTodoDepth {
+					err = ErrTooDeep
+				} else if roots[i] != "" {
+					err = checkNesting(roots[i], n)
+				}
+			}
+		} else if line.ParentRef != "" {
+			n = 1
+			line.Todo.ParentID = line.ParentRef
+			roots[i] = line.ParentRef
+			err = checkNesting(line.ParentRef, n)
+		}
+		if err != nil {
+			delete(levels, i)
+			line.Err = err
+			return 0, err
+		}
+		levels[i] = n
+		return n, nil
+	}
+	for i := range lines {
+		level(i)
+	}
+
+	adds, addIndexes := []Todos{}, []int{}
+	for i, line := range lines {
+		if line.Err != nil {
+			fail(i, importStatus(line.Err), line.Err)
+			continue
+		}
+		adds = append(adds, line.Todo)
+		addIndexes = append(addIndexes, i)
+	}
+
+	if err := h.appendPositions(owner, adds); err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	errs := make([]error, len(adds))
+	if !dryRun {
+		fmt.Println("Importing " + strconv.Itoa(len(adds)) + " todos")
+		h.importLevels(lines, refs, levels, adds, addIndexes, errs)
+	}
+	imported := 0
+	for n, err := range errs {
+		i := addIndexes[n]
+		if err != nil {
+			failStore(i, err)
+			continue
+		}
+		added := adds[n]
+		results[i] = ImportResult{Line: lines[i].Line, Status: http.StatusOK, Todo: &added}
+		imported++
+		if dryRun {
+			continue
+		}
+		if _, ok := refs[lines[i].ParentRef]; !ok && added.ParentID != "" {
+			h.rollup(added)
+		}
+		h.reindex(added)
+	}
+
+	responseBody, err := json.Marshal(ImportResponse{
+		DryRun:   dryRun,
+		Imported: imported,
+		Failed:   len(lines) - imported,
+		Results:  results,
+	})
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	return GenerateResponse(string(responseBody), http.StatusOK), nil
+}
+
+// importLevels writes the todos to add a level at a time, parents before
+// their subtasks, so that a subtask whose parent could not be written is
+// not written either and fails instead. addIndexes are the lines of the
+// todos and errs gets the error of each.
+func (h *Handler) importLevels(lines []importLine, refs map[string]int, levels map[int]int, adds []Todos, addIndexes []int, errs []error) {
+	byLevel := map[int][]int{}
+	deepest := 0
+	for n, i := range addIndexes {
+		byLevel[levels[i]] = append(byLevel[levels[i]], n)
+		if levels[i] > deepest {
+			deepest = levels[i]
+		}
+	}
+
+	written := map[int]bool{}
+	for level := 0; level <= deepest; level++ {
+		todos, ns := []Todos{}, []int{}
+		for _, n := range byLevel[level] {
+			line := lines[addIndexes[n]]
+			if p, ok := refs[line.ParentRef]; ok && line.ParentRef != "" && !written[p] {
+				errs[n] = apierror.Wrap(apierror.ValidationFailed, fmt.Errorf("Parent on line %d not imported", lines[p].Line))
+				continue
+			}
+			todos = append(todos, adds[n])
+			ns = append(ns, n)
+		}
+		if len(todos) == 0 {
+			continue
+		}
+		for k, err := range h.Store.PutAll(todos) {
+			errs[ns[k]] = err
+			written[addIndexes[ns[k]]] = err == nil
+		}
+	}
+}
+
+// importStamp reads the createdAt or completedAt an import keeps.
+func importStamp(name string, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	stamp, err := time.Parse(time.RFC3339, importTime(value))
+	if err != nil {
+		return "", errors.New("Invalid " + name + ", expected a date or RFC 3339")
+	}
+	return stamp.UTC().Format(time.RFC3339), nil
+}
+
+// HandleImportTodosRequest imports the file in the body, in the format
+// named by ?format= or else by the Content-Type header. ?dryRun=true
+// previews the import without adding anything.
+func (h *Handler) HandleImportTodosRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "POST" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	name := request.QueryStringParameters["format"]
+	if name == "" {
+		contentType, _ := getHeader(request, "Content-Type")
+		name = strings.Split(contentType, ";")[0]
+	}
+	format, ok := importFormat(name)
+	if !ok {
+		return errorResponse(apierror.ValidationFailed, ErrUnknownImportFormat)
+	}
+
+	dryRun := false
+	if value, ok := request.QueryStringParameters["dryRun"]; ok {
+		var err error
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			err := errors.New("Invalid dryRun, expected true or false")
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+	}
+
+	body := request.Body
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+		body = string(decoded)
+	}
+	body = strings.TrimPrefix(body, "\ufeff")
+
+	lines, err := format.Parse(body)
+	if err == nil && len(lines) == 0 {
+		err = ErrNothingToImport
+	}
+	if err == nil && len(lines) > MaxImportTodos {
+		err = fmt.Errorf("More than %d todos to import", MaxImportTodos)
+	}
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+
+	fmt.Println("[POST] Import todos from " + format.Name)
+	return h.ImportTodos(CallerID(request), lines, dryRun)
+}
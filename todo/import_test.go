@@ -0,0 +1,112 @@
+package todo
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestImportParsers(t *testing.T) {
+	cases := []struct {
+		name  string
+		parse func(body string) ([]importLine, error)
+		body  string
+		lines []importLine
+	}{
+		{"csv", parseCSV, "Title,completed,tags,id,parentId,dueAt,priority\n" +
+			"buy milk,true,shop; errand,1,,2026-03-01,High\n" +
+			"skimmed,,,2,1,,\n",
+			[]importLine{
+				{Line: 2, Ref: "1", Todo: Todos{Title: "buy milk", Completed: true, Tags: []string{"shop", " errand"}, DueAt: "2026-03-01T00:00:00Z", Priority: "high"}},
+				{Line: 3, Ref: "2", ParentRef: "1", Todo: Todos{Title: "skimmed"}},
+			}},
+		{"csv bad completed", parseCSV, "title,completed\na,maybe\n",
+			[]importLine{{Line: 2, Todo: Todos{Title: "a"}, Err: errors.New("Invalid completed, expected true or false")}}},
+		{"todo.txt", parseTodoTxt, "(A) 2026-01-02 call mom +family @phone due:2026-01-05\n\n" +
+			"x 2026-01-04 2026-01-01 pay rent pri:B note:later\n",
+			[]importLine{
+				{Line: 1, CreatedAt: "2026-01-02", Todo: Todos{Title: "call mom", Priority: "urgent", Tags: []string{"+family", "@phone"}, DueAt: "2026-01-05T00:00:00Z"}},
+				{Line: 3, CreatedAt: "2026-01-01", CompletedAt: "2026-01-04", Todo: Todos{Title: "pay rent note:later", Completed: true, Priority: "high"}},
+			}},
+		{"markdown", parseMarkdown, "# Todos\n- [ ] plan trip #travel due:2026-05-01\n  - [x] book flights\n    1. [ ] pick seats\n- [X] done\nsome note\n",
+			[]importLine{
+				{Line: 2, Ref: "line:2", Todo: Todos{Title: "plan trip", Tags: []string{"travel"}, DueAt: "2026-05-01T00:00:00Z"}},
+				{Line: 3, Ref: "line:3", ParentRef: "line:2", Todo: Todos{Title: "book flights", Completed: true}},
+				{Line: 4, Ref: "line:4", ParentRef: "line:3", Todo: Todos{Title: "pick seats"}},
+				{Line: 5, Ref: "line:5", Todo: Todos{Title: "done", Completed: true}},
+			}},
+	}
+	for _, c := range cases {
+		lines, err := c.parse(c.body)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(lines, c.lines) {
+			t.Errorf("%s: got %+v, want %+v", c.name, lines, c.lines)
+		}
+	}
+
+	if _, err := parseCSV("id,completed\n1,true\n"); err != ErrNoTitleColumn {
+		t.Errorf("got %v, want ErrNoTitleColumn", err)
+	}
+	if _, err := parseCSV(""); err != ErrNothingToImport {
+		t.Errorf("got %v, want ErrNothingToImport", err)
+	}
+}
+
+// failingParentStore fails to write the todos titled parent and records
+// the titles of every PutAll.
+type failingParentStore struct {
+	*MemoryStore
+	calls [][]string
+}
+
+func (s *failingParentStore) PutAll(todos []Todos) []error {
+	titles := []string{}
+	errs := make([]error, len(todos))
+	for i, todo := range todos {
+		titles = append(titles, todo.Title)
+		if todo.Title == "parent" {
+			errs[i] = ErrThrottled
+		} else {
+			errs[i] = s.MemoryStore.Put(todo)
+		}
+	}
+	s.calls = append(s.calls, titles)
+	return errs
+}
+
+func TestImportWritesParentsFirst(t *testing.T) {
+	store := &failingParentStore{MemoryStore: NewMemoryStore()}
+	h := &Handler{Store: store, CursorSecret: []byte("secret")}
+	lines, err := parseMarkdown("- [ ] child of ok\n- [ ] parent\n  - [ ] child\n    - [ ] grandchild\n- [ ] ok\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines[0].ParentRef = "line:5"
+
+	apiResponse, err := h.ImportTodos("u1", lines, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := ImportResponse{}
+	if err := json.Unmarshal([]byte(apiResponse.Body), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{http.StatusOK, http.StatusTooManyRequests, http.StatusBadRequest, http.StatusBadRequest, http.StatusOK}
+	for i, result := range response.Results {
+		if result.Status != want[i] {
+			t.Errorf("line %d: got %d %s, want %d", result.Line, result.Status, result.Error, want[i])
+		}
+	}
+	if response.Results[2].Error != "Parent on line 2 not imported" || response.Results[3].Error != "Parent on line 3 not imported" {
+		t.Errorf("got %+v", response.Results)
+	}
+	if !reflect.DeepEqual(store.calls, [][]string{{"parent", "ok"}, {"child of ok"}}) {
+		t.Errorf("got writes %v, want the parents first and no orphans", store.calls)
+	}
+}
@@ -0,0 +1,234 @@
+package todo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	uuid "github.com/satori/go.uuid"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// listResponse returns the list as the body.
+func listResponse(list TodoList, statusCode int) (events.APIGatewayProxyResponse, error) {
+	responseBody, err := json.Marshal(list)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	return GenerateResponse(string(responseBody), statusCode), nil
+}
+
+// listError answers a failed list lookup or write: 404 for a list that is
+// missing or belongs to someone else, 500 for anything else.
+func listError(err error) (events.APIGatewayProxyResponse, error) {
+	if err == ErrListNotFound {
+		return errorResponse(apierror.NotFound, err)
+	}
+	return errorResponse(apierror.Internal, err)
+}
+
+// ownedList returns the list with the ID, or ErrListNotFound when it is
+// missing or belongs to someone other than owner.
+func (h *Handler) ownedList(owner string, id string) (TodoList, error) {
+	list, err := h.Store.GetList(id)
+	if err == nil && list.Owner != owner {
+		return TodoList{}, ErrListNotFound
+	}
+	return list, err
+}
+
+// HandleGetListsRequest lists the lists of the caller, oldest first.
+func (h *Handler) HandleGetListsRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "GET" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	lists, err := h.Store.QueryLists(CallerID(request))
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		if lists[i].CreatedAt != lists[j].CreatedAt {
+			return lists[i].CreatedAt < lists[j].CreatedAt
+		}
+		return lists[i].ID < lists[j].ID
+	})
+
+	responseBody, err := json.Marshal(TodoListsPage{Lists: lists})
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	return GenerateResponse(string(responseBody), http.StatusOK), nil
+}
+
+func (h *Handler) HandleAddListRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "POST" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	list := TodoList{}
+	err := json.Unmarshal([]byte(request.Body), &list)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+
+	list.Name, err = normalizeListName(list.Name)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	list.ID = id.String()
+	list.Owner = CallerID(request)
+	list.CreatedAt = now
+	list.UpdatedAt = now
+
+	fmt.Println("Adding list: " + list.ID + " - " + list.Name)
+	err = h.Store.PutList(list)
+	if err != nil {
+		fmt.Println("Got error calling PutItem")
+		return errorResponse(apierror.Internal, err)
+	}
+
+	return listResponse(list, http.StatusOK)
+}
+
+// HandleGetListRequest returns the list named by the {id} path parameter.
+func (h *Handler) HandleGetListRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "GET" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	list, err := h.ownedList(CallerID(request), request.PathParameters["id"])
+	if err != nil {
+		return listError(err)
+	}
+	return listResponse(list, http.StatusOK)
+}
+
+// HandleUpdateListRequest renames the list named by the {id} path
+// parameter.
+func (h *Handler) HandleUpdateListRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "PATCH" && request.HTTPMethod != "PUT" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	list := TodoList{}
+	err := json.Unmarshal([]byte(request.Body), &list)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+
+	list.Name, err = normalizeListName(list.Name)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+	list.ID = request.PathParameters["id"]
+	list.Owner = CallerID(request)
+	list.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	fmt.Println("Renaming list: " + list.ID + " - " + list.Name)
+	updated, err := h.Store.UpdateList(list)
+	if err != nil {
+		return listError(err)
+	}
+	return listResponse(updated, http.StatusOK)
+}
+
+// HandleDeleteListRequest deletes the list named by the {id} path
+// parameter. Only empty lists can be deleted; its todos have to be moved
+// out or deleted first. Todos in the trash stay there, filed under no
+// list.
+func (h *Handler) HandleDeleteListRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "DELETE" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	owner := CallerID(request)
+	list, err := h.ownedList(owner, request.PathParameters["id"])
+	if err != nil {
+		return listError(err)
+	}
+
+	// The store checks the list is empty as it deletes it, which a
+	// todo filed under it in between cannot slip past
+	fmt.Println("Deleting list: " + list.ID + " - " + list.Name)
+	err = h.Store.DeleteList(list.ID, owner)
+	if err == ErrListNotEmpty {
+		return errorResponse(apierror.Conflict, err)
+	} else if err != nil {
+		return listError(err)
+	}
+
+	responseBody, err := json.Marshal(SuccessJson{Success: true})
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	return GenerateResponse(string(responseBody), http.StatusOK), nil
+}
+
+// MoveTodo files the todo under another list, or takes it out of its list
+// when change.ListID is empty.
+func (h *Handler) MoveTodo(change TodoChange) (events.APIGatewayProxyResponse, error) {
+	moved, err := h.Store.Move(change)
+	if err == ErrNotFound || err == ErrListNotFound {
+		return errorResponse(apierror.NotFound, err)
+	} else if err == ErrVersionMismatch {
+		return h.preconditionFailed(change.Owner, change.ID, change.Title)
+	} else if err != nil {
+		fmt.Println("Got error calling TransactWriteItems")
+		return errorResponse(apierror.Internal, err)
+	}
+
+	return successResponse(moved)
+}
+
+// HandleMoveTodoRequest moves the todo named by the {id} path parameter to
+// the list in the body.
+func (h *Handler) HandleMoveTodoRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "POST" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	move := TodoMove{}
+	if request.Body != "" {
+		err := json.Unmarshal([]byte(request.Body), &move)
+		if err != nil {
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+	}
+
+	version, err := requestVersion(request, move.Version)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+
+	change := TodoChange{
+		Owner:     CallerID(request),
+		ID:        request.PathParameters["id"],
+		Title:     move.Title,
+		ListID:    &move.ListID,
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+		Actor:     CallerID(request),
+		Version:   version,
+	}
+	if change.Title == "" {
+		title, err := h.titleOf(change.Owner, change.ID)
+		if err != nil {
+			return errorResponse(apierror.Internal, err)
+		}
+		change.Title = title
+	}
+
+	fmt.Println("Moving: " + change.ID + " - " + change.Title + " to list " + move.ListID)
+	return h.MoveTodo(change)
+}
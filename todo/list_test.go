@@ -0,0 +1,237 @@
+package todo
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func addTestList(t *testing.T, h *Handler, owner string, name string) TodoList {
+	t.Helper()
+	status, body := call(t, h.HandleAddListRequest, "POST", owner, "", `{"name": "`+name+`"}`)
+	if status != http.StatusOK {
+		t.Fatalf("adding list %q: got %d %s", name, status, body)
+	}
+	list := TodoList{}
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+// addListedTodo adds a todo filed under the list.
+func addListedTodo(t *testing.T, h *Handler, owner string, title string, listID string) Todos {
+	t.Helper()
+	body, _ := json.Marshal(Todos{Title: title, ListID: listID})
+	status, responseBody := call(t, h.HandleAddTodoRequest, "POST", owner, "", string(body))
+	if status != http.StatusOK {
+		t.Fatalf("adding %q: got %d %s", title, status, responseBody)
+	}
+	todo := Todos{}
+	if err := json.Unmarshal([]byte(responseBody), &todo); err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+func TestListCRUD(t *testing.T) {
+	h := newTestHandler()
+	list := addTestList(t, h, "u1", "Groceries")
+	if list.ID == "" || list.Name != "Groceries" || list.CreatedAt == "" {
+		t.Fatalf("got %+v", list)
+	}
+
+	cases := []struct {
+		name   string
+		fn     HandlerFunc
+		method string
+		owner  string
+		id     string
+		body   string
+		status int
+	}{
+		{"get", h.HandleGetListRequest, "GET", "u1", list.ID, "", http.StatusOK},
+		{"get foreign", h.HandleGetListRequest, "GET", "u2", list.ID, "", http.StatusNotFound},
+		{"get missing", h.HandleGetListRequest, "GET", "u1", "nope", "", http.StatusNotFound},
+		{"rename foreign", h.HandleUpdateListRequest, "PATCH", "u2", list.ID, `{"name": "Mine"}`, http.StatusNotFound},
+		{"rename empty", h.HandleUpdateListRequest, "PATCH", "u1", list.ID, `{"name": " "}`, http.StatusBadRequest},
+		{"rename", h.HandleUpdateListRequest, "PATCH", "u1", list.ID, `{"name": "Shopping"}`, http.StatusOK},
+		{"delete foreign", h.HandleDeleteListRequest, "DELETE", "u2", list.ID, "", http.StatusNotFound},
+		{"delete missing", h.HandleDeleteListRequest, "DELETE", "u1", "nope", "", http.StatusNotFound},
+		{"wrong method", h.HandleAddListRequest, "GET", "u1", "", "", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if status, body := call(t, c.fn, c.method, c.owner, c.id, c.body); status != c.status {
+				t.Errorf("got %d %s, want %d", status, body, c.status)
+			}
+		})
+	}
+
+	for owner, want := range map[string]int{"u1": 1, "u2": 0} {
+		status, body := call(t, h.HandleGetListsRequest, "GET", owner, "", "")
+		page := TodoListsPage{}
+		if err := json.Unmarshal([]byte(body), &page); err != nil || status != http.StatusOK {
+			t.Fatalf("listing %s: got %d %s", owner, status, body)
+		}
+		if len(page.Lists) != want {
+			t.Errorf("%s: got %d lists, want %d", owner, len(page.Lists), want)
+		}
+		if want > 0 && page.Lists[0].Name != "Shopping" {
+			t.Errorf("%s: got %+v, want the renamed list", owner, page.Lists[0])
+		}
+	}
+
+	if status, body := call(t, h.HandleDeleteListRequest, "DELETE", "u1", list.ID, ""); status != http.StatusOK {
+		t.Fatalf("got %d %s", status, body)
+	}
+	if status, _ := call(t, h.HandleGetListRequest, "GET", "u1", list.ID, ""); status != http.StatusNotFound {
+		t.Errorf("got %d for a deleted list, want 404", status)
+	}
+}
+
+func TestMoveTodoIntoList(t *testing.T) {
+	h := newTestHandler()
+	own := addTestList(t, h, "u1", "Mine")
+	foreign := addTestList(t, h, "u2", "Theirs")
+	todo := addTestTodo(t, h, "u1", "buy milk")
+
+	cases := []struct {
+		name   string
+		listID string
+		status int
+		want   string
+	}{
+		{"missing list", "nope", http.StatusNotFound, ""},
+		{"foreign list", foreign.ID, http.StatusNotFound, ""},
+		{"own list", own.ID, http.StatusOK, own.ID},
+		{"out of the list", "", http.StatusOK, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, body := call(t, h.HandleMoveTodoRequest, "POST", "u1", todo.ID, `{"listId": "`+c.listID+`"}`)
+			if status != c.status {
+				t.Fatalf("got %d %s, want %d", status, body, c.status)
+			}
+			stored, err := h.Store.Get(todo.ID, todo.Title)
+			if err != nil || stored.ListID != c.want {
+				t.Errorf("got list %q (%v), want %q", stored.ListID, err, c.want)
+			}
+		})
+	}
+
+	if status, _ := call(t, h.HandleMoveTodoRequest, "POST", "u2", todo.ID, `{"listId": "`+foreign.ID+`"}`); status != http.StatusNotFound {
+		t.Errorf("got %d moving someone else's todo, want 404", status)
+	}
+	for _, list := range []TodoList{own, foreign} {
+		stored, _ := h.Store.GetList(list.ID)
+		if stored.TodoCount != 0 {
+			t.Errorf("%s: got TodoCount %d, want 0", list.Name, stored.TodoCount)
+		}
+	}
+}
+
+func TestDeleteListNotEmpty(t *testing.T) {
+	h := newTestHandler()
+	list := addTestList(t, h, "u1", "Groceries")
+	todo := addListedTodo(t, h, "u1", "buy milk", list.ID)
+
+	if status, body := call(t, h.HandleDeleteListRequest, "DELETE", "u1", list.ID, ""); status != http.StatusConflict {
+		t.Fatalf("got %d %s for a list with a todo, want 409", status, body)
+	}
+
+	// A trashed todo does not keep the list, and is taken out of it
+	if status, body := call(t, h.HandleDeleteTodoRequest, "DELETE", "u1", todo.ID, ""); status != http.StatusOK {
+		t.Fatalf("trashing: got %d %s", status, body)
+	}
+	if status, body := call(t, h.HandleDeleteListRequest, "DELETE", "u1", list.ID, ""); status != http.StatusOK {
+		t.Fatalf("got %d %s for a list with only trash, want 200", status, body)
+	}
+	status, body := call(t, h.HandleRestoreTodoRequest, "POST", "u1", todo.ID, "")
+	if status != http.StatusOK {
+		t.Fatalf("restoring: got %d %s", status, body)
+	}
+	if restored := writtenTodo(t, body); restored.ListID != "" {
+		t.Errorf("got list %q for a todo of a deleted list, want none", restored.ListID)
+	}
+
+	// Adding into a deleted list fails rather than leaving an orphan
+	body2, _ := json.Marshal(Todos{Title: "buy eggs", ListID: list.ID})
+	if status, body := call(t, h.HandleAddTodoRequest, "POST", "u1", "", string(body2)); status != http.StatusNotFound {
+		t.Errorf("got %d %s adding into a deleted list, want 404", status, body)
+	}
+}
+
+func TestListTodoCount(t *testing.T) {
+	s := NewMemoryStore()
+	if err := s.PutList(TodoList{ID: "l1", Owner: "u1", Name: "Groceries"}); err != nil {
+		t.Fatal(err)
+	}
+	count := func() int64 {
+		list, err := s.GetList("l1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list.TodoCount
+	}
+
+	todo := Todos{ID: "1", Title: "buy milk", Owner: "u1", ListID: "l1"}
+	if err := s.Put(todo); err != nil || count() != 1 {
+		t.Fatalf("after put: got %d (%v), want 1", count(), err)
+	}
+	if err := s.Put(Todos{ID: "2", Title: "x", Owner: "u2", ListID: "l1"}); err != ErrListNotFound {
+		t.Errorf("got %v putting into someone else's list, want ErrListNotFound", err)
+	}
+	if _, err := s.Update(TodoChange{ID: "1", Title: "buy milk", Owner: "u1", DeletedAt: "2026-01-01T00:00:00Z"}); err != nil || count() != 0 {
+		t.Fatalf("after trash: got %d (%v), want 0", count(), err)
+	}
+	if _, err := s.Update(TodoChange{ID: "1", Title: "buy milk", Owner: "u1", Restore: true}); err != nil || count() != 1 {
+		t.Fatalf("after restore: got %d (%v), want 1", count(), err)
+	}
+	if err := s.DeleteList("l1", "u1"); err != ErrListNotEmpty {
+		t.Errorf("got %v deleting a list with a todo, want ErrListNotEmpty", err)
+	}
+	if err := s.Delete("1", "buy milk", "u1", nil); err != nil || count() != 0 {
+		t.Fatalf("after delete: got %d (%v), want 0", count(), err)
+	}
+	if err := s.DeleteList("l1", "u1"); err != nil {
+		t.Errorf("got %v deleting an empty list", err)
+	}
+}
+
+func TestGetListTodosOwnership(t *testing.T) {
+	h := newTestHandler()
+	list := addTestList(t, h, "u1", "Groceries")
+	addListedTodo(t, h, "u1", "buy milk", list.ID)
+	addTestTodo(t, h, "u1", "not filed")
+
+	cases := []struct {
+		name   string
+		owner  string
+		id     string
+		status int
+		todos  int
+	}{
+		{"own list", "u1", list.ID, http.StatusOK, 1},
+		{"foreign list", "u2", list.ID, http.StatusNotFound, 0},
+		{"missing list", "u1", "nope", http.StatusNotFound, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, body := call(t, h.HandleGetTodosRequest, "GET", c.owner, c.id, "")
+			if status != c.status {
+				t.Fatalf("got %d %s, want %d", status, body, c.status)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			page := TodosPage{}
+			if err := json.Unmarshal([]byte(body), &page); err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Todos) != c.todos {
+				t.Errorf("got %d todos, want %d", len(page.Todos), c.todos)
+			}
+		})
+	}
+}
@@ -0,0 +1,544 @@
+package todo
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory TodoStore for running the handlers offline.
+// It follows the DynamoDB semantics of the Todos table: items are keyed by
+// ID and Title, writes are conditioned the way DynamoStore conditions them
+// and trashed items disappear once their ExpiresAt TTL has passed. Stream,
+// when set, is called with every write to a todo, standing in for the
+// stream of the Todos table. It is called with the store locked.
+type MemoryStore struct {
+	mu     sync.Mutex
+	items  map[itemKey]Todos
+	lists  map[string]TodoList
+	keys   map[string]IdempotencyRecord
+	undo   map[string]UndoAction
+	seq    int64
+	Stream func(record StreamRecord)
+}
+
+// NewMemoryStore returns a MemoryStore seeded with the given todos.
+func NewMemoryStore(todos ...Todos) *MemoryStore {
+	s := &MemoryStore{items: map[itemKey]Todos{}, lists: map[string]TodoList{}, keys: map[string]IdempotencyRecord{}, undo: map[string]UndoAction{}}
+	for _, todo := range todos {
+		s.items[itemKey{todo.ID, todo.Title}] = todo
+	}
+	return s
+}
+
+// record passes a write to Stream. Callers must hold s.mu.
+func (s *MemoryStore) record(old *Todos, updated *Todos, expired bool) {
+	if s.Stream == nil {
+		return
+	}
+	s.seq++
+	s.Stream(StreamRecord{Old: old, New: updated, Expired: expired, At: time.Now(), Seq: strconv.FormatInt(s.seq, 10)})
+}
+
+// write stores the todo under key. Callers must hold s.mu.
+func (s *MemoryStore) write(key itemKey, todo Todos) {
+	old, ok := s.items[key]
+	s.items[key] = todo
+	if ok {
+		s.record(&old, &todo, false)
+	} else {
+		s.record(nil, &todo, false)
+	}
+}
+
+// purgeExpired drops trashed items past their TTL, as DynamoDB would.
+// Callers must hold s.mu.
+func (s *MemoryStore) purgeExpired() {
+	now := time.Now().Unix()
+	for key, todo := range s.items {
+		if todo.ExpiresAt != 0 && todo.ExpiresAt <= now {
+			delete(s.items, key)
+			s.record(&todo, nil, true)
+		}
+	}
+}
+
+// refile moves a todo from the TodoCount of the list old counts towards to
+// that of the list updated counts towards, which has to exist and belong
+// to the owner of the todo. Callers must hold s.mu.
+func (s *MemoryStore) refile(old Todos, updated Todos) error {
+	from, to := countedIn(old), countedIn(updated)
+	if from == to {
+		return nil
+	}
+	if to != "" {
+		list, ok := s.lists[to]
+		if !ok || list.Owner != updated.Owner {
+			return ErrListNotFound
+		}
+		list.TodoCount++
+		s.lists[to] = list
+	}
+	if list, ok := s.lists[from]; ok {
+		list.TodoCount--
+		s.lists[from] = list
+	}
+	return nil
+}
+
+// change applies the change to the stored todo, keeping the TodoCount of
+// its lists. Callers must hold s.mu.
+func (s *MemoryStore) change(change TodoChange) (Todos, error) {
+	key := itemKey{change.ID, change.Title}
+	item, ok := s.items[key]
+	if err := change.fails(item, ok); err != nil {
+		return Todos{}, err
+	}
+
+	updated := change.apply(item)
+	if _, ok := s.lists[updated.ListID]; change.Restore && !ok {
+		// Restored from a list that is gone
+		updated.ListID = ""
+	}
+	if err := s.refile(item, updated); err != nil {
+		return Todos{}, err
+	}
+	s.write(key, updated)
+	return updated, nil
+}
+
+func (s *MemoryStore) Put(todo Todos) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := itemKey{todo.ID, todo.Title}
+	if err := s.refile(s.items[key], todo); err != nil {
+		return err
+	}
+	s.write(key, todo)
+	return nil
+}
+
+func (s *MemoryStore) Get(id string, title string) (Todos, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	todo, ok := s.items[itemKey{id, title}]
+	if !ok {
+		return Todos{}, ErrNotFound
+	}
+	return todo, nil
+}
+
+// Query returns matching todos ordered by Position, then ID and Title, so
+// results are stable between calls and a PageKey is simply the last
+// position and key returned.
+func (s *MemoryStore) Query(query TodoQuery) ([]Todos, PageKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	todos := []Todos{}
+	for key, todo := range s.items {
+		if todo.Owner != query.Owner {
+			continue
+		}
+		if query.ID != "" && key.ID != query.ID {
+			continue
+		}
+		if query.ListID != "" && todo.ListID != query.ListID {
+			continue
+		}
+		if query.ParentID != "" && todo.ParentID != query.ParentID {
+			continue
+		}
+		if query.Deleted != (todo.DeletedAt != "") {
+			continue
+		}
+		if query.Completed != nil && todo.Completed != *query.Completed {
+			continue
+		}
+		if query.Filter != nil && !query.Filter.Match(todo) {
+			continue
+		}
+		if query.StartKey != nil && !keyAfter(todo, query.StartKey) {
+			continue
+		}
+		todos = append(todos, todo)
+	}
+
+	sort.Slice(todos, func(i, j int) bool {
+		return keyAfter(todos[j], PageKey{"Position": todos[i].Position, "ID": todos[i].ID, "Title": todos[i].Title})
+	})
+
+	if query.Limit > 0 && int64(len(todos)) > query.Limit {
+		todos = todos[:query.Limit]
+		last := todos[len(todos)-1]
+		return todos, PageKey{"Position": last.Position, "ID": last.ID, "Title": last.Title}, nil
+	}
+	return todos, nil, nil
+}
+
+func (s *MemoryStore) DueTodos(before string) ([]Todos, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	todos := []Todos{}
+	for _, todo := range s.items {
+		if todo.DeletedAt == "" && !todo.Completed && todo.DueAt != "" && todo.DueAt <= before {
+			todos = append(todos, todo)
+		}
+	}
+	return todos, nil
+}
+
+// keyAfter reports whether the todo sorts after the page key.
+func keyAfter(todo Todos, pageKey PageKey) bool {
+	if todo.Position != pageKey["Position"] {
+		return todo.Position > pageKey["Position"]
+	}
+	if todo.ID != pageKey["ID"] {
+		return todo.ID > pageKey["ID"]
+	}
+	return todo.Title > pageKey["Title"]
+}
+
+func (s *MemoryStore) LastPosition(owner string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	last := ""
+	for _, todo := range s.items {
+		if todo.Owner == owner && todo.Position > last {
+			last = todo.Position
+		}
+	}
+	return last, nil
+}
+
+func (s *MemoryStore) Update(change TodoChange) (Todos, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	return s.change(change)
+}
+
+func (s *MemoryStore) Rename(oldTitle string, todo Todos, version *int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldKey := itemKey{todo.ID, oldTitle}
+	newKey := itemKey{todo.ID, todo.Title}
+	old, ok := s.items[oldKey]
+	change := TodoChange{Owner: todo.Owner, Version: version}
+	if err := change.fails(old, ok); err != nil {
+		return err
+	}
+	if _, ok := s.items[newKey]; ok {
+		return ErrTitleExists
+	}
+	if err := s.refile(old, todo); err != nil {
+		return err
+	}
+
+	delete(s.items, oldKey)
+	s.items[newKey] = todo
+	s.record(&old, &todo, false)
+	return nil
+}
+
+func (s *MemoryStore) PutAll(todos []Todos) []error {
+	errs := make([]error, len(todos))
+	for i, todo := range todos {
+		errs[i] = s.Put(todo)
+	}
+	return errs
+}
+
+func (s *MemoryStore) UpdateAll(changes []TodoChange) []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, len(changes))
+	for i, change := range changes {
+		_, errs[i] = s.change(change)
+	}
+	return errs
+}
+
+func (s *MemoryStore) Delete(id string, title string, owner string, version *int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := itemKey{id, title}
+	item, ok := s.items[key]
+	if err := writeFails(item, ok, owner, version); err != nil {
+		return err
+	}
+	s.refile(item, Todos{})
+
+	delete(s.items, key)
+	s.record(&item, nil, false)
+	return nil
+}
+
+func (s *MemoryStore) Move(change TodoChange) (Todos, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	return s.change(change)
+}
+
+func (s *MemoryStore) PutList(list TodoList) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list.OwnerKey = ownerKey(list.Owner)
+	s.lists[list.ID] = list
+	return nil
+}
+
+func (s *MemoryStore) GetList(id string) (TodoList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, ok := s.lists[id]
+	if !ok {
+		return TodoList{}, ErrListNotFound
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) QueryLists(owner string) ([]TodoList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lists := []TodoList{}
+	for _, list := range s.lists {
+		if list.Owner == owner {
+			lists = append(lists, list)
+		}
+	}
+	return lists, nil
+}
+
+func (s *MemoryStore) UpdateList(list TodoList) (TodoList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.lists[list.ID]
+	if !ok || stored.Owner != list.Owner {
+		return TodoList{}, ErrListNotFound
+	}
+
+	stored.Name = list.Name
+	stored.UpdatedAt = list.UpdatedAt
+	s.lists[list.ID] = stored
+	return stored, nil
+}
+
+func (s *MemoryStore) DeleteList(id string, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, ok := s.lists[id]
+	if !ok || list.Owner != owner {
+		return ErrListNotFound
+	}
+	if list.TodoCount != 0 {
+		return ErrListNotEmpty
+	}
+
+	for key, todo := range s.items {
+		if todo.ListID == id && todo.DeletedAt != "" {
+			todo.ListID = ""
+			todo.Version++
+			s.write(key, todo)
+		}
+	}
+	delete(s.lists, id)
+	return nil
+}
+
+func (s *MemoryStore) PutKeyed(todo Todos, record IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if used, ok := s.keys[record.Key]; ok && used.ExpiresAt > time.Now().Unix() {
+		return ErrKeyUsed
+	}
+	key := itemKey{todo.ID, todo.Title}
+	if err := s.refile(s.items[key], todo); err != nil {
+		return err
+	}
+	s.write(key, todo)
+	s.keys[record.Key] = record
+	return nil
+}
+
+func (s *MemoryStore) GetIdempotencyRecord(key string) (IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.keys[key]
+	if !ok || record.ExpiresAt <= time.Now().Unix() {
+		return IdempotencyRecord{}, ErrNotFound
+	}
+	return record, nil
+}
+
+func (s *MemoryStore) PutUndo(action UndoAction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.undo[action.Key] = action
+	return nil
+}
+
+func (s *MemoryStore) GetUndo(key string) (UndoAction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	action, ok := s.undo[key]
+	if !ok || action.ExpiresAt <= time.Now().Unix() {
+		return UndoAction{}, ErrNotFound
+	}
+	return action, nil
+}
+
+// MemoryReminderLog is an in-memory ReminderLog.
+type MemoryReminderLog struct {
+	mu   sync.Mutex
+	sent map[string]int64
+}
+
+func NewMemoryReminderLog() *MemoryReminderLog {
+	return &MemoryReminderLog{sent: map[string]int64{}}
+}
+
+func (l *MemoryReminderLog) Claim(key string, expiresAt int64) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until, ok := l.sent[key]; ok && until > time.Now().Unix() {
+		return false, nil
+	}
+	l.sent[key] = expiresAt
+	return true, nil
+}
+
+func (l *MemoryReminderLog) Release(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.sent, key)
+	return nil
+}
+
+// MemorySearchIndex is an in-memory SearchIndex.
+type MemorySearchIndex struct {
+	mu sync.Mutex
+	// docs holds the indexed todos of each owner by ID
+	docs map[string]map[string]memorySearchDoc
+}
+
+type memorySearchDoc struct {
+	title   string
+	weights map[string]int
+}
+
+func NewMemorySearchIndex() *MemorySearchIndex {
+	return &MemorySearchIndex{docs: map[string]map[string]memorySearchDoc{}}
+}
+
+func (x *MemorySearchIndex) Index(todo Todos) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.docs[todo.Owner] == nil {
+		x.docs[todo.Owner] = map[string]memorySearchDoc{}
+	}
+	x.docs[todo.Owner][todo.ID] = memorySearchDoc{title: todo.Title, weights: indexTokens(todo)}
+	return nil
+}
+
+func (x *MemorySearchIndex) Remove(owner string, id string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	delete(x.docs[owner], id)
+	return nil
+}
+
+func (x *MemorySearchIndex) Match(owner string, prefix string) ([]SearchPosting, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	postings := []SearchPosting{}
+	for id, doc := range x.docs[owner] {
+		for token, weight := range doc.weights {
+			if strings.HasPrefix(token, prefix) {
+				postings = append(postings, SearchPosting{ID: id, Title: doc.title, Token: token, Weight: weight})
+			}
+		}
+	}
+	return postings, nil
+}
+
+// MemoryHistoryStore is an in-memory HistoryStore.
+type MemoryHistoryStore struct {
+	mu     sync.Mutex
+	events map[string][]TodoEvent
+}
+
+func NewMemoryHistoryStore() *MemoryHistoryStore {
+	return &MemoryHistoryStore{events: map[string][]TodoEvent{}}
+}
+
+func (x *MemoryHistoryStore) Append(event TodoEvent) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, recorded := range x.events[event.TodoID] {
+		if recorded.Key == event.Key {
+			return nil
+		}
+	}
+	x.events[event.TodoID] = append(x.events[event.TodoID], event)
+	return nil
+}
+
+// Events pages through the events newest first, the PageKey being the key
+// of the last event returned.
+func (x *MemoryHistoryStore) Events(id string, owner string, limit int64, startKey PageKey) ([]TodoEvent, PageKey, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	recorded := append([]TodoEvent{}, x.events[id]...)
+	sort.Slice(recorded, func(i, j int) bool {
+		return recorded[i].Key > recorded[j].Key
+	})
+
+	history := []TodoEvent{}
+	for _, event := range recorded {
+		if startKey != nil && event.Key >= startKey["EventKey"] {
+			continue
+		}
+		if event.Owner != owner {
+			continue
+		}
+		if len(history) > 0 && int64(len(history)) == limit {
+			last := history[len(history)-1]
+			return history, PageKey{"TodoId": last.TodoID, "EventKey": last.Key}, nil
+		}
+		history = append(history, event)
+	}
+	return history, nil, nil
+}
@@ -0,0 +1,140 @@
+package todo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider/cognitoidentityprovideriface"
+	"github.com/aws/aws-sdk-go/service/ses"
+	"github.com/aws/aws-sdk-go/service/ses/sesiface"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+)
+
+// LogNotifier prints reminders to the lambda log, for trying the job out.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(reminder Reminder) error {
+	fmt.Println("Reminder for " + reminder.Owner + ": " + reminder.Subject())
+	fmt.Print(reminder.Text())
+	return nil
+}
+
+// snsReminder is the JSON message published for a reminder.
+type snsReminder struct {
+	Owner   string  `json:"owner"`
+	Subject string  `json:"subject"`
+	Text    string  `json:"text"`
+	Overdue []Todos `json:"overdue,omitempty"`
+	DueSoon []Todos `json:"dueSoon,omitempty"`
+}
+
+// SNSNotifier publishes reminders as JSON to an SNS topic. The owner is
+// also a message attribute, for subscription filter policies.
+type SNSNotifier struct {
+	Client   snsiface.SNSAPI
+	TopicARN string
+}
+
+func (n *SNSNotifier) Notify(reminder Reminder) error {
+	message, err := json.Marshal(snsReminder{
+		Owner:   reminder.Owner,
+		Subject: reminder.Subject(),
+		Text:    reminder.Text(),
+		Overdue: reminder.Overdue,
+		DueSoon: reminder.DueSoon,
+	})
+	if err != nil {
+		return err
+	}
+
+	input := &sns.PublishInput{
+		TopicArn: aws.String(n.TopicARN),
+		Subject:  aws.String(reminder.Subject()),
+		Message:  aws.String(string(message)),
+		MessageAttributes: map[string]*sns.MessageAttributeValue{
+			"owner": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(reminder.Owner),
+			},
+		},
+	}
+	if reminder.Owner == "" {
+		// Attribute values cannot be empty
+		input.MessageAttributes = nil
+	}
+
+	_, err = n.Client.Publish(input)
+	return err
+}
+
+// EmailNotifier emails reminders through SES from the From address.
+// AddressOf returns the email address of an owner, or "" for owners that
+// cannot be emailed, whose reminders are dropped.
+type EmailNotifier struct {
+	Client    sesiface.SESAPI
+	From      string
+	AddressOf func(owner string) (string, error)
+}
+
+func (n *EmailNotifier) Notify(reminder Reminder) error {
+	address, err := n.AddressOf(reminder.Owner)
+	if err != nil {
+		return err
+	}
+	if address == "" {
+		fmt.Println("No email address for " + reminder.Owner + ", dropping reminder")
+		return nil
+	}
+
+	input := &ses.SendEmailInput{
+		Source: aws.String(n.From),
+		Destination: &ses.Destination{
+			ToAddresses: []*string{aws.String(address)},
+		},
+		Message: &ses.Message{
+			Subject: &ses.Content{
+				Data: aws.String(reminder.Subject()),
+			},
+			Body: &ses.Body{
+				Text: &ses.Content{
+					Data: aws.String(reminder.Text()),
+				},
+			},
+		},
+	}
+
+	_, err = n.Client.SendEmail(input)
+	return err
+}
+
+// CognitoEmails returns an EmailNotifier.AddressOf looking owners up by
+// their sub in a Cognito user pool.
+func CognitoEmails(client cognitoidentityprovideriface.CognitoIdentityProviderAPI, userPoolID string) func(owner string) (string, error) {
+	return func(owner string) (string, error) {
+		if owner == "" {
+			return "", nil
+		}
+
+		input := &cognitoidentityprovider.ListUsersInput{
+			UserPoolId:      aws.String(userPoolID),
+			Filter:          aws.String(fmt.Sprintf("sub = %q", owner)),
+			AttributesToGet: []*string{aws.String("email")},
+			Limit:           aws.Int64(1),
+		}
+		result, err := client.ListUsers(input)
+		if err != nil {
+			return "", err
+		}
+		for _, user := range result.Users {
+			for _, attr := range user.Attributes {
+				if aws.StringValue(attr.Name) == "email" {
+					return aws.StringValue(attr.Value), nil
+				}
+			}
+		}
+		return "", nil
+	}
+}
@@ -0,0 +1,387 @@
+package todo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// PositionIndexName is the global secondary index of the Todos table on
+// OwnerKey and Position, which lists the todos of an owner in order.
+const PositionIndexName = "PositionIndex"
+
+// Positions are fractional index keys: strings that sort in the order of
+// the todos, where a key can always be made between two others, so moving
+// a todo rewrites that todo only. A key is an integer part, whose head
+// letter tells its length, followed by a fraction in base 62 digits that
+// never ends in 0. Appending to the end increments the integer part, which
+// keeps keys short however many todos are added.
+const positionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const (
+	firstPosition    = "a0"
+	smallestPosition = "A00000000000000000000000000"
+)
+
+var (
+	ErrInvalidPosition   = errors.New("Invalid position")
+	ErrNeighborNotFound  = errors.New("Neighbour not found")
+	ErrNeighborsReversed = errors.New("Neighbours are out of order")
+)
+
+// ownerKey is the OwnerKey of the todos of owner. Key attributes cannot be
+// empty, so the prefix also covers todos without an owner.
+func ownerKey(owner string) string {
+	return "owner#" + owner
+}
+
+// StatusIndexName is the global secondary index of the Todos table on
+// Status and Position, which lists the open or the completed todos of an
+// owner in order without reading the others.
+const StatusIndexName = "StatusIndex"
+
+// statusKey is the Status of the todos of owner that are completed or not.
+func statusKey(owner string, completed bool) string {
+	if completed {
+		return ownerKey(owner) + "#done"
+	}
+	return ownerKey(owner) + "#open"
+}
+
+func integerLength(head byte) (int, error) {
+	if head >= 'a' && head <= 'z' {
+		return int(head-'a') + 2, nil
+	}
+	if head >= 'A' && head <= 'Z' {
+		return int('Z'-head) + 2, nil
+	}
+	return 0, ErrInvalidPosition
+}
+
+func integerPart(key string) (string, error) {
+	if key == "" {
+		return "", ErrInvalidPosition
+	}
+	n, err := integerLength(key[0])
+	if err != nil || n > len(key) {
+		return "", ErrInvalidPosition
+	}
+	return key[:n], nil
+}
+
+func validatePosition(key string) error {
+	if key == smallestPosition {
+		return ErrInvalidPosition
+	}
+	integer, err := integerPart(key)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(key[len(integer):], "0") {
+		return ErrInvalidPosition
+	}
+	for i := 1; i < len(key); i++ {
+		if strings.IndexByte(positionDigits, key[i]) < 0 {
+			return ErrInvalidPosition
+		}
+	}
+	return nil
+}
+
+// incrementInteger returns the integer after x, or "" when x is the
+// largest integer there is.
+func incrementInteger(x string) string {
+	head, digits := x[0], []byte(x[1:])
+	carry := true
+	for i := len(digits) - 1; carry && i >= 0; i-- {
+		d := strings.IndexByte(positionDigits, digits[i]) + 1
+		if d == len(positionDigits) {
+			digits[i] = '0'
+		} else {
+			digits[i] = positionDigits[d]
+			carry = false
+		}
+	}
+	if !carry {
+		return string(head) + string(digits)
+	}
+	if head == 'Z' {
+		return "a0"
+	}
+	if head == 'z' {
+		return ""
+	}
+	head++
+	if head > 'a' {
+		digits = append(digits, '0')
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+	return string(head) + string(digits)
+}
+
+// decrementInteger returns the integer before x, or "" when x is the
+// smallest integer there is.
+func decrementInteger(x string) string {
+	head, digits := x[0], []byte(x[1:])
+	borrow := true
+	for i := len(digits) - 1; borrow && i >= 0; i-- {
+		d := strings.IndexByte(positionDigits, digits[i]) - 1
+		if d == -1 {
+			digits[i] = positionDigits[len(positionDigits)-1]
+		} else {
+			digits[i] = positionDigits[d]
+			borrow = false
+		}
+	}
+	if !borrow {
+		return string(head) + string(digits)
+	}
+	if head == 'a' {
+		return "Z" + positionDigits[len(positionDigits)-1:]
+	}
+	if head == 'A' {
+		return ""
+	}
+	head--
+	if head < 'Z' {
+		digits = append(digits, positionDigits[len(positionDigits)-1])
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+	return string(head) + string(digits)
+}
+
+// midpoint returns a fraction between the fractions a and b, where an
+// empty b stands for 1.
+func midpoint(a string, b string) string {
+	if b != "" {
+		// Copy the common prefix, reading missing digits of a as 0
+		n := 0
+		for n < len(b) {
+			digit := byte('0')
+			if n < len(a) {
+				digit = a[n]
+			}
+			if digit != b[n] {
+				break
+			}
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + midpoint(rest, b[n:])
+		}
+	}
+
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(positionDigits, a[0])
+	}
+	digitB := len(positionDigits)
+	if b != "" {
+		digitB = strings.IndexByte(positionDigits, b[0])
+	}
+	if digitB-digitA > 1 {
+		return string(positionDigits[(digitA+digitB+1)/2])
+	}
+
+	// Consecutive digits: a digit of b followed by more sorts below b,
+	// otherwise go one digit deeper after a
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(positionDigits[digitA]) + midpoint(rest, "")
+}
+
+// positionBetween returns a position sorting after a and before b. An
+// empty a means the start and an empty b the end.
+func positionBetween(a string, b string) (string, error) {
+	if a != "" {
+		if err := validatePosition(a); err != nil {
+			return "", err
+		}
+	}
+	if b != "" {
+		if err := validatePosition(b); err != nil {
+			return "", err
+		}
+	}
+	if a != "" && b != "" && a >= b {
+		return "", ErrNeighborsReversed
+	}
+
+	if a == "" && b == "" {
+		return firstPosition, nil
+	}
+	if a == "" {
+		ib, _ := integerPart(b)
+		fb := b[len(ib):]
+		if ib == smallestPosition {
+			return ib + midpoint("", fb), nil
+		}
+		if ib < b {
+			return ib, nil
+		}
+		prev := decrementInteger(ib)
+		if prev == "" {
+			return "", ErrInvalidPosition
+		}
+		return prev, nil
+	}
+	ia, _ := integerPart(a)
+	fa := a[len(ia):]
+	if b == "" {
+		next := incrementInteger(ia)
+		if next == "" {
+			return ia + midpoint(fa, ""), nil
+		}
+		return next, nil
+	}
+	ib, _ := integerPart(b)
+	fb := b[len(ib):]
+	if ia == ib {
+		return ia + midpoint(fa, fb), nil
+	}
+	next := incrementInteger(ia)
+	if next == "" {
+		return "", ErrInvalidPosition
+	}
+	if next < b {
+		return next, nil
+	}
+	return ia + midpoint(fa, ""), nil
+}
+
+// appendPositions places the todos, in order, after the last todo of
+// owner.
+func (h *Handler) appendPositions(owner string, todos []Todos) error {
+	last, err := h.Store.LastPosition(owner)
+	if err != nil {
+		return err
+	}
+	for i := range todos {
+		position, err := positionBetween(last, "")
+		if err != nil {
+			return err
+		}
+		todos[i].Position = position
+		last = position
+	}
+	return nil
+}
+
+// TodoReorder is the body of a reorder request: the todo moves between the
+// todos with IDs After and Before. Without After it moves to the start and
+// without Before to the end.
+type TodoReorder struct {
+	Title   string `json:"title"`
+	After   string `json:"after"`
+	Before  string `json:"before"`
+	Version *int64 `json:"version"`
+}
+
+// neighbor returns the position of the todo with the given ID, or "" for
+// no ID. A neighbour that is gone or never got a position answers 409,
+// the client has to reload its order, and so does an ID on more than one
+// todo.
+func (h *Handler) neighbor(owner string, id string) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	todo, err := h.todoByID(owner, id, false)
+	if apiErr, ok := err.(*apierror.Error); ok && apiErr.Code == apierror.NotFound {
+		return "", ErrNeighborNotFound
+	} else if err != nil {
+		return "", err
+	}
+	if todo.Position == "" {
+		return "", ErrNeighborNotFound
+	}
+	return todo.Position, nil
+}
+
+// ReorderTodo moves the todo between its new neighbours by giving it a
+// position between theirs. No other todo is written.
+func (h *Handler) ReorderTodo(owner string, id string, reorder TodoReorder) (events.APIGatewayProxyResponse, error) {
+	after, err := h.neighbor(owner, reorder.After)
+	if err == nil {
+		var before string
+		before, err = h.neighbor(owner, reorder.Before)
+		if err == nil {
+			var position string
+			position, err = positionBetween(after, before)
+			if err == nil {
+				change := TodoChange{
+					Owner:     owner,
+					ID:        id,
+					Title:     reorder.Title,
+					Position:  position,
+					UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+					Actor:     owner,
+					Version:   reorder.Version,
+				}
+				fmt.Println("Reordering: " + id + " - " + reorder.Title + " to " + position)
+				return h.UpdateTodo(change)
+			}
+		}
+	}
+
+	if err == ErrNeighborNotFound || err == ErrNeighborsReversed {
+		return errorResponse(apierror.Conflict, err)
+	}
+	return errorResponse(apierror.Internal, err)
+}
+
+// HandleReorderTodoRequest moves the todo named by the {id} path parameter
+// between the todos named in the body.
+func (h *Handler) HandleReorderTodoRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "POST" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	reorder := TodoReorder{}
+	err := json.Unmarshal([]byte(request.Body), &reorder)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+	owner := CallerID(request)
+	id := request.PathParameters["id"]
+
+	if reorder.After == "" && reorder.Before == "" {
+		err := errors.New("After or before not specified")
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+	if reorder.After == id || reorder.Before == id {
+		err := errors.New("Todo cannot be its own neighbour")
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+
+	version, err := requestVersion(request, reorder.Version)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+	reorder.Version = version
+
+	if reorder.Title == "" {
+		title, err := h.titleOf(owner, id)
+		if err != nil {
+			return errorResponse(apierror.Internal, err)
+		}
+		reorder.Title = title
+	}
+
+	return h.ReorderTodo(owner, id, reorder)
+}
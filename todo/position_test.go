@@ -0,0 +1,65 @@
+package todo
+
+import "testing"
+
+func TestPositionBetween(t *testing.T) {
+	cases := []struct {
+		a, b string
+	}{
+		{"", ""},
+		{"", "a0"},
+		{"a0", ""},
+		{"a0", "a1"},
+		{"a0", "a0V"},
+		{"a1", "a2"},
+		{"Zz", "a0"},
+		{"az", "b00"},
+		{"", smallestPosition + "1"},
+		{"zzzzzzzzzzzzzzzzzzzzzzzzzzz", ""},
+	}
+	for _, c := range cases {
+		p, err := positionBetween(c.a, c.b)
+		if err != nil {
+			t.Errorf("between %q and %q: %v", c.a, c.b, err)
+			continue
+		}
+		if validatePosition(p) != nil || (c.a != "" && p <= c.a) || (c.b != "" && p >= c.b) {
+			t.Errorf("between %q and %q: got %q", c.a, c.b, p)
+		}
+	}
+}
+
+func TestPositionBetweenRepeatedly(t *testing.T) {
+	// Inserting at the same spot over and over keeps finding room
+	for _, towardsA := range []bool{true, false} {
+		a, b := "a0", "a1"
+		for i := 0; i < 100; i++ {
+			p, err := positionBetween(a, b)
+			if err != nil || p <= a || p >= b {
+				t.Fatalf("between %q and %q: got %q %v", a, b, p, err)
+			}
+			if towardsA {
+				b = p
+			} else {
+				a = p
+			}
+		}
+	}
+}
+
+func TestPositionBetweenErrors(t *testing.T) {
+	cases := []struct {
+		a, b string
+		err  error
+	}{
+		{"a1", "a0", ErrNeighborsReversed},
+		{"a0", "a0", ErrNeighborsReversed},
+		{"a0!", "", ErrInvalidPosition},
+		{"", "a", ErrInvalidPosition},
+	}
+	for _, c := range cases {
+		if _, err := positionBetween(c.a, c.b); err != c.err {
+			t.Errorf("between %q and %q: got %v, want %v", c.a, c.b, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package todo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// indexWait is how often Provision polls for a new index to become active.
+const indexWait = 5 * time.Second
+
+// TableSchema is a table of the todo API with its TTL attribute, if any.
+type TableSchema struct {
+	Create       *dynamodb.CreateTableInput
+	TTLAttribute string
+}
+
+func stringAttr(name string) *dynamodb.AttributeDefinition {
+	return &dynamodb.AttributeDefinition{AttributeName: aws.String(name), AttributeType: aws.String("S")}
+}
+
+func keySchema(hash string, rang string) []*dynamodb.KeySchemaElement {
+	schema := []*dynamodb.KeySchemaElement{
+		{AttributeName: aws.String(hash), KeyType: aws.String("HASH")},
+	}
+	if rang != "" {
+		schema = append(schema, &dynamodb.KeySchemaElement{AttributeName: aws.String(rang), KeyType: aws.String("RANGE")})
+	}
+	return schema
+}
+
+func globalIndex(name string, hash string, rang string) *dynamodb.GlobalSecondaryIndex {
+	return &dynamodb.GlobalSecondaryIndex{
+		IndexName:  aws.String(name),
+		KeySchema:  keySchema(hash, rang),
+		Projection: &dynamodb.Projection{ProjectionType: aws.String("ALL")},
+	}
+}
+
+// TableSchemas returns the tables the todo lambdas use, billed on demand.
+func TableSchemas() []TableSchema {
+	return []TableSchema{
+		{
+			Create: &dynamodb.CreateTableInput{
+				TableName: aws.String(TableName),
+				AttributeDefinitions: []*dynamodb.AttributeDefinition{
+					stringAttr("ID"), stringAttr("Title"), stringAttr("ListId"), stringAttr("ParentId"),
+					stringAttr("OwnerKey"), stringAttr("Position"), stringAttr("Status"),
+					stringAttr("DueShard"), stringAttr("DueAt"),
+				},
+				KeySchema: keySchema("ID", "Title"),
+				GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+					globalIndex(ListIndexName, "ListId", ""),
+					globalIndex(ParentIndexName, "ParentId", ""),
+					globalIndex(PositionIndexName, "OwnerKey", "Position"),
+					globalIndex(StatusIndexName, "Status", "Position"),
+					globalIndex(DueIndexName, "DueShard", "DueAt"),
+				},
+				BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+				// The history lambda consumes the stream
+				StreamSpecification: &dynamodb.StreamSpecification{
+					StreamEnabled:  aws.Bool(true),
+					StreamViewType: aws.String(dynamodb.StreamViewTypeNewAndOldImages),
+				},
+			},
+			TTLAttribute: "ExpiresAt",
+		},
+		{
+			Create: &dynamodb.CreateTableInput{
+				TableName:            aws.String(ListTableName),
+				AttributeDefinitions: []*dynamodb.AttributeDefinition{stringAttr("ID"), stringAttr("OwnerKey"), stringAttr("CreatedAt")},
+				KeySchema:            keySchema("ID", ""),
+				GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+					globalIndex(ListOwnerIndexName, "OwnerKey", "CreatedAt"),
+				},
+				BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+			},
+		},
+		{
+			Create: &dynamodb.CreateTableInput{
+				TableName:            aws.String(SearchTableName),
+				AttributeDefinitions: []*dynamodb.AttributeDefinition{stringAttr("PK"), stringAttr("SK")},
+				KeySchema:            keySchema("PK", "SK"),
+				BillingMode:          aws.String(dynamodb.BillingModePayPerRequest),
+			},
+		},
+		{
+			Create: &dynamodb.CreateTableInput{
+				TableName:            aws.String(ReminderTableName),
+				AttributeDefinitions: []*dynamodb.AttributeDefinition{stringAttr("Key")},
+				KeySchema:            keySchema("Key", ""),
+				BillingMode:          aws.String(dynamodb.BillingModePayPerRequest),
+			},
+			TTLAttribute: "ExpiresAt",
+		},
+		{
+			Create: &dynamodb.CreateTableInput{
+				TableName:            aws.String(HistoryTableName),
+				AttributeDefinitions: []*dynamodb.AttributeDefinition{stringAttr("TodoId"), stringAttr("EventKey")},
+				KeySchema:            keySchema("TodoId", "EventKey"),
+				BillingMode:          aws.String(dynamodb.BillingModePayPerRequest),
+			},
+		},
+		{
+			Create: &dynamodb.CreateTableInput{
+				TableName:            aws.String(IdempotencyTableName),
+				AttributeDefinitions: []*dynamodb.AttributeDefinition{stringAttr("Key")},
+				KeySchema:            keySchema("Key", ""),
+				BillingMode:          aws.String(dynamodb.BillingModePayPerRequest),
+			},
+			TTLAttribute: "ExpiresAt",
+		},
+		{
+			Create: &dynamodb.CreateTableInput{
+				TableName:            aws.String(UndoTableName),
+				AttributeDefinitions: []*dynamodb.AttributeDefinition{stringAttr("Key")},
+				KeySchema:            keySchema("Key", ""),
+				BillingMode:          aws.String(dynamodb.BillingModePayPerRequest),
+			},
+			TTLAttribute: "ExpiresAt",
+		},
+	}
+}
+
+func isNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException
+}
+
+// Provision creates the tables that are missing and adds the indexes that
+// are missing from existing tables, one at a time as DynamoDB requires,
+// waiting for each to become active. It works the same against DynamoDB
+// Local. Streams are enabled on existing tables as well. Progress is
+// printed; running it again only does what is left.
+func Provision(db dynamodbiface.DynamoDBAPI) error {
+	for _, schema := range TableSchemas() {
+		name := aws.StringValue(schema.Create.TableName)
+		described, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: schema.Create.TableName})
+		if isNotFound(err) {
+			fmt.Println("Creating table " + name)
+			_, err = db.CreateTable(schema.Create)
+			if err != nil {
+				return err
+			}
+			err = db.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: schema.Create.TableName})
+		} else if err == nil {
+			err = provisionIndexes(db, schema.Create, described.Table)
+			if err == nil {
+				err = provisionStream(db, schema.Create, described.Table)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if schema.TTLAttribute != "" {
+			err = provisionTTL(db, name, schema.TTLAttribute)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// provisionIndexes adds the indexes of the schema the table lacks. On a
+// table with provisioned capacity an index gets the capacity of the table.
+func provisionIndexes(db dynamodbiface.DynamoDBAPI, schema *dynamodb.CreateTableInput, table *dynamodb.TableDescription) error {
+	existing := map[string]bool{}
+	for _, index := range table.GlobalSecondaryIndexes {
+		existing[aws.StringValue(index.IndexName)] = true
+	}
+	onDemand := table.BillingModeSummary != nil &&
+		aws.StringValue(table.BillingModeSummary.BillingMode) == dynamodb.BillingModePayPerRequest
+
+	for _, index := range schema.GlobalSecondaryIndexes {
+		name := aws.StringValue(index.IndexName)
+		if existing[name] {
+			continue
+		}
+
+		create := &dynamodb.CreateGlobalSecondaryIndexAction{
+			IndexName:  index.IndexName,
+			KeySchema:  index.KeySchema,
+			Projection: index.Projection,
+		}
+		if !onDemand && table.ProvisionedThroughput != nil {
+			create.ProvisionedThroughput = &dynamodb.ProvisionedThroughput{
+				ReadCapacityUnits:  table.ProvisionedThroughput.ReadCapacityUnits,
+				WriteCapacityUnits: table.ProvisionedThroughput.WriteCapacityUnits,
+			}
+		}
+
+		fmt.Println("Creating index " + name + " on " + aws.StringValue(table.TableName))
+		_, err := db.UpdateTable(&dynamodb.UpdateTableInput{
+			TableName:                   table.TableName,
+			AttributeDefinitions:        schema.AttributeDefinitions,
+			GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{{Create: create}},
+		})
+		if err != nil {
+			return err
+		}
+		err = waitForIndex(db, aws.StringValue(table.TableName), name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// provisionStream enables the stream of the schema on a table without one.
+// A table streaming another view is left alone, as its stream would have
+// to be disabled first, and reported.
+func provisionStream(db dynamodbiface.DynamoDBAPI, schema *dynamodb.CreateTableInput, table *dynamodb.TableDescription) error {
+	want := schema.StreamSpecification
+	if want == nil {
+		return nil
+	}
+	name := aws.StringValue(table.TableName)
+	have := table.StreamSpecification
+	if have != nil && aws.BoolValue(have.StreamEnabled) {
+		if aws.StringValue(have.StreamViewType) != aws.StringValue(want.StreamViewType) {
+			fmt.Println("Stream of " + name + " is " + aws.StringValue(have.StreamViewType) +
+				", not " + aws.StringValue(want.StreamViewType))
+		}
+		return nil
+	}
+
+	fmt.Println("Enabling stream on " + name)
+	_, err := db.UpdateTable(&dynamodb.UpdateTableInput{
+		TableName:           table.TableName,
+		StreamSpecification: want,
+	})
+	if err != nil {
+		return err
+	}
+	return db.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: table.TableName})
+}
+
+func waitForIndex(db dynamodbiface.DynamoDBAPI, table string, index string) error {
+	for {
+		described, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+		if err != nil {
+			return err
+		}
+		for _, gsi := range described.Table.GlobalSecondaryIndexes {
+			if aws.StringValue(gsi.IndexName) == index && aws.StringValue(gsi.IndexStatus) == dynamodb.IndexStatusActive {
+				return nil
+			}
+		}
+		fmt.Println("Waiting for index " + index + " to become active")
+		time.Sleep(indexWait)
+	}
+}
+
+// provisionTTL enables TTL on the attribute unless it is enabled already.
+func provisionTTL(db dynamodbiface.DynamoDBAPI, table string, attr string) error {
+	described, err := db.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{TableName: aws.String(table)})
+	if err != nil {
+		return err
+	}
+	status := aws.StringValue(described.TimeToLiveDescription.TimeToLiveStatus)
+	if status == dynamodb.TimeToLiveStatusEnabled || status == dynamodb.TimeToLiveStatusEnabling {
+		return nil
+	}
+
+	fmt.Println("Enabling TTL on " + table + "." + attr)
+	_, err = db.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(table),
+		TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+			AttributeName: aws.String(attr),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	return err
+}
@@ -0,0 +1,202 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	uuid "github.com/satori/go.uuid"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// ErrSeriesEnded is returned when a recurring todo has no occurrence left
+// to skip to.
+var ErrSeriesEnded = errors.New("Recurring todo has no more occurrences")
+
+// nextDueAt returns the due date (RFC 3339, UTC) of the occurrence after
+// the recurring todo, and false once its series is over. Dates are worked
+// out in the time zone of the todo, so a chore due at 09:00 stays at 09:00
+// local time when daylight saving time starts or ends.
+func nextDueAt(todo Todos) (string, bool, error) {
+	rule, err := ParseRecurrence(todo.Recurrence)
+	if err != nil {
+		return "", false, err
+	}
+	loc := time.UTC
+	if todo.TimeZone != "" {
+		loc, err = time.LoadLocation(todo.TimeZone)
+		if err != nil {
+			return "", false, err
+		}
+	}
+	due, err := time.Parse(time.RFC3339, todo.DueAt)
+	if err != nil {
+		return "", false, errors.New("Recurring todo has no valid dueAt")
+	}
+
+	occurrence := todo.Occurrence
+	if occurrence == 0 {
+		occurrence = 1
+	}
+	next, ok := rule.Next(due.In(loc), occurrence)
+	if !ok {
+		return "", false, nil
+	}
+	return next.UTC().Format(time.RFC3339), true, nil
+}
+
+// recur creates the next occurrence of a recurring todo that was just
+// completed and links it from the completed todo as NextID. It returns the
+// completed todo as written and the new one, or nil when there is none:
+// the todo does not recur, already started its next occurrence or its
+// series is over. Like rollup it is best effort, the completion stands.
+func (h *Handler) recur(todo Todos) (Todos, *Todos) {
+	if todo.Recurrence == "" || !todo.Completed || todo.NextID != "" || todo.DeletedAt != "" {
+		return todo, nil
+	}
+
+	dueAt, ok, err := nextDueAt(todo)
+	if err != nil {
+		fmt.Println("Got error recurring " + todo.ID + ": " + err.Error())
+		return todo, nil
+	}
+	if !ok {
+		fmt.Println("Series ended: " + todo.ID + " - " + todo.Title)
+		return todo, nil
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		fmt.Println("Got error recurring " + todo.ID + ": " + err.Error())
+		return todo, nil
+	}
+	next := newTodo(Todos{
+		Owner:        todo.Owner,
+		Title:        todo.Title,
+		ListID:       todo.ListID,
+		ParentID:     todo.ParentID,
+		AutoComplete: todo.AutoComplete,
+		Description:  todo.Description,
+		DueAt:        dueAt,
+		Priority:     todo.Priority,
+		Tags:         todo.Tags,
+		Recurrence:   todo.Recurrence,
+		TimeZone:     todo.TimeZone,
+	}, id.String(), time.Now())
+	next.Occurrence = todo.Occurrence + 1
+	if todo.Occurrence == 0 {
+		next.Occurrence = 2
+	}
+	next.UpdatedBy = ActorRecurrence
+	todos := []Todos{next}
+	if err := h.appendPositions(todo.Owner, todos); err != nil {
+		fmt.Println("Got error recurring " + todo.ID + ": " + err.Error())
+		return todo, nil
+	}
+	next = todos[0]
+
+	fmt.Println("Recurring: " + todo.ID + " - " + todo.Title + " as " + next.ID + " due " + next.DueAt)
+	err = h.Store.Put(next)
+	if err != nil {
+		fmt.Println("Got error recurring " + todo.ID + ": " + err.Error())
+		return todo, nil
+	}
+	h.rollup(next)
+	h.reindex(next)
+
+	change := TodoChange{
+		Owner:     todo.Owner,
+		ID:        todo.ID,
+		Title:     todo.Title,
+		UpdatedAt: next.CreatedAt,
+		Actor:     ActorRecurrence,
+		NextID:    next.ID,
+	}
+	linked, err := h.Store.Update(change)
+	if err != nil {
+		fmt.Println("Got error linking " + todo.ID + " to " + next.ID + ": " + err.Error())
+		return todo, &next
+	}
+	return linked, &next
+}
+
+// SkipTodo moves a recurring todo on to its next occurrence without
+// completing it.
+func (h *Handler) SkipTodo(ref TodoRef) (events.APIGatewayProxyResponse, error) {
+	current, err := h.Store.Get(ref.ID, ref.Title)
+	if err == nil && (current.Owner != ref.Owner || current.DeletedAt != "") {
+		err = ErrNotFound
+	}
+	if err == ErrNotFound {
+		return errorResponse(apierror.NotFound, err)
+	} else if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	if current.Recurrence == "" {
+		err := errors.New("Todo does not recur")
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+
+	dueAt, ok, err := nextDueAt(current)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+	if !ok {
+		return errorResponse(apierror.Conflict, ErrSeriesEnded)
+	}
+
+	// Without a version the skip is still tied to the occurrence read
+	// here, so two skips at once do not skip twice
+	version := ref.Version
+	if version == nil {
+		version = &current.Version
+	}
+	occurrence := current.Occurrence + 1
+	if current.Occurrence == 0 {
+		occurrence = 2
+	}
+	change := TodoChange{
+		Owner:      ref.Owner,
+		ID:         ref.ID,
+		Title:      ref.Title,
+		DueAt:      &dueAt,
+		Occurrence: occurrence,
+		UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
+		Actor:      ref.Owner,
+		Version:    version,
+	}
+
+	fmt.Println("Skipping: " + ref.ID + " - " + ref.Title + " to " + dueAt)
+	return h.UpdateTodo(change)
+}
+
+// HandleSkipTodoRequest skips the todo named by the {id} path parameter to
+// its next occurrence.
+func (h *Handler) HandleSkipTodoRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "POST" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	ref, err := parseRef(request)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+	ref.Owner = CallerID(request)
+
+	version, err := requestVersion(request, ref.Version)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+	ref.Version = version
+
+	if ref.Title == "" {
+		title, err := h.titleOf(ref.Owner, ref.ID)
+		if err != nil {
+			return errorResponse(apierror.Internal, err)
+		}
+		ref.Title = title
+	}
+
+	return h.SkipTodo(ref)
+}
@@ -0,0 +1,239 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// ReminderTableName is the DynamoDB table remembering the reminders sent,
+// keyed by Key with a TTL on ExpiresAt.
+const ReminderTableName = "TodoReminders"
+
+const (
+	defaultReminderWindow = 24 * time.Hour
+
+	// reminderRetention is how long a sent reminder is remembered. A todo
+	// that stays overdue longer is reminded of again.
+	reminderRetention = 30 * 24 * time.Hour
+)
+
+// DueIndexName is the global secondary index of the Todos table on
+// DueShard and DueAt, which holds the open todos with a due date, so the
+// reminder job reads the todos falling due instead of the whole table.
+const DueIndexName = "DueIndex"
+
+// dueShards spreads the open todos over this many DueShard values, as a
+// single hash key would put them all in one partition of the index.
+const dueShards = 8
+
+// dueShard is the DueShard of the todo with the ID while it is open.
+func dueShard(id string) string {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return dueShardKey(int(h.Sum32() % dueShards))
+}
+
+func dueShardKey(shard int) string {
+	return "due#" + strconv.Itoa(shard)
+}
+
+// ReminderWindowFromEnv reads the REMINDER_WINDOW_HOURS environment
+// variable of the lambda, returning zero (the default window) when unset.
+func ReminderWindowFromEnv() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("REMINDER_WINDOW_HOURS"))
+	if err != nil || hours <= 0 {
+		return 0
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// Reminder is the notification for one owner: the open todos that are
+// overdue, and those falling due within the reminder window.
+type Reminder struct {
+	Owner   string
+	Overdue []Todos
+	DueSoon []Todos
+}
+
+// Subject is a one line summary of the reminder.
+func (r Reminder) Subject() string {
+	n := len(r.Overdue) + len(r.DueSoon)
+	if n == 1 {
+		return "1 todo needs your attention"
+	}
+	return fmt.Sprintf("%d todos need your attention", n)
+}
+
+// Text lists the todos of the reminder, overdue ones first.
+func (r Reminder) Text() string {
+	var b strings.Builder
+	sections := []struct {
+		heading string
+		todos   []Todos
+	}{
+		{"Overdue", r.Overdue},
+		{"Due soon", r.DueSoon},
+	}
+	for _, section := range sections {
+		if len(section.todos) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(section.heading + ":\n")
+		for _, todo := range section.todos {
+			b.WriteString("- " + todo.Title + " (due " + todo.DueAt + ")\n")
+		}
+	}
+	return b.String()
+}
+
+// Notifier delivers reminders, e.g. to a log, an SNS topic or by email.
+type Notifier interface {
+	Notify(reminder Reminder) error
+}
+
+// ReminderLog remembers which reminders were sent, so a reminder goes out
+// once however often the job runs.
+type ReminderLog interface {
+	// Claim records the reminder under key until expiresAt (Unix seconds),
+	// returning false when it was already recorded.
+	Claim(key string, expiresAt int64) (bool, error)
+	// Release forgets a claimed reminder that could not be sent, so the
+	// next run tries it again.
+	Release(key string) error
+}
+
+// reminderKey identifies the reminder for a todo at its current due date.
+// Moving the due date, as recurring todos do, makes a new reminder.
+func reminderKey(todo Todos, kind string) string {
+	return todo.ID + "#" + todo.DueAt + "#" + kind
+}
+
+// Reminders is the scheduled job reminding owners of their due and
+// overdue todos.
+type Reminders struct {
+	Store    TodoStore
+	Log      ReminderLog
+	Notifier Notifier
+	// Window is how far ahead todos count as due soon, 24 hours when zero.
+	Window time.Duration
+}
+
+func (r *Reminders) window() time.Duration {
+	if r.Window > 0 {
+		return r.Window
+	}
+	return defaultReminderWindow
+}
+
+// Run sends the reminders due at now and returns how many were sent. A
+// failure for one todo or owner does not hold up the others; the first
+// error is returned once all were tried. A todo whose reminder could not
+// be claimed is left unclaimed, for the next run to try again.
+func (r *Reminders) Run(now time.Time) (int, error) {
+	now = now.UTC()
+	todos, err := r.Store.DueTodos(now.Add(r.window()).Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+
+	reminders := map[string]*Reminder{}
+	keys := map[string][]string{}
+	var firstErr error
+	expiresAt := now.Add(reminderRetention).Unix()
+	for _, todo := range todos {
+		kind := "due"
+		if todo.DueAt <= now.Format(time.RFC3339) {
+			kind = "overdue"
+		}
+		key := reminderKey(todo, kind)
+		claimed, err := r.Log.Claim(key, expiresAt)
+		if err != nil {
+			fmt.Println("Got error claiming reminder " + key + ": " + err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		reminder := reminders[todo.Owner]
+		if reminder == nil {
+			reminder = &Reminder{Owner: todo.Owner}
+			reminders[todo.Owner] = reminder
+		}
+		if kind == "overdue" {
+			reminder.Overdue = append(reminder.Overdue, todo)
+		} else {
+			reminder.DueSoon = append(reminder.DueSoon, todo)
+		}
+		keys[todo.Owner] = append(keys[todo.Owner], key)
+	}
+
+	owners := []string{}
+	for owner := range reminders {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	sent := 0
+	for _, owner := range owners {
+		reminder := reminders[owner]
+		sortByDue(reminder.Overdue)
+		sortByDue(reminder.DueSoon)
+
+		err := r.Notifier.Notify(*reminder)
+		if err != nil {
+			fmt.Println("Got error reminding " + owner + ": " + err.Error())
+			for _, key := range keys[owner] {
+				if err := r.Log.Release(key); err != nil {
+					fmt.Println("Got error releasing reminder " + key + ": " + err.Error())
+				}
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		sent++
+	}
+	return sent, firstErr
+}
+
+func sortByDue(todos []Todos) {
+	sort.Slice(todos, func(i, j int) bool {
+		if todos[i].DueAt != todos[j].DueAt {
+			return todos[i].DueAt < todos[j].DueAt
+		}
+		return todos[i].ID < todos[j].ID
+	})
+}
+
+// HandleScheduledEvent runs the job for an EventBridge scheduled event, as
+// of the time the event was scheduled for.
+func (r *Reminders) HandleScheduledEvent(event events.CloudWatchEvent) error {
+	if event.DetailType != "" && event.DetailType != "Scheduled Event" {
+		return errors.New("Unexpected event: " + event.DetailType)
+	}
+
+	now := event.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	sent, err := r.Run(now)
+	fmt.Printf("Sent %d reminders\n", sent)
+	return err
+}
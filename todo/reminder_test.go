@@ -0,0 +1,103 @@
+package todo
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyLog fails to claim the keys in failing.
+type flakyLog struct {
+	*MemoryReminderLog
+	failing map[string]bool
+}
+
+func (l *flakyLog) Claim(key string, expiresAt int64) (bool, error) {
+	if l.failing[key] {
+		return false, errors.New("claim failed")
+	}
+	return l.MemoryReminderLog.Claim(key, expiresAt)
+}
+
+type recordingNotifier struct {
+	sent []Reminder
+}
+
+func (n *recordingNotifier) Notify(reminder Reminder) error {
+	n.sent = append(n.sent, reminder)
+	return nil
+}
+
+func TestRunKeepsGoingWhenClaimFails(t *testing.T) {
+	// Claims expire by the wall clock
+	now := time.Now().UTC()
+	due := func(d time.Duration) string {
+		return now.Add(d).Format(time.RFC3339)
+	}
+	store := NewMemoryStore()
+	todos := []Todos{
+		{ID: "1", Title: "a", Owner: "u1", DueAt: due(-2 * time.Hour)},
+		{ID: "2", Title: "b", Owner: "u1", DueAt: due(-time.Hour)},
+		{ID: "3", Title: "c", Owner: "u2", DueAt: due(6 * time.Hour)},
+	}
+	for _, todo := range todos {
+		if err := store.Put(todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	log := &flakyLog{NewMemoryReminderLog(), map[string]bool{reminderKey(todos[0], "overdue"): true}}
+	notifier := &recordingNotifier{}
+	reminders := &Reminders{Store: store, Log: log, Notifier: notifier}
+
+	sent, err := reminders.Run(now)
+	if err == nil {
+		t.Error("expected the claim error")
+	}
+	if sent != 2 || len(notifier.sent) != 2 {
+		t.Fatalf("got %d reminders sent, want 2", sent)
+	}
+	if n := len(notifier.sent[0].Overdue); notifier.sent[0].Owner != "u1" || n != 1 {
+		t.Errorf("got %d overdue todos for %s, want the one claimed", n, notifier.sent[0].Owner)
+	}
+
+	// The todo that failed is tried again, the others are not repeated
+	log.failing = nil
+	notifier.sent = nil
+	sent, err = reminders.Run(now)
+	if err != nil || sent != 1 || notifier.sent[0].Overdue[0].ID != "1" {
+		t.Errorf("got %d sent, %v, want the todo that failed", sent, err)
+	}
+}
+
+func TestDueTodosQueriesIndex(t *testing.T) {
+	fake := NewFakeDynamoDB(nil)
+	if _, err := NewDynamoStore(fake, TableName).DueTodos("2026-03-01T12:00:00Z"); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Calls) != dueShards {
+		t.Errorf("got calls %v, want a query per shard", fake.Calls)
+	}
+	for _, call := range fake.Calls {
+		if call != "Query" {
+			t.Errorf("got %s, want only queries", call)
+		}
+	}
+}
+
+func TestDueShardFollowsCompleted(t *testing.T) {
+	todo := newTodo(Todos{Owner: "u1", Title: "a"}, "1", time.Now())
+	if todo.DueShard != dueShard("1") {
+		t.Fatalf("got %q for an open todo", todo.DueShard)
+	}
+	done := true
+	todo = TodoChange{Owner: "u1", ID: "1", Title: "a", Completed: &done}.apply(todo)
+	if todo.DueShard != "" {
+		t.Errorf("got %q for a completed todo", todo.DueShard)
+	}
+	done = false
+	todo = TodoChange{Owner: "u1", ID: "1", Title: "a", Completed: &done}.apply(todo)
+	if todo.DueShard != dueShard("1") {
+		t.Errorf("got %q for a reopened todo", todo.DueShard)
+	}
+}
@@ -0,0 +1,47 @@
+package todo
+
+import (
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// GenerateHeaders returns the CORS headers sent with every todo response.
+func GenerateHeaders() map[string]string {
+	return map[string]string{
+		"Access-Control-Allow-Origin":   "*",
+		"Access-Control-Allow-Headers":  "Content-Type,If-Match,Idempotency-Key",
+		"Access-Control-Allow-Methods":  "OPTIONS,GET,POST,PUT,PATCH,DELETE",
+		"Access-Control-Expose-Headers": "ETag,Undo-Token,Idempotent-Replayed",
+	}
+}
+
+func GenerateResponse(body string, statusCode int) events.APIGatewayProxyResponse {
+	apiResponse := events.APIGatewayProxyResponse{
+		Headers:    GenerateHeaders(),
+		Body:       body,
+		StatusCode: statusCode}
+	return apiResponse
+}
+
+// GenerateErrorResponse answers the message in the error envelope, with
+// the code of the status code.
+func GenerateErrorResponse(err string, statusCode int) events.APIGatewayProxyResponse {
+	apiResponse, _ := apierror.Response(apierror.New(apierror.ForStatus(statusCode), err), GenerateHeaders())
+	apiResponse.StatusCode = statusCode
+	return apiResponse
+}
+
+// errorResponse answers err under the code, or under its own when it is
+// an *apierror.Error, returning err as well only when it is a server
+// error. ErrThrottled answers 429 whatever the code. Internal errors
+// answer a fixed message, apierror.Sanitize logs what they were.
+func errorResponse(code apierror.Code, err error) (events.APIGatewayProxyResponse, error) {
+	if err == ErrThrottled {
+		code = apierror.Throttled
+	}
+	apiErr, ok := err.(*apierror.Error)
+	if !ok {
+		apiErr = apierror.Wrap(code, err)
+	}
+	return apierror.Response(apiErr, GenerateHeaders())
+}
@@ -0,0 +1,152 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// HandlerFunc is the signature shared by every todo request handler.
+type HandlerFunc func(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// Router dispatches API Gateway proxy requests on their Resource path and
+// HTTP method.
+type Router struct {
+	routes map[string]map[string]HandlerFunc
+}
+
+func NewRouter() *Router {
+	return &Router{routes: map[string]map[string]HandlerFunc{}}
+}
+
+// Handle registers fn for the resource (as configured in API Gateway, e.g.
+// "/todos/{id}") and each of the given methods.
+func (r *Router) Handle(resource string, fn HandlerFunc, methods ...string) {
+	if r.routes[resource] == nil {
+		r.routes[resource] = map[string]HandlerFunc{}
+	}
+	for _, method := range methods {
+		r.routes[resource][method] = fn
+	}
+}
+
+// allowed lists the methods registered for a resource, for the Allow header.
+func (r *Router) allowed(resource string) string {
+	methods := []string{"OPTIONS"}
+	for method := range r.routes[resource] {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ",")
+}
+
+// Match returns the registered resource a request path such as
+// "/todos/42/restore" falls under, with the values of its path parameters,
+// the way API Gateway fills in Resource and PathParameters. Literal
+// segments win over parameters, so "/todos/batch" is not "/todos/{id}".
+func (r *Router) Match(path string) (string, map[string]string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	best, bestParams, bestLiterals := "", map[string]string(nil), -1
+	for resource := range r.routes {
+		parts := strings.Split(strings.Trim(resource, "/"), "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		params := map[string]string{}
+		literals := 0
+		for i, part := range parts {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+				params[part[1:len(part)-1]] = segments[i]
+			} else if part == segments[i] {
+				literals++
+			} else {
+				params = nil
+				break
+			}
+		}
+		if params != nil && literals > bestLiterals {
+			best, bestParams, bestLiterals = resource, params, literals
+		}
+	}
+	return best, bestParams, bestLiterals >= 0
+}
+
+// Route serves the request with the handler registered for its resource and
+// method. Unknown resources get 404, unknown methods 405 and OPTIONS is
+// answered directly for CORS preflight. Server errors are logged with the
+// ID API Gateway gave the request.
+func (r *Router) Route(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	methods, ok := r.routes[request.Resource]
+	if !ok {
+		fmt.Println("No route for " + request.HTTPMethod + " " + request.Resource)
+		return errorResponse(apierror.NotFound, errors.New("Not Found"))
+	}
+
+	if request.HTTPMethod == "OPTIONS" {
+		return GenerateResponse("", http.StatusOK), nil
+	}
+
+	fn, ok := methods[request.HTTPMethod]
+	if !ok {
+		apiResponse, err := errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+		apiResponse.Headers["Allow"] = r.allowed(request.Resource)
+		return apiResponse, err
+	}
+
+	apiResponse, err := fn(request)
+	if err != nil {
+		fmt.Println("Got error serving " + request.HTTPMethod + " " + request.Resource +
+			" (request " + request.RequestContext.RequestID + "): " + err.Error())
+	}
+	return apiResponse, err
+}
+
+// NewTodoRouter returns the router for the whole todo API, every route
+// behind Handler.Authenticated. The /todos/add, /todos/update and
+// /todos/delete resources are the paths the React app was built against
+// and are kept as aliases.
+func NewTodoRouter(h *Handler) *Router {
+	r := &authRouter{NewRouter(), h}
+	r.Handle("/todos", h.HandleGetTodosRequest, "GET")
+	r.Handle("/todos", h.HandleAddTodoRequest, "POST")
+	r.Handle("/todos/batch", h.HandleBatchTodosRequest, "POST")
+	r.Handle("/todos/export", h.HandleExportTodosRequest, "GET")
+	r.Handle("/todos/import", h.HandleImportTodosRequest, "POST")
+	r.Handle("/todos/{id}", h.HandleGetTodoRequest, "GET")
+	r.Handle("/todos/{id}", h.HandleUpdateTodoRequest, "PATCH")
+	r.Handle("/todos/{id}", h.HandleDeleteTodoRequest, "DELETE")
+	r.Handle("/todos/{id}/restore", h.HandleRestoreTodoRequest, "POST")
+	r.Handle("/todos/{id}/move", h.HandleMoveTodoRequest, "POST")
+	r.Handle("/todos/{id}/subtree", h.HandleGetSubtreeRequest, "GET")
+	r.Handle("/todos/{id}/skip", h.HandleSkipTodoRequest, "POST")
+	r.Handle("/todos/{id}/reorder", h.HandleReorderTodoRequest, "POST")
+	r.Handle("/todos/{id}/history", h.HandleGetHistoryRequest, "GET")
+	r.Handle("/undo", h.HandleUndoRequest, "POST")
+	r.Handle("/lists", h.HandleGetListsRequest, "GET")
+	r.Handle("/lists", h.HandleAddListRequest, "POST")
+	r.Handle("/lists/{id}", h.HandleGetListRequest, "GET")
+	r.Handle("/lists/{id}", h.HandleUpdateListRequest, "PATCH")
+	r.Handle("/lists/{id}", h.HandleDeleteListRequest, "DELETE")
+	r.Handle("/lists/{id}/todos", h.HandleGetTodosRequest, "GET")
+
+	r.Handle("/todos/add", h.HandleAddTodoRequest, "POST", "PUT")
+	r.Handle("/todos/update", h.HandleUpdateTodoRequest, "POST", "PUT")
+	r.Handle("/todos/delete", h.HandleDeleteTodoRequest, "POST", "DELETE")
+	r.Handle("/todos/restore", h.HandleRestoreTodoRequest, "POST")
+	return r.Router
+}
+
+// authRouter registers handlers behind Handler.Authenticated.
+type authRouter struct {
+	*Router
+	h *Handler
+}
+
+func (r *authRouter) Handle(resource string, fn HandlerFunc, methods ...string) {
+	r.Router.Handle(resource, r.h.Authenticated(fn), methods...)
+}
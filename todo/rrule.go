@@ -0,0 +1,336 @@
+package todo
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// Lambdas do not ship a zoneinfo database
+	_ "time/tzdata"
+)
+
+// maxRecurrencePeriods bounds the search for the next occurrence, for rules
+// such as FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30 that never match.
+const maxRecurrencePeriods = 1000
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+var byDayPattern = regexp.MustCompile(`^([+-]?[0-9]{1,2})?(SU|MO|TU|WE|TH|FR|SA)$`)
+
+// weekdayNum is a BYDAY entry: every Day of the period when N is 0, else
+// the Nth one of the month, counting from the end when N is negative.
+type weekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// Recurrence is the part of an iCalendar RRULE (RFC 5545) recurring todos
+// support: FREQ (DAILY, WEEKLY, MONTHLY or YEARLY), INTERVAL, BYDAY,
+// BYMONTHDAY, BYMONTH, WKST, COUNT and UNTIL.
+type Recurrence struct {
+	Freq       string
+	Interval   int
+	ByDay      []weekdayNum
+	ByMonthDay []int
+	ByMonth    []int
+	WeekStart  time.Weekday
+	Count      int64
+	// Until is the last possible occurrence. A date-only UNTIL is kept as
+	// UntilDate (YYYYMMDD) and compared in the time zone of the todo.
+	Until     time.Time
+	UntilDate string
+}
+
+// ParseRecurrence parses an RRULE value such as "FREQ=WEEKLY;BYDAY=MO",
+// with or without the "RRULE:" prefix.
+func ParseRecurrence(rule string) (Recurrence, error) {
+	r := Recurrence{Interval: 1, WeekStart: time.Monday}
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return r, fmt.Errorf("Invalid RRULE part %s", part)
+		}
+
+		name, val := kv[0], kv[1]
+		switch name {
+		case "FREQ":
+			switch val {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.Freq = val
+			default:
+				return r, fmt.Errorf("Unsupported RRULE FREQ %s", val)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("Invalid RRULE INTERVAL %s", val)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("Invalid RRULE COUNT %s", val)
+			}
+			r.Count = n
+		case "UNTIL":
+			if until, err := time.Parse("20060102T150405Z", val); err == nil {
+				r.Until = until
+			} else if _, err := time.Parse("20060102", val); err == nil {
+				r.UntilDate = val
+			} else {
+				return r, fmt.Errorf("Invalid RRULE UNTIL %s", val)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				m := byDayPattern.FindStringSubmatch(day)
+				if m == nil {
+					return r, fmt.Errorf("Invalid RRULE BYDAY %s", day)
+				}
+				n := 0
+				if m[1] != "" {
+					n, _ = strconv.Atoi(m[1])
+					if n == 0 || n < -5 || n > 5 {
+						return r, fmt.Errorf("Invalid RRULE BYDAY %s", day)
+					}
+				}
+				r.ByDay = append(r.ByDay, weekdayNum{N: n, Day: weekdays[m[2]]})
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return r, fmt.Errorf("Invalid RRULE BYMONTHDAY %s", day)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, month := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(month)
+				if err != nil || n < 1 || n > 12 {
+					return r, fmt.Errorf("Invalid RRULE BYMONTH %s", month)
+				}
+				r.ByMonth = append(r.ByMonth, n)
+			}
+		case "WKST":
+			day, ok := weekdays[val]
+			if !ok {
+				return r, fmt.Errorf("Invalid RRULE WKST %s", val)
+			}
+			r.WeekStart = day
+		default:
+			return r, fmt.Errorf("Unsupported RRULE part %s", name)
+		}
+	}
+
+	if r.Freq == "" {
+		return r, fmt.Errorf("RRULE needs a FREQ")
+	}
+	if r.Count > 0 && (!r.Until.IsZero() || r.UntilDate != "") {
+		return r, fmt.Errorf("RRULE cannot have both COUNT and UNTIL")
+	}
+	if r.Freq == "WEEKLY" && len(r.ByMonthDay) > 0 {
+		return r, fmt.Errorf("RRULE BYMONTHDAY cannot be used with FREQ=WEEKLY")
+	}
+	for _, day := range r.ByDay {
+		if day.N != 0 && r.Freq != "MONTHLY" && !(r.Freq == "YEARLY" && len(r.ByMonth) > 0) {
+			return r, fmt.Errorf("RRULE BYDAY with a number needs FREQ=MONTHLY, or FREQ=YEARLY with BYMONTH")
+		}
+	}
+	return r, nil
+}
+
+// Next returns the occurrence following the one due at current, which is
+// occurrence number occurrence of the series, and false once the series is
+// over. The next occurrence keeps the wall clock time of current in its
+// location, across daylight saving changes.
+func (r Recurrence) Next(current time.Time, occurrence int64) (time.Time, bool) {
+	if r.Count > 0 && occurrence >= r.Count {
+		return time.Time{}, false
+	}
+
+	for period := 0; period <= maxRecurrencePeriods; period++ {
+		for _, next := range r.candidates(current, period) {
+			if !next.After(current) {
+				continue
+			}
+			if r.ended(next) {
+				return time.Time{}, false
+			}
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r Recurrence) ended(next time.Time) bool {
+	if r.UntilDate != "" {
+		return next.Format("20060102") > r.UntilDate
+	}
+	return !r.Until.IsZero() && next.After(r.Until)
+}
+
+// candidates returns the dates the rule matches in the period that is
+// period intervals after the one of current, in order.
+func (r Recurrence) candidates(current time.Time, period int) []time.Time {
+	hour, min, sec := current.Clock()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, current.Location())
+	}
+
+	dates := []time.Time{}
+	switch r.Freq {
+	case "DAILY":
+		day := at(current.Year(), current.Month(), current.Day()+period*r.Interval)
+		if r.matchesDay(day) && r.matchesMonth(day.Month()) {
+			dates = append(dates, day)
+		}
+	case "WEEKLY":
+		offset := func(day time.Weekday) int {
+			return (int(day) - int(r.WeekStart) + 7) % 7
+		}
+		weekStart := current.Day() - offset(current.Weekday()) + period*r.Interval*7
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []weekdayNum{{Day: current.Weekday()}}
+		}
+		for _, day := range days {
+			date := at(current.Year(), current.Month(), weekStart+offset(day.Day))
+			if r.matchesMonth(date.Month()) {
+				dates = append(dates, date)
+			}
+		}
+	case "MONTHLY":
+		month := at(current.Year(), current.Month()+time.Month(period*r.Interval), 1)
+		if r.matchesMonth(month.Month()) {
+			for _, day := range r.monthDays(month.Year(), month.Month(), current.Day()) {
+				dates = append(dates, at(month.Year(), month.Month(), day))
+			}
+		}
+	case "YEARLY":
+		year := current.Year() + period*r.Interval
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []int{int(current.Month())}
+		}
+		for _, month := range months {
+			for _, day := range r.monthDays(year, time.Month(month), current.Day()) {
+				dates = append(dates, at(year, time.Month(month), day))
+			}
+		}
+	}
+
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates
+}
+
+func (r Recurrence) matchesDay(date time.Time) bool {
+	if len(r.ByMonthDay) > 0 {
+		found := false
+		for _, day := range r.monthDays(date.Year(), date.Month(), date.Day()) {
+			found = found || day == date.Day()
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, day := range r.ByDay {
+		if day.Day == date.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Recurrence) matchesMonth(month time.Month) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, m := range r.ByMonth {
+		if time.Month(m) == month {
+			return true
+		}
+	}
+	return false
+}
+
+// monthDays returns the days of the month matching BYMONTHDAY and BYDAY,
+// or just defaultDay when the rule has neither. Days past the end of the
+// month are skipped, so a todo due on the 31st skips shorter months.
+func (r Recurrence) monthDays(year int, month time.Month, defaultDay int) []int {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+		if defaultDay <= last {
+			return []int{defaultDay}
+		}
+		return nil
+	}
+
+	matches := map[int]int{}
+	wanted := 0
+	if len(r.ByMonthDay) > 0 {
+		wanted++
+		for _, day := range r.ByMonthDay {
+			if day < 0 {
+				day = last + 1 + day
+			}
+			if day >= 1 && day <= last {
+				matches[day] = 1
+			}
+		}
+	}
+	if len(r.ByDay) > 0 {
+		wanted++
+		byDay := map[int]bool{}
+		for _, wd := range r.ByDay {
+			days := []int{}
+			for day := 1; day <= last; day++ {
+				if time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Weekday() == wd.Day {
+					days = append(days, day)
+				}
+			}
+			switch {
+			case wd.N == 0:
+			case wd.N > 0 && wd.N <= len(days):
+				days = days[wd.N-1 : wd.N]
+			case wd.N < 0 && -wd.N <= len(days):
+				days = days[len(days)+wd.N : len(days)+wd.N+1]
+			default:
+				days = nil
+			}
+			for _, day := range days {
+				byDay[day] = true
+			}
+		}
+		for day := range byDay {
+			matches[day]++
+		}
+	}
+
+	// BYMONTHDAY and BYDAY together only match the days both allow
+	days := []int{}
+	for day, n := range matches {
+		if n == wanted {
+			days = append(days, day)
+		}
+	}
+	sort.Ints(days)
+	return days
+}
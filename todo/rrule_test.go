@@ -0,0 +1,69 @@
+package todo
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestNextDueAtAcrossDST(t *testing.T) {
+	cases := []struct {
+		name       string
+		rule       string
+		zone       string
+		due        string
+		occurrence int64
+		next       string
+	}{
+		{"daily into summer time", "FREQ=DAILY", "America/New_York", "2026-03-07T14:00:00Z", 1, "2026-03-08T13:00:00Z"},
+		{"daily out of summer time", "FREQ=DAILY", "America/New_York", "2026-10-31T13:00:00Z", 1, "2026-11-01T14:00:00Z"},
+		{"weekly into summer time", "FREQ=WEEKLY;BYDAY=MO", "Europe/Berlin", "2026-03-23T08:00:00Z", 1, "2026-03-30T07:00:00Z"},
+		{"monthly last day", "FREQ=MONTHLY;BYMONTHDAY=-1", "Europe/Berlin", "2026-02-28T08:00:00Z", 1, "2026-03-31T07:00:00Z"},
+		{"UTC has no change", "FREQ=DAILY", "", "2026-03-07T14:00:00Z", 1, "2026-03-08T14:00:00Z"},
+		{"COUNT reached", "FREQ=DAILY;COUNT=3", "America/New_York", "2026-03-07T14:00:00Z", 3, ""},
+		{"past UNTIL", "FREQ=DAILY;UNTIL=20260307", "America/New_York", "2026-03-07T14:00:00Z", 1, ""},
+		{"up to UNTIL", "FREQ=DAILY;UNTIL=20260308", "America/New_York", "2026-03-07T14:00:00Z", 1, "2026-03-08T13:00:00Z"},
+	}
+	for _, c := range cases {
+		todo := Todos{Recurrence: c.rule, TimeZone: c.zone, DueAt: c.due, Occurrence: c.occurrence}
+		next, ok, err := nextDueAt(todo)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if ok != (c.next != "") || next != c.next {
+			t.Errorf("%s: got %q %v, want %q", c.name, next, ok, c.next)
+		}
+	}
+}
+
+func TestUpdateKeepsRecurringTodosDue(t *testing.T) {
+	h := newTestHandler()
+	plain := addTestTodo(t, h, "u1", "water plants")
+	status, body := call(t, h.HandleAddTodoRequest, "POST", "u1", "", `{"title": "pay rent", "dueAt": "2026-03-01T09:00:00Z", "recurrence": "FREQ=MONTHLY"}`)
+	if status != http.StatusOK {
+		t.Fatalf("got %d %s", status, body)
+	}
+	recurring := Todos{}
+	if err := json.Unmarshal([]byte(body), &recurring); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		id     string
+		body   string
+		status int
+	}{
+		{"recurrence without a due date", plain.ID, `{"recurrence": "FREQ=DAILY"}`, http.StatusBadRequest},
+		{"due date cleared while recurring", recurring.ID, `{"dueAt": ""}`, http.StatusBadRequest},
+		{"due date cleared on rename", recurring.ID, `{"newTitle": "pay the rent", "dueAt": ""}`, http.StatusBadRequest},
+		{"recurrence with a due date", plain.ID, `{"recurrence": "FREQ=DAILY", "dueAt": "2026-03-01T09:00:00Z"}`, http.StatusOK},
+		{"both cleared", recurring.ID, `{"recurrence": "", "dueAt": ""}`, http.StatusOK},
+	}
+	for _, c := range cases {
+		if status, body := call(t, h.HandleUpdateTodoRequest, "PATCH", "u1", c.id, c.body); status != c.status {
+			t.Errorf("%s: got %d %s, want %d", c.name, status, body, c.status)
+		}
+	}
+}
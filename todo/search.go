@@ -0,0 +1,247 @@
+package todo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// SearchTableName is the DynamoDB table holding the search index, keyed by
+// PK (hash) and SK (range).
+const SearchTableName = "TodoSearch"
+
+const (
+	// maxIndexTokens caps the distinct tokens indexed per todo, which
+	// bounds the writes one long description costs.
+	maxIndexTokens = 300
+	maxQueryTerms  = 10
+
+	// Weights of a token by the field it appears in
+	titleWeight       = 3
+	tagWeight         = 2
+	descriptionWeight = 1
+)
+
+// ErrSearchDisabled is returned for ?q= when the handler has no SearchIndex.
+var ErrSearchDisabled = errors.New("Search is not enabled")
+
+// foldings maps letters with diacritics to their base letters, so "Café"
+// is found by "cafe".
+var foldings = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'ç': "c", 'ć': "c", 'č': "c",
+	'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l", 'ĺ': "l",
+	'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'ŕ': "r", 'ř': "r",
+	'ś': "s", 'š': "s", 'ş': "s", 'ș': "s",
+	'ť': "t", 'ţ': "t", 'ț': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'þ': "th",
+}
+
+// Tokenize splits text into lower-cased words with diacritics folded away.
+// Anything but letters and digits separates words.
+func Tokenize(text string) []string {
+	tokens := []string{}
+	var b strings.Builder
+	flush := func() {
+		if b.Len() > 0 {
+			tokens = append(tokens, b.String())
+			b.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		if folded, ok := foldings[r]; ok {
+			b.WriteString(folded)
+		} else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else if !unicode.Is(unicode.Mn, r) {
+			// Combining marks of decomposed text are dropped
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// indexTokens returns the weight of every token of the todo: how often it
+// appears in each field, times the weight of the field.
+func indexTokens(todo Todos) map[string]int {
+	weights := map[string]int{}
+	add := func(text string, weight int) {
+		for _, token := range Tokenize(text) {
+			if _, ok := weights[token]; ok || len(weights) < maxIndexTokens {
+				weights[token] += weight
+			}
+		}
+	}
+	add(todo.Title, titleWeight)
+	for _, tag := range todo.Tags {
+		add(tag, tagWeight)
+	}
+	add(todo.Description, descriptionWeight)
+	return weights
+}
+
+// SearchPosting is an indexed todo whose token matched a search term.
+type SearchPosting struct {
+	ID     string
+	Title  string
+	Token  string
+	Weight int
+}
+
+// SearchIndex is an inverted index of the words of the titles, tags and
+// descriptions of live todos, per owner.
+type SearchIndex interface {
+	// Index replaces what is indexed for the todo.
+	Index(todo Todos) error
+	// Remove drops the todo from the index.
+	Remove(owner string, id string) error
+	// Match returns the postings of owner whose token starts with prefix.
+	Match(owner string, prefix string) ([]SearchPosting, error)
+}
+
+// SearchHit is a todo matching every search term, with its rank.
+type SearchHit struct {
+	ID    string
+	Title string
+	Score int
+}
+
+// Search finds the todos of owner matching every word of q, each word as
+// a prefix. A word matching a whole token counts double, and hits are
+// ranked by their summed weights.
+func Search(index SearchIndex, owner string, q string) ([]SearchHit, error) {
+	terms := Tokenize(q)
+	if len(terms) > maxQueryTerms {
+		terms = terms[:maxQueryTerms]
+	}
+
+	var hits map[string]*SearchHit
+	for _, term := range terms {
+		postings, err := index.Match(owner, term)
+		if err != nil {
+			return nil, err
+		}
+
+		// Score the term by the best token it matches in each todo
+		best := map[string]SearchPosting{}
+		scores := map[string]int{}
+		for _, posting := range postings {
+			score := posting.Weight
+			if posting.Token == term {
+				score *= 2
+			}
+			if score > scores[posting.ID] {
+				scores[posting.ID] = score
+				best[posting.ID] = posting
+			}
+		}
+
+		// Every term has to match
+		next := map[string]*SearchHit{}
+		for id, score := range scores {
+			if hits == nil {
+				next[id] = &SearchHit{ID: id, Title: best[id].Title, Score: score}
+			} else if hit, ok := hits[id]; ok {
+				hit.Score += score
+				next[id] = hit
+			}
+		}
+		hits = next
+	}
+
+	ranked := []SearchHit{}
+	for _, hit := range hits {
+		ranked = append(ranked, *hit)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+	return ranked, nil
+}
+
+// reindexTodo indexes a live todo and removes a trashed one.
+func reindexTodo(index SearchIndex, todo Todos) error {
+	if todo.DeletedAt != "" {
+		return index.Remove(todo.Owner, todo.ID)
+	}
+	return index.Index(todo)
+}
+
+// reindex brings the search index in line with a todo that was just
+// written. Like rollup it is best effort: the write already succeeded, so
+// a failure is logged rather than answered, and leaves the todo out of or
+// stale in searches until it changes again or DynamoStore.ReindexSearch
+// (go run ./backfilltodos -search) rebuilds the index. Stale hits never
+// reach a response, SearchTodosResponse checks them against the store.
+func (h *Handler) reindex(todo Todos) {
+	if h.Search == nil {
+		return
+	}
+
+	if err := reindexTodo(h.Search, todo); err != nil {
+		fmt.Println("Search index out of date for " + todo.ID + ", rebuild with backfilltodos -search: " + err.Error())
+	}
+}
+
+// SearchTodosResponse answers a ?q= search with the best ranked todos of
+// the query, applying its Completed, ListID, ParentID and Filter to the
+// hits. Search results are not paged.
+func (h *Handler) SearchTodosResponse(q string, query TodoQuery) (events.APIGatewayProxyResponse, error) {
+	if h.Search == nil {
+		return errorResponse(apierror.NotImplemented, ErrSearchDisabled)
+	}
+
+	hits, err := Search(h.Search, query.Owner, q)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	todos := []Todos{}
+	for _, hit := range hits {
+		if query.Limit > 0 && int64(len(todos)) >= query.Limit {
+			break
+		}
+
+		// The index only keeps the key, the todo itself may have moved on
+		todo, err := h.Store.Get(hit.ID, hit.Title)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return errorResponse(apierror.Internal, err)
+		}
+		if todo.Owner != query.Owner || todo.DeletedAt != "" ||
+			(query.Completed != nil && todo.Completed != *query.Completed) ||
+			(query.ListID != "" && todo.ListID != query.ListID) ||
+			(query.ParentID != "" && todo.ParentID != query.ParentID) ||
+			(query.Filter != nil && !query.Filter.Match(todo)) {
+			continue
+		}
+		todos = append(todos, todo)
+	}
+
+	responseBody, err := json.Marshal(TodosPage{Todos: todos})
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	return GenerateResponse(string(responseBody), http.StatusOK), nil
+}
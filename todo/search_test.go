@@ -0,0 +1,136 @@
+package todo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"case", "Buy MILK", []string{"buy", "milk"}},
+		{"acute", "Café", []string{"cafe"}},
+		{"upper case accent", "ÉCOLE", []string{"ecole"}},
+		{"decomposed", "Café crème", []string{"cafe", "creme"}},
+		{"stroke and acute", "Łódź", []string{"lodz"}},
+		{"expanding letters", "Straße Ærø", []string{"strasse", "aero"}},
+		{"dotted capital i", "İstanbul", []string{"istanbul"}},
+		{"separators", "buy-milk, 2x!", []string{"buy", "milk", "2x"}},
+		{"other scripts", "Ελληνικά 日本", []string{"ελληνικά", "日本"}},
+		{"empty", " - ", []string{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := Tokenize(c.text); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	index := NewMemorySearchIndex()
+	for _, todo := range []Todos{
+		{ID: "title", Owner: "u1", Title: "Milk"},
+		{ID: "tag", Owner: "u1", Title: "groceries", Tags: []string{"milk"}},
+		{ID: "description", Owner: "u1", Title: "shop", Description: "and milk"},
+		{ID: "prefix", Owner: "u1", Title: "milkshake"},
+		{ID: "tie", Owner: "u1", Title: "milkweed"},
+		{ID: "both", Owner: "u1", Title: "buy milk"},
+		{ID: "foreign", Owner: "u2", Title: "milk"},
+	} {
+		if err := index.Index(todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name string
+		q    string
+		want []string
+	}{
+		// Whole title words 6, tags 4, title prefixes 3, descriptions 2,
+		// ties by ID
+		{"by field and whole word", "milk", []string{"both", "title", "tag", "prefix", "tie", "description"}},
+		{"every word has to match", "buy milk", []string{"both"}},
+		{"prefix only", "milks", []string{"prefix"}},
+		{"folded query", "MÍLK buy", []string{"both"}},
+		{"no match", "bread", []string{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hits, err := Search(index, "u1", c.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, hit := range hits {
+				got = append(got, hit.ID)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+// failingSearchIndex fails every write.
+type failingSearchIndex struct {
+	*MemorySearchIndex
+}
+
+func (failingSearchIndex) Index(todo Todos) error {
+	return errors.New("index unavailable")
+}
+
+// scanDynamoDB answers Scan with the items, in one page.
+type scanDynamoDB struct {
+	*FakeDynamoDB
+	items []map[string]*dynamodb.AttributeValue
+}
+
+func (s *scanDynamoDB) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	s.Calls = append(s.Calls, "Scan")
+	return &dynamodb.ScanOutput{Items: s.items}, nil
+}
+
+func TestReindexSearch(t *testing.T) {
+	// A failed index leaves the write alone and the todo out of searches
+	h := newTestHandler()
+	h.Search = failingSearchIndex{NewMemorySearchIndex()}
+	todo := addTestTodo(t, h, "u1", "buy milk")
+	if hits, _ := Search(h.Search, "u1", "buy"); len(hits) != 0 {
+		t.Fatalf("got %+v, want nothing indexed", hits)
+	}
+	todo.Owner = "u1"
+
+	index := NewMemorySearchIndex()
+	trashed := Todos{ID: "2", Owner: "u1", Title: "buy eggs", DeletedAt: "2026-01-01T00:00:00Z"}
+	if err := index.Index(Todos{ID: "2", Owner: "u1", Title: "buy eggs"}); err != nil {
+		t.Fatal(err)
+	}
+	fake := &scanDynamoDB{FakeDynamoDB: NewFakeDynamoDB(nil)}
+	for _, item := range []Todos{todo, trashed} {
+		av, err := dynamodbattribute.MarshalMap(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fake.items = append(fake.items, av)
+	}
+
+	done, err := NewDynamoStore(fake, TableName).ReindexSearch(index)
+	if err != nil || done != 2 {
+		t.Fatalf("got %d (%v), want 2 todos reindexed", done, err)
+	}
+	hits, err := Search(index, "u1", "buy")
+	if err != nil || len(hits) != 1 || hits[0].ID != todo.ID {
+		t.Errorf("got %+v (%v), want the missed todo indexed and the trashed one removed", hits, err)
+	}
+}
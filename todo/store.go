@@ -0,0 +1,282 @@
+package todo
+
+import "errors"
+
+// ErrNotFound is returned by a TodoStore when no item matches the given key.
+var ErrNotFound = errors.New("Todo not found")
+
+// ErrTitleExists is returned by TodoStore.Rename when the todo already has
+// an item under the new title.
+var ErrTitleExists = errors.New("Todo with this title already exists")
+
+// ErrAmbiguousID is returned when a todo is addressed by ID alone and more
+// than one item carries the ID.
+var ErrAmbiguousID = errors.New("More than one todo has this ID, specify the Title")
+
+// ErrVersionMismatch is returned by conditional writes when the stored item
+// is not at the expected version, or no longer exists.
+var ErrVersionMismatch = errors.New("Todo was modified by another request")
+
+// ErrListNotFound is returned when a todo list does not exist or belongs to
+// someone else.
+var ErrListNotFound = errors.New("List not found")
+
+// ErrListNotEmpty is returned when deleting a list that still has todos.
+var ErrListNotEmpty = errors.New("List still has todos")
+
+// ErrThrottled is returned for batch items DynamoDB kept rejecting after
+// every retry.
+var ErrThrottled = errors.New("Too many requests, try again later")
+
+// itemKey is the primary key of an item in the Todos table.
+type itemKey struct {
+	ID    string
+	Title string
+}
+
+// PageKey is the key of the last item a Query looked at. Passing it back as
+// TodoQuery.StartKey continues the query right after that item.
+type PageKey map[string]string
+
+// TodoQuery selects the todos returned by TodoStore.Query. Only todos of
+// Owner are returned, where the empty owner holds the todos created without
+// a signed in user. An empty ID walks the whole table, or only the todos
+// of ListID or the subtasks of ParentID when one is given. Todos come in
+// the order of their Position. A nil Completed matches both states, a
+// non-nil Filter has to match as well and a Limit of 0 means no limit.
+// Deleted lists the trash instead of live todos.
+type TodoQuery struct {
+	Owner     string
+	ID        string
+	ListID    string
+	ParentID  string
+	Completed *bool
+	Filter    Filter
+	Deleted   bool
+	Limit     int64
+	StartKey  PageKey
+}
+
+// TodoChange is an update of the todo under ID and Title, which must exist
+// and belong to Owner. Nil fields are left as they are, and empty
+// Description, DueAt, Priority, Recurrence, TimeZone or (non-nil) Tags
+// remove the attribute. A non-zero Occurrence and a non-empty NextID are
+// written as they are, and Unlink removes NextID. UpdatedAt stamps the
+// change and the CompletedAt of a completed todo, and Actor, who made the
+// change, becomes its UpdatedBy. A non-empty DeletedAt moves the todo to
+// the trash with ExpiresAt as its TTL, and Restore takes a trashed todo
+// back out; any other change needs a live todo. A non-nil ListID files the
+// todo under that list, or takes it out of its list when empty. A non-nil
+// AutoComplete turns auto-completion from subtasks on or off. A non-empty
+// Position moves the todo there. A non-nil Version makes the change
+// conditional on the stored item being at that version.
+type TodoChange struct {
+	Owner        string
+	ID           string
+	Title        string
+	Completed    *bool
+	ListID       *string
+	Description  *string
+	DueAt        *string
+	Priority     *string
+	Tags         []string
+	AutoComplete *bool
+	Recurrence   *string
+	TimeZone     *string
+	Occurrence   int64
+	NextID       string
+	Unlink       bool
+	Position     string
+	UpdatedAt    string
+	Actor        string
+	DeletedAt    string
+	ExpiresAt    int64
+	Restore      bool
+	Version      *int64
+}
+
+// apply returns the todo with the change applied, the way DynamoStore
+// applies it with an UpdateExpression.
+func (change TodoChange) apply(todo Todos) Todos {
+	todo.Version++
+	if change.UpdatedAt != "" {
+		todo.UpdatedAt = change.UpdatedAt
+	}
+	todo.UpdatedBy = change.Actor
+	if change.Completed != nil {
+		todo.Completed = *change.Completed
+		todo.Status = statusKey(change.Owner, todo.Completed)
+		todo.DueShard = ""
+		if !todo.Completed {
+			todo.DueShard = dueShard(todo.ID)
+		}
+		if !todo.Completed {
+			todo.CompletedAt = ""
+		} else if todo.CompletedAt == "" {
+			todo.CompletedAt = change.UpdatedAt
+		}
+	}
+	if change.ListID != nil {
+		todo.ListID = *change.ListID
+	}
+	if change.Description != nil {
+		todo.Description = *change.Description
+	}
+	if change.DueAt != nil {
+		todo.DueAt = *change.DueAt
+	}
+	if change.Priority != nil {
+		todo.Priority = *change.Priority
+	}
+	if change.Tags != nil {
+		todo.Tags = nil
+		if len(change.Tags) > 0 {
+			todo.Tags = change.Tags
+		}
+	}
+	if change.AutoComplete != nil {
+		todo.AutoComplete = *change.AutoComplete
+	}
+	if change.Recurrence != nil {
+		todo.Recurrence = *change.Recurrence
+	}
+	if change.TimeZone != nil {
+		todo.TimeZone = *change.TimeZone
+	}
+	if change.Occurrence != 0 {
+		todo.Occurrence = change.Occurrence
+	}
+	if change.NextID != "" {
+		todo.NextID = change.NextID
+	}
+	if change.Unlink {
+		todo.NextID = ""
+	}
+	if change.Position != "" {
+		todo.Position = change.Position
+		todo.OwnerKey = ownerKey(change.Owner)
+	}
+	if change.DeletedAt != "" {
+		todo.DeletedAt = change.DeletedAt
+		todo.ExpiresAt = change.ExpiresAt
+	}
+	if change.Restore {
+		todo.DeletedAt = ""
+		todo.ExpiresAt = 0
+	}
+	return todo
+}
+
+// fails returns the error of the change against the stored item (ok false
+// when there is none), or nil when the change applies. A restore applies
+// to a trashed item only, any other change to a live one.
+func (change TodoChange) fails(item Todos, ok bool) error {
+	live := item.DeletedAt == ""
+	return writeFails(item, ok && live != change.Restore, change.Owner, change.Version)
+}
+
+// writeFails checks a write of owner to the stored item the way
+// writeCondition does, whether it is trashed or not.
+func writeFails(item Todos, ok bool, owner string, version *int64) error {
+	matches := ok && item.Owner == owner
+	if version != nil && (!matches || item.Version != *version) {
+		return ErrVersionMismatch
+	}
+	if !matches {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// countedIn is the list whose TodoCount counts the todo: the list it is
+// filed under while it is live, none once it is trashed.
+func countedIn(todo Todos) string {
+	if todo.DeletedAt != "" {
+		return ""
+	}
+	return todo.ListID
+}
+
+// TodoStore is the persistence layer shared by the todo lambdas. Items are
+// keyed by ID (hash key) and Title (range key), exactly like the Todos table.
+type TodoStore interface {
+	// Put writes the todo, replacing any item with the same key. A live
+	// todo filed under a list counts towards its TodoCount, and fails
+	// with ErrListNotFound when the list is missing or belongs to someone
+	// else; so do PutAll and PutKeyed.
+	Put(todo Todos) error
+	// Get returns the todo stored under the key, or ErrNotFound. It does
+	// not check the owner, callers do.
+	Get(id string, title string) (Todos, error)
+	// Query returns up to Limit todos matching the query. The returned
+	// PageKey is nil once there is nothing left to read.
+	Query(query TodoQuery) ([]Todos, PageKey, error)
+	// LastPosition returns the largest Position among the todos of owner,
+	// trashed ones included, or "" when none has one.
+	LastPosition(owner string) (string, error)
+	// DueTodos returns the open, live todos of every owner due at or
+	// before the RFC 3339 time, for the reminder job.
+	DueTodos(before string) ([]Todos, error)
+	// Update applies the change, bumps the Version and returns the updated
+	// item. It returns ErrNotFound when the item is missing or belongs to
+	// someone else, and ErrVersionMismatch instead when the change has a
+	// Version that the stored item is not at. Trashing or restoring a todo
+	// takes it off or puts it back on the TodoCount of its list, and a
+	// restored todo whose list is gone is taken out of it. Changes of
+	// ListID go through Move.
+	Update(change TodoChange) (Todos, error)
+	// Rename atomically moves the todo stored under oldTitle to the key of
+	// todo, since Title is part of the key and cannot be updated in place.
+	// The old item must belong to todo.Owner. It returns ErrNotFound when
+	// the old item is gone, ErrVersionMismatch when it is not at version and
+	// ErrTitleExists when the new key is taken, and with ErrListNotFound
+	// when todo moves to a list that is missing.
+	Rename(oldTitle string, todo Todos, version *int64) error
+	// PutAll writes many new todos, returning one error per todo (nil on
+	// success) in the same order.
+	PutAll(todos []Todos) []error
+	// UpdateAll applies many changes to existing todos, returning one error
+	// per change in the same order: ErrNotFound, ErrVersionMismatch or
+	// ErrThrottled for changes that could not be applied.
+	UpdateAll(changes []TodoChange) []error
+	// Delete removes the todo stored under the key for good. The item must
+	// belong to owner, and be at version when one is given, failing as for
+	// Update otherwise.
+	Delete(id string, title string, owner string, version *int64) error
+	// Move applies a change with a ListID, moving the todo from the
+	// TodoCount of its list to that of the new one in the same transaction,
+	// which checks that the new list exists and belongs to the owner of
+	// the change, and returns the moved todo. It fails as for Update, and
+	// with ErrListNotFound when the list is missing.
+	Move(change TodoChange) (Todos, error)
+
+	// PutList writes the list, replacing any list with the same ID.
+	PutList(list TodoList) error
+	// GetList returns the list with the ID, or ErrListNotFound. Like Get it
+	// does not check the owner.
+	GetList(id string) (TodoList, error)
+	// QueryLists returns every list of owner, read from ListOwnerIndex.
+	QueryLists(owner string) ([]TodoList, error)
+	// UpdateList renames the list and stamps its UpdatedAt, returning the
+	// list as written, or ErrListNotFound when it is missing or belongs to
+	// someone else.
+	UpdateList(list TodoList) (TodoList, error)
+	// DeleteList removes the list of owner, taking its trashed todos out
+	// of it, or returns ErrListNotFound. A list whose TodoCount is not 0
+	// stays, failing with ErrListNotEmpty.
+	DeleteList(id string, owner string) error
+
+	// PutKeyed writes a new todo together with the record of the
+	// Idempotency-Key it was created under. When the key has a record that
+	// has not expired it returns ErrKeyUsed and writes neither.
+	PutKeyed(todo Todos, record IdempotencyRecord) error
+	// GetIdempotencyRecord returns the record of the key, or ErrNotFound
+	// when there is none or it expired.
+	GetIdempotencyRecord(key string) (IdempotencyRecord, error)
+
+	// PutUndo stores the undo action under its Key until it expires.
+	PutUndo(action UndoAction) error
+	// GetUndo returns the undo action stored under the key, or ErrNotFound
+	// when there is none or it expired.
+	GetUndo(key string) (UndoAction, error)
+}
@@ -0,0 +1,279 @@
+package todo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// maxTodoDepth caps how deep subtasks nest, which also bounds the number of
+// queries a subtree takes to read.
+const maxTodoDepth = 5
+
+// ErrParentNotFound is returned when a new subtask names a parent the
+// caller has no live todo for.
+var ErrParentNotFound = errors.New("Parent todo not found")
+
+// ErrTooDeep is returned when a new subtask would nest below maxTodoDepth.
+var ErrTooDeep = fmt.Errorf("Subtasks nest at most %d deep", maxTodoDepth)
+
+// children returns the direct subtasks of the todo, live or trashed.
+func (h *Handler) children(owner string, id string, deleted bool) ([]Todos, error) {
+	todos, _, err := h.Store.Query(TodoQuery{Owner: owner, ParentID: id, Deleted: deleted})
+	return todos, err
+}
+
+// descendants returns every subtask below the todo, breadth first.
+func (h *Handler) descendants(owner string, id string, deleted bool) ([]Todos, error) {
+	all := []Todos{}
+	ids := []string{id}
+	for len(ids) > 0 {
+		next := []string{}
+		for _, id := range ids {
+			todos, err := h.children(owner, id, deleted)
+			if err != nil {
+				return nil, err
+			}
+			for _, todo := range todos {
+				all = append(all, todo)
+				next = append(next, todo.ID)
+			}
+		}
+		ids = next
+	}
+	return all, nil
+}
+
+// checkParent makes sure a new subtask of owner can go under the parent:
+// the parent has to be a live todo of owner no deeper than maxTodoDepth.
+func (h *Handler) checkParent(owner string, parentID string) error {
+	return h.checkNesting(owner, parentID, 1)
+}
+
+// checkNesting is checkParent for a new todo levels below the parent, with
+// the todos in between new as well.
+func (h *Handler) checkNesting(owner string, parentID string, levels int) error {
+	depth := levels
+	for id := parentID; id != ""; depth++ {
+		if depth >= maxTodoDepth {
+			return ErrTooDeep
+		}
+		todos, err := h.GetTodosByID(owner, id, 1)
+		if err != nil {
+			return err
+		}
+		if len(todos) == 0 {
+			return ErrParentNotFound
+		}
+		id = todos[0].ParentID
+	}
+	return nil
+}
+
+// completeFromChildren completes an AutoComplete todo once all its subtasks
+// are done, and reopens it when one is not. child is the subtask that just
+// changed, if any, as the index it is read from may not show the change
+// yet. It returns the todo, and whether it had to change.
+func (h *Handler) completeFromChildren(todo Todos, child *Todos) (Todos, bool, error) {
+	if !todo.AutoComplete || todo.DeletedAt != "" {
+		return todo, false, nil
+	}
+
+	todos, err := h.children(todo.Owner, todo.ID, false)
+	if err != nil {
+		return todo, false, err
+	}
+	children := map[string]Todos{}
+	for _, todo := range todos {
+		children[todo.ID] = todo
+	}
+	if child != nil {
+		delete(children, child.ID)
+		if child.DeletedAt == "" {
+			children[child.ID] = *child
+		}
+	}
+	if len(children) == 0 {
+		return todo, false, nil
+	}
+
+	done := true
+	for _, child := range children {
+		done = done && child.Completed
+	}
+	if done == todo.Completed {
+		return todo, false, nil
+	}
+
+	fmt.Println("Auto-completing: " + todo.ID + " - " + todo.Title)
+	change := TodoChange{
+		Owner:     todo.Owner,
+		ID:        todo.ID,
+		Title:     todo.Title,
+		Completed: &done,
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+		Actor:     ActorAutoComplete,
+	}
+	updated, err := h.Store.Update(change)
+	if err != nil {
+		return todo, false, err
+	}
+	return updated, true, nil
+}
+
+// rollup brings the ancestors of a todo that was just written in line with
+// their subtasks, walking up for as long as a parent changes. It is best
+// effort: the write the caller made stands even when the rollup fails.
+func (h *Handler) rollup(todo Todos) {
+	for todo.ParentID != "" {
+		parents, err := h.GetTodosByID(todo.Owner, todo.ParentID, 1)
+		if err != nil {
+			fmt.Println("Got error rolling up " + todo.ID + ": " + err.Error())
+			return
+		}
+		if len(parents) == 0 {
+			return
+		}
+
+		child := todo
+		parent, changed, err := h.completeFromChildren(parents[0], &child)
+		if err != nil {
+			fmt.Println("Got error rolling up " + todo.ID + ": " + err.Error())
+			return
+		}
+		if !changed {
+			return
+		}
+		todo = parent
+	}
+}
+
+// trashDescendants moves the subtree of a todo that was just trashed to the
+// trash along with it, under the same DeletedAt so a restore can take the
+// whole subtree back out.
+func (h *Handler) trashDescendants(trashed Todos) {
+	descendants, err := h.descendants(trashed.Owner, trashed.ID, false)
+	if err != nil {
+		fmt.Println("Got error trashing subtasks of " + trashed.ID + ": " + err.Error())
+		return
+	}
+
+	changes := []TodoChange{}
+	for _, todo := range descendants {
+		changes = append(changes, TodoChange{
+			Owner:     todo.Owner,
+			ID:        todo.ID,
+			Title:     todo.Title,
+			UpdatedAt: trashed.DeletedAt,
+			Actor:     trashed.UpdatedBy,
+			DeletedAt: trashed.DeletedAt,
+			ExpiresAt: trashed.ExpiresAt,
+		})
+	}
+	for n, err := range h.Store.UpdateAll(changes) {
+		if err != nil {
+			fmt.Println("Got error trashing subtask " + changes[n].ID + ": " + err.Error())
+			continue
+		}
+		h.reindex(changes[n].apply(descendants[n]))
+	}
+}
+
+// restoreDescendants takes the subtasks trashed along with a todo back out
+// of the trash. Subtasks trashed on their own before stay there.
+func (h *Handler) restoreDescendants(restored Todos, deletedAt string) {
+	changes := []TodoChange{}
+	todos := []Todos{}
+	ids := []string{restored.ID}
+	for len(ids) > 0 {
+		next := []string{}
+		for _, id := range ids {
+			children, err := h.children(restored.Owner, id, true)
+			if err != nil {
+				fmt.Println("Got error restoring subtasks of " + restored.ID + ": " + err.Error())
+				return
+			}
+			for _, todo := range children {
+				if todo.DeletedAt != deletedAt {
+					continue
+				}
+				changes = append(changes, TodoChange{
+					Owner:     todo.Owner,
+					ID:        todo.ID,
+					Title:     todo.Title,
+					UpdatedAt: restored.UpdatedAt,
+					Actor:     restored.UpdatedBy,
+					Restore:   true,
+				})
+				todos = append(todos, todo)
+				next = append(next, todo.ID)
+			}
+		}
+		ids = next
+	}
+
+	for n, err := range h.Store.UpdateAll(changes) {
+		if err != nil {
+			fmt.Println("Got error restoring subtask " + changes[n].ID + ": " + err.Error())
+			continue
+		}
+		h.reindex(changes[n].apply(todos[n]))
+	}
+}
+
+// subtree returns the todo with its subtasks below it, and the progress of
+// every todo that has subtasks.
+func (h *Handler) subtree(todo Todos) (TodoNode, error) {
+	node := TodoNode{Todos: todo}
+	children, err := h.children(todo.Owner, todo.ID, false)
+	if err != nil {
+		return node, err
+	}
+	if len(children) == 0 {
+		return node, nil
+	}
+
+	node.Progress = &TodoProgress{Total: len(children)}
+	for _, child := range children {
+		if child.Completed {
+			node.Progress.Done++
+		}
+		childNode, err := h.subtree(child)
+		if err != nil {
+			return node, err
+		}
+		node.Children = append(node.Children, childNode)
+	}
+	return node, nil
+}
+
+// HandleGetSubtreeRequest returns the todo named by the {id} path parameter
+// with all of its subtasks, nested.
+func (h *Handler) HandleGetSubtreeRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "GET" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	id := request.PathParameters["id"]
+	fmt.Println("[GET] Get subtree: " + id)
+	todo, err := h.todoByID(CallerID(request), id, false)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	node, err := h.subtree(todo)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	responseBody, err := json.Marshal(node)
+	if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	return GenerateResponse(string(responseBody), http.StatusOK), nil
+}
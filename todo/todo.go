@@ -0,0 +1,184 @@
+package todo
+
+// TableName is the DynamoDB table holding every todo item.
+const TableName = "Todos"
+
+// ListTableName is the DynamoDB table holding the todo lists, keyed by ID.
+const ListTableName = "TodoLists"
+
+// ListIndexName is the global secondary index of the Todos table on ListId,
+// which lists the todos of a list without scanning the table.
+const ListIndexName = "ListIndex"
+
+// ListOwnerIndexName is the global secondary index of the TodoLists table
+// on OwnerKey and CreatedAt, which lists the lists of a user.
+const ListOwnerIndexName = "OwnerIndex"
+
+// ParentIndexName is the global secondary index of the Todos table on
+// ParentId, which lists the subtasks of a todo.
+const ParentIndexName = "ParentIndex"
+
+// Todos is a single todo item. The json tags are what the React app sees,
+// the dynamodbav tags match the column names of the Todos table. Version
+// is bumped on every write; items created before it existed read as 0.
+// Owner is the user the todo belongs to, empty for todos created without a
+// signed in user, and ListID the list it is filed under, if any. A subtask
+// names the todo it breaks down in ParentID, and a todo with AutoComplete
+// is completed and reopened along with its subtasks.
+type Todos struct {
+	ID        string `json:"id" dynamodbav:"ID"`
+	Owner     string `json:"-" dynamodbav:"Owner,omitempty"`
+	Title     string `json:"title" dynamodbav:"Title"`
+	Completed bool   `json:"completed" dynamodbav:"Completed"`
+	Version   int64  `json:"version" dynamodbav:"Version"`
+	ListID    string `json:"listId,omitempty" dynamodbav:"ListId,omitempty"`
+	// ParentID is set at creation and never changes, so the hierarchy
+	// cannot form cycles.
+	ParentID     string `json:"parentId,omitempty" dynamodbav:"ParentId,omitempty"`
+	AutoComplete bool   `json:"autoComplete,omitempty" dynamodbav:"AutoComplete,omitempty"`
+	// Position orders the todos of an owner, see positionBetween. OwnerKey
+	// is the Owner as the hash key of PositionIndex and Status the Owner
+	// and Completed as the hash key of StatusIndex, both set on every todo.
+	// DueShard is the hash key of DueIndex, set while the todo is open.
+	Position string `json:"position,omitempty" dynamodbav:"Position,omitempty"`
+	OwnerKey string `json:"-" dynamodbav:"OwnerKey,omitempty"`
+	Status   string `json:"-" dynamodbav:"Status,omitempty"`
+	DueShard string `json:"-" dynamodbav:"DueShard,omitempty"`
+	// Optional details. Items created before they existed simply lack the
+	// attributes. DueAt is RFC 3339, Priority one of Priorities and Tags a
+	// DynamoDB string set.
+	Description string   `json:"description,omitempty" dynamodbav:"Description,omitempty"`
+	DueAt       string   `json:"dueAt,omitempty" dynamodbav:"DueAt,omitempty"`
+	Priority    string   `json:"priority,omitempty" dynamodbav:"Priority,omitempty"`
+	Tags        []string `json:"tags,omitempty" dynamodbav:"Tags,omitempty,stringset"`
+	// Recurrence is an RRULE repeating the todo from its DueAt, in the IANA
+	// TimeZone (UTC when empty). Occurrence numbers the todos of a series
+	// from 1, and NextID links a completed todo to the one it created.
+	Recurrence string `json:"recurrence,omitempty" dynamodbav:"Recurrence,omitempty"`
+	TimeZone   string `json:"timeZone,omitempty" dynamodbav:"TimeZone,omitempty"`
+	Occurrence int64  `json:"occurrence,omitempty" dynamodbav:"Occurrence,omitempty"`
+	NextID     string `json:"nextId,omitempty" dynamodbav:"NextId,omitempty"`
+	// Timestamps (RFC 3339) managed by the handlers, never by clients.
+	// UpdatedBy is who made the last write, the owner or one of the system
+	// actors, for the change history.
+	CreatedAt   string `json:"createdAt,omitempty" dynamodbav:"CreatedAt,omitempty"`
+	UpdatedAt   string `json:"updatedAt,omitempty" dynamodbav:"UpdatedAt,omitempty"`
+	UpdatedBy   string `json:"-" dynamodbav:"UpdatedBy,omitempty"`
+	CompletedAt string `json:"completedAt,omitempty" dynamodbav:"CompletedAt,omitempty"`
+	// DeletedAt is set (RFC 3339) while the todo is in the trash, and
+	// ExpiresAt is the DynamoDB TTL that purges it from there.
+	DeletedAt string `json:"deletedAt,omitempty" dynamodbav:"DeletedAt,omitempty"`
+	ExpiresAt int64  `json:"-" dynamodbav:"ExpiresAt,omitempty"`
+}
+
+// TodosPage is one page of a todo listing. Next is empty on the last page.
+type TodosPage struct {
+	Todos []Todos `json:"todos"`
+	Next  string  `json:"next,omitempty"`
+}
+
+// TodoUpdate is the body of an update request. Title picks the item when
+// the request has to identify it by key, NewTitle renames it and missing
+// fields are left as they are; an empty string (or empty tags) clears an
+// optional field. Version, like an If-Match header, makes the update fail
+// unless the item is still at that version.
+type TodoUpdate struct {
+	Owner        string   `json:"-"`
+	ID           string   `json:"id"`
+	Title        string   `json:"title"`
+	NewTitle     string   `json:"newTitle"`
+	Completed    *bool    `json:"completed"`
+	Description  *string  `json:"description"`
+	DueAt        *string  `json:"dueAt"`
+	Priority     *string  `json:"priority"`
+	Tags         []string `json:"tags"`
+	AutoComplete *bool    `json:"autoComplete"`
+	Recurrence   *string  `json:"recurrence"`
+	TimeZone     *string  `json:"timeZone"`
+	Version      *int64   `json:"version"`
+}
+
+// change is the TodoChange making the update, stamped at now.
+func (update TodoUpdate) change(now string) TodoChange {
+	return TodoChange{
+		Owner:        update.Owner,
+		ID:           update.ID,
+		Title:        update.Title,
+		Completed:    update.Completed,
+		Description:  update.Description,
+		DueAt:        update.DueAt,
+		Priority:     update.Priority,
+		Tags:         update.Tags,
+		AutoComplete: update.AutoComplete,
+		Recurrence:   update.Recurrence,
+		TimeZone:     update.TimeZone,
+		UpdatedAt:    now,
+		Actor:        update.Owner,
+		Version:      update.Version,
+	}
+}
+
+// empty reports whether the update changes nothing besides the title.
+func (update TodoUpdate) empty() bool {
+	return update.Completed == nil && update.Description == nil && update.DueAt == nil &&
+		update.Priority == nil && update.Tags == nil && update.AutoComplete == nil &&
+		update.Recurrence == nil && update.TimeZone == nil
+}
+
+// TodoRef is the body of a delete or restore request.
+type TodoRef struct {
+	Owner   string `json:"-"`
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Version *int64 `json:"version"`
+}
+
+// TodoMove is the body of a move request. An empty ListID takes the todo
+// out of its list.
+type TodoMove struct {
+	Title   string `json:"title"`
+	ListID  string `json:"listId"`
+	Version *int64 `json:"version"`
+}
+
+// TodoProgress is the completion rollup of the subtasks of a todo.
+type TodoProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// TodoNode is a todo with its subtree, as returned by the subtree endpoint.
+// Progress counts the direct subtasks and is left out for leaves.
+type TodoNode struct {
+	Todos
+	Progress *TodoProgress `json:"progress,omitempty"`
+	Children []TodoNode    `json:"children,omitempty"`
+}
+
+// TodoList is a named list grouping the todos of its owner. TodoCount
+// counts the live todos filed under the list and is kept by the store in
+// the same writes that file, trash or restore them, so that only a list
+// it shows as empty can be deleted. OwnerKey keys ListOwnerIndex.
+type TodoList struct {
+	ID        string `json:"id" dynamodbav:"ID"`
+	Owner     string `json:"-" dynamodbav:"Owner,omitempty"`
+	OwnerKey  string `json:"-" dynamodbav:"OwnerKey,omitempty"`
+	Name      string `json:"name" dynamodbav:"Name"`
+	TodoCount int64  `json:"-" dynamodbav:"TodoCount,omitempty"`
+	CreatedAt string `json:"createdAt,omitempty" dynamodbav:"CreatedAt,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty" dynamodbav:"UpdatedAt,omitempty"`
+}
+
+// TodoListsPage is the body of a list listing.
+type TodoListsPage struct {
+	Lists []TodoList `json:"lists"`
+}
+
+// SuccessJson is the body of a successful write, with the item as written
+// and, when completing it started the next occurrence of its series, that
+// todo as Next.
+type SuccessJson struct {
+	Success bool   `json:"success"`
+	Todo    *Todos `json:"todo,omitempty"`
+	Next    *Todos `json:"next,omitempty"`
+}
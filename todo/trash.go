@@ -0,0 +1,100 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashRetentionFromEnv reads the TRASH_RETENTION_DAYS environment variable
+// of the lambda, returning zero (the default retention) when it is unset.
+func TrashRetentionFromEnv() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (h *Handler) trashRetention() time.Duration {
+	if h.TrashRetention > 0 {
+		return h.TrashRetention
+	}
+	return defaultTrashRetention
+}
+
+// RestoreTodo takes the todo back out of the trash, with the subtasks that
+// were trashed along with it.
+func (h *Handler) RestoreTodo(ref TodoRef) (events.APIGatewayProxyResponse, error) {
+	// The DeletedAt the todo was trashed at picks its subtasks to restore
+	trashed, err := h.Store.Get(ref.ID, ref.Title)
+	if err != nil && err != ErrNotFound {
+		return errorResponse(apierror.Internal, err)
+	}
+
+	change := TodoChange{
+		Owner:     ref.Owner,
+		ID:        ref.ID,
+		Title:     ref.Title,
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+		Actor:     ref.Owner,
+		Restore:   true,
+		Version:   ref.Version,
+	}
+
+	restored, err := h.Store.Update(change)
+	if err == ErrNotFound {
+		return errorResponse(apierror.NotFound, err)
+	} else if err == ErrVersionMismatch {
+		return h.writeLost(ref.Owner, ref.ID, ref.Title, true)
+	} else if err != nil {
+		fmt.Println("Got error calling UpdateItem")
+		return errorResponse(apierror.Internal, err)
+	}
+	h.restoreDescendants(restored, trashed.DeletedAt)
+	h.rollup(restored)
+	h.reindex(restored)
+
+	return successResponse(restored)
+}
+
+func (h *Handler) HandleRestoreTodoRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod == "POST" {
+		ref, err := parseRef(request)
+		if err != nil {
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+		ref.Owner = CallerID(request)
+
+		version, err := requestVersion(request, ref.Version)
+		if err != nil {
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+		ref.Version = version
+
+		if ref.ID != "" && ref.ID != "null" {
+			if ref.Title == "" || ref.Title == "null" {
+				trashed, err := h.todoByID(ref.Owner, ref.ID, true)
+				if err != nil {
+					return errorResponse(apierror.Internal, err)
+				}
+				ref.Title = trashed.Title
+			}
+
+			fmt.Println("Restoring: " + ref.ID + " - " + ref.Title)
+			return h.RestoreTodo(ref)
+		} else {
+			err := errors.New("Restoring ID not specified")
+			return errorResponse(apierror.ValidationFailed, err)
+		}
+	} else {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+}
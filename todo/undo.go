@@ -0,0 +1,325 @@
+package todo
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/shikang/aws-lambdas/apierror"
+)
+
+// UndoTableName is the table holding the undo actions handed out, hash key
+// Key, with TTL on ExpiresAt.
+const UndoTableName = "TodoUndo"
+
+const defaultUndoWindow = 5 * time.Minute
+
+// Undo operations, each the inverse of a write.
+const (
+	undoRemove  = "remove"  // of an add
+	undoRevert  = "revert"  // of an update or rename
+	undoRestore = "restore" // of a delete
+)
+
+var (
+	ErrInvalidUndoToken = errors.New("Invalid undo token")
+	ErrUndoExpired      = errors.New("Undo token expired")
+	ErrUndoConflict     = errors.New("Todo changed since")
+	ErrHasSubtasks      = errors.New("Todo has subtasks")
+)
+
+// UndoAction is what an undo token undoes, stored under the Key of the
+// token: the todo of Owner stored under ID and Title, as long as it is
+// still at Version, the version the write left it at. Before is the todo
+// before an update, and Next the occurrence an update started, which the
+// undo removes again. ExpiresAt is the TTL in Unix seconds.
+type UndoAction struct {
+	Key       string `dynamodbav:"Key"`
+	Op        string `dynamodbav:"Op"`
+	Owner     string `dynamodbav:"Owner"`
+	ID        string `dynamodbav:"TodoId"`
+	Title     string `dynamodbav:"Title"`
+	Version   int64  `dynamodbav:"Version"`
+	Before    *Todos `dynamodbav:"Before,omitempty"`
+	Next      string `dynamodbav:"Next,omitempty"`
+	ExpiresAt int64  `dynamodbav:"ExpiresAt"`
+}
+
+// UndoRequest is the body of an undo request.
+type UndoRequest struct {
+	Token string `json:"token"`
+}
+
+func (h *Handler) undoWindow() time.Duration {
+	if h.UndoWindow > 0 {
+		return h.UndoWindow
+	}
+	return defaultUndoWindow
+}
+
+// newUndoToken returns a random key for an undo action and the token
+// naming it, the key signed like the cursors but under its own prefix so
+// one cannot pass for the other.
+func newUndoToken(secret []byte) (string, string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+	key := base64.RawURLEncoding.EncodeToString(random)
+	return key, key + "." + signCursor("undo."+key, secret), nil
+}
+
+// undoKey verifies a token from newUndoToken and returns its key.
+func undoKey(token string, secret []byte) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(secret) == 0 || len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(signCursor("undo."+parts[0], secret))) {
+		return "", ErrInvalidUndoToken
+	}
+	return parts[0], nil
+}
+
+// withUndo stores the action undoing the write and adds the Undo-Token
+// header naming it to the response. Without a secret to sign them no
+// tokens are handed out, and failing to make one does not fail the write.
+func (h *Handler) withUndo(apiResponse events.APIGatewayProxyResponse, err error, action UndoAction) (events.APIGatewayProxyResponse, error) {
+	if err != nil || len(h.CursorSecret) == 0 {
+		return apiResponse, err
+	}
+	key, token, tokenErr := newUndoToken(h.CursorSecret)
+	if tokenErr == nil {
+		action.Key = key
+		action.ExpiresAt = time.Now().Add(h.undoWindow()).Unix()
+		tokenErr = h.Store.PutUndo(action)
+	}
+	if tokenErr != nil {
+		fmt.Println("Got error making undo token: " + tokenErr.Error())
+		return apiResponse, nil
+	}
+	apiResponse.Headers["Undo-Token"] = token
+	return apiResponse, nil
+}
+
+// revertAction is the undo of the update taking before to updated, which
+// may have started the next occurrence.
+func revertAction(before Todos, updated Todos, next *Todos) UndoAction {
+	action := UndoAction{
+		Op:      undoRevert,
+		Owner:   updated.Owner,
+		ID:      updated.ID,
+		Title:   updated.Title,
+		Version: updated.Version,
+		Before:  &before,
+	}
+	if next != nil {
+		action.Next = next.ID
+	}
+	return action
+}
+
+// undoConflict answers an undo of a todo that was written since: 409 with
+// the current item.
+func undoConflict(current Todos) (events.APIGatewayProxyResponse, error) {
+	return conflictResponse(apierror.Conflict, ErrUndoConflict, current)
+}
+
+// revertChange is the change taking current back to before, touching only
+// the fields that differ.
+func revertChange(action UndoAction, current Todos) TodoChange {
+	before := action.Before
+	change := TodoChange{
+		Owner:     action.Owner,
+		ID:        current.ID,
+		Title:     current.Title,
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+		Actor:     action.Owner,
+		Version:   &current.Version,
+	}
+	if before.Completed != current.Completed {
+		change.Completed = &before.Completed
+	}
+	optional := []struct {
+		before  string
+		current string
+		field   **string
+	}{
+		{before.ListID, current.ListID, &change.ListID},
+		{before.Description, current.Description, &change.Description},
+		{before.DueAt, current.DueAt, &change.DueAt},
+		{before.Priority, current.Priority, &change.Priority},
+		{before.Recurrence, current.Recurrence, &change.Recurrence},
+		{before.TimeZone, current.TimeZone, &change.TimeZone},
+	}
+	for _, attr := range optional {
+		if attr.before != attr.current {
+			val := attr.before
+			*attr.field = &val
+		}
+	}
+	if len(before.Tags) != len(current.Tags) || (len(before.Tags) > 0 && !reflect.DeepEqual(before.Tags, current.Tags)) {
+		change.Tags = append([]string{}, before.Tags...)
+	}
+	if before.AutoComplete != current.AutoComplete {
+		change.AutoComplete = &before.AutoComplete
+	}
+	if before.Occurrence != current.Occurrence && before.Occurrence != 0 {
+		change.Occurrence = before.Occurrence
+	}
+	if before.Position != current.Position && before.Position != "" {
+		change.Position = before.Position
+	}
+	if before.NextID != current.NextID {
+		if before.NextID == "" {
+			change.Unlink = true
+		} else {
+			change.NextID = before.NextID
+		}
+	}
+	return change
+}
+
+// removeNext deletes the occurrence a completion started, unless it was
+// written since. Like rollup it is best effort.
+func (h *Handler) removeNext(owner string, id string) {
+	todos, err := h.GetTodosByID(owner, id, 1)
+	if err != nil {
+		fmt.Println("Got error removing next occurrence " + id + ": " + err.Error())
+		return
+	}
+	if len(todos) == 0 || todos[0].Version != 1 {
+		return
+	}
+	next := todos[0]
+	err = h.Store.Delete(next.ID, next.Title, owner, &next.Version)
+	if err != nil {
+		fmt.Println("Got error removing next occurrence " + id + ": " + err.Error())
+		return
+	}
+	next.DeletedAt = time.Now().UTC().Format(time.RFC3339)
+	h.rollup(next)
+	h.reindex(next)
+}
+
+// UndoTodo applies the inverse of the write the action was issued for,
+// provided the todo is still as that write left it.
+func (h *Handler) UndoTodo(action UndoAction) (events.APIGatewayProxyResponse, error) {
+	current, err := h.Store.Get(action.ID, action.Title)
+	if err == nil && current.Owner != action.Owner {
+		err = ErrNotFound
+	}
+	if err == ErrNotFound {
+		// Renamed since, the todo is there under another title
+		todos, lookupErr := h.GetTodosByID(action.Owner, action.ID, 1)
+		if lookupErr == nil && len(todos) > 0 {
+			return undoConflict(todos[0])
+		}
+	}
+	if err == ErrNotFound {
+		return errorResponse(apierror.NotFound, err)
+	} else if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	if current.Version != action.Version {
+		return undoConflict(current)
+	}
+
+	switch action.Op {
+	case undoRemove:
+		children, err := h.children(action.Owner, action.ID, true)
+		if err == nil && len(children) == 0 {
+			children, err = h.children(action.Owner, action.ID, false)
+		}
+		if err != nil {
+			return errorResponse(apierror.Internal, err)
+		}
+		if len(children) > 0 {
+			return errorResponse(apierror.Conflict, ErrHasSubtasks)
+		}
+
+		// To the trash like a delete, so the undo can be undone in turn
+		fmt.Println("Undoing add: " + action.ID + " - " + action.Title)
+		return h.DeleteTodo(TodoRef{Owner: action.Owner, ID: action.ID, Title: action.Title, Version: &action.Version})
+
+	case undoRestore:
+		fmt.Println("Undoing delete: " + action.ID + " - " + action.Title)
+		return h.RestoreTodo(TodoRef{Owner: action.Owner, ID: action.ID, Title: action.Title, Version: &action.Version})
+
+	case undoRevert:
+		if action.Before == nil {
+			break
+		}
+		fmt.Println("Undoing update: " + action.ID + " - " + action.Title)
+		change := revertChange(action, current)
+		if err := change.apply(current).checkRecurrence(); err != nil {
+			return errorResponse(apierror.Conflict, err)
+		}
+		var reverted Todos
+		if action.Before.Title != current.Title {
+			reverted = change.apply(current)
+			reverted.Title = action.Before.Title
+			err = h.Store.Rename(current.Title, reverted, &current.Version)
+		} else if change.ListID != nil {
+			reverted, err = h.Store.Move(change)
+		} else {
+			reverted, err = h.Store.Update(change)
+		}
+		if err == ErrVersionMismatch {
+			return undoConflict(current)
+		} else if err == ErrTitleExists || err == ErrListNotFound {
+			return errorResponse(apierror.Conflict, err)
+		} else if err == ErrNotFound {
+			return errorResponse(apierror.NotFound, err)
+		} else if err != nil {
+			fmt.Println("Got error reverting " + action.ID + ": " + err.Error())
+			return errorResponse(apierror.Internal, err)
+		}
+
+		if change.Completed != nil || change.AutoComplete != nil {
+			h.rollup(reverted)
+		}
+		h.reindex(reverted)
+		if action.Next != "" {
+			h.removeNext(action.Owner, action.Next)
+		}
+		return successResponse(reverted)
+	}
+
+	return errorResponse(apierror.ValidationFailed, ErrInvalidUndoToken)
+}
+
+// HandleUndoRequest undoes the write that handed out the token in the
+// body, within the undo window.
+func (h *Handler) HandleUndoRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "POST" {
+		return errorResponse(apierror.MethodNotAllowed, apierror.ErrMethodNotAllowed)
+	}
+
+	undo := UndoRequest{}
+	err := json.Unmarshal([]byte(request.Body), &undo)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+
+	key, err := undoKey(undo.Token, h.CursorSecret)
+	if err != nil {
+		return errorResponse(apierror.ValidationFailed, err)
+	}
+
+	action, err := h.Store.GetUndo(key)
+	if err == ErrNotFound {
+		return errorResponse(apierror.Gone, ErrUndoExpired)
+	} else if err != nil {
+		return errorResponse(apierror.Internal, err)
+	}
+	if action.Owner != CallerID(request) {
+		return errorResponse(apierror.ValidationFailed, ErrInvalidUndoToken)
+	}
+
+	return h.UndoTodo(action)
+}
@@ -0,0 +1,115 @@
+package todo
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// undoToken runs fn as u1 on the todo and returns the Undo-Token it
+// answered with.
+func undoToken(t *testing.T, fn HandlerFunc, method string, id string, body string) string {
+	t.Helper()
+	request := events.APIGatewayProxyRequest{HTTPMethod: method, Body: body, Headers: map[string]string{}}
+	if id != "" {
+		request.PathParameters = map[string]string{"id": id}
+	}
+	apiResponse, err := fn(WithFakeClaims(request, "u1"))
+	if err != nil || apiResponse.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s: got %d %s (%v)", method, id, apiResponse.StatusCode, apiResponse.Body, err)
+	}
+	token := apiResponse.Headers["Undo-Token"]
+	if token == "" {
+		t.Fatalf("%s %s: no Undo-Token", method, id)
+	}
+	return token
+}
+
+func undo(t *testing.T, h *Handler, owner string, token string) (int, string) {
+	t.Helper()
+	return call(t, h.HandleUndoRequest, "POST", owner, "", `{"token": "`+token+`"}`)
+}
+
+func TestUndo(t *testing.T) {
+	h := newTestHandler()
+
+	// Add: the todo goes to the trash, where it can be restored
+	addToken := undoToken(t, h.HandleAddTodoRequest, "POST", "", `{"title": "buy milk"}`)
+	if strings.Contains(addToken, "buy milk") || len(addToken) > 80 {
+		t.Errorf("token %q carries the action", addToken)
+	}
+	status, body := undo(t, h, "u1", addToken)
+	if status != http.StatusOK {
+		t.Fatalf("undoing add: got %d %s", status, body)
+	}
+	added := writtenTodo(t, body)
+	if added.DeletedAt == "" {
+		t.Errorf("got %+v, want the added todo trashed", added)
+	}
+	if status, _ := call(t, h.HandleRestoreTodoRequest, "POST", "u1", added.ID, ""); status != http.StatusOK {
+		t.Errorf("got %d restoring an undone add, want 200", status)
+	}
+
+	// Update: the changed fields go back
+	todo := addTestTodo(t, h, "u1", "walk dog")
+	updateToken := undoToken(t, h.HandleUpdateTodoRequest, "PATCH", todo.ID, `{"completed": true, "priority": "high"}`)
+	status, body = undo(t, h, "u1", updateToken)
+	if status != http.StatusOK {
+		t.Fatalf("undoing update: got %d %s", status, body)
+	}
+	if reverted := writtenTodo(t, body); reverted.Completed || reverted.Priority != "" {
+		t.Errorf("got %+v, want the update reverted", reverted)
+	}
+
+	// Delete: the todo comes back out of the trash
+	deleteToken := undoToken(t, h.HandleDeleteTodoRequest, "DELETE", todo.ID, "")
+	status, body = undo(t, h, "u1", deleteToken)
+	if status != http.StatusOK {
+		t.Fatalf("undoing delete: got %d %s", status, body)
+	}
+	if restored := writtenTodo(t, body); restored.DeletedAt != "" {
+		t.Errorf("got %+v, want the todo restored", restored)
+	}
+}
+
+func TestUndoFails(t *testing.T) {
+	h := newTestHandler()
+	todo := addTestTodo(t, h, "u1", "buy milk")
+	stale := undoToken(t, h.HandleUpdateTodoRequest, "PATCH", todo.ID, `{"completed": true}`)
+	if status, _ := call(t, h.HandleUpdateTodoRequest, "PATCH", "u1", todo.ID, `{"priority": "high"}`); status != http.StatusOK {
+		t.Fatalf("got %d", status)
+	}
+	fresh := undoToken(t, h.HandleUpdateTodoRequest, "PATCH", todo.ID, `{"priority": "low"}`)
+
+	h.UndoWindow = time.Nanosecond
+	expired := undoToken(t, h.HandleUpdateTodoRequest, "PATCH", todo.ID, `{"priority": "urgent"}`)
+	h.UndoWindow = 0
+
+	cases := []struct {
+		name   string
+		owner  string
+		token  string
+		status int
+	}{
+		{"stale version", "u1", stale, http.StatusConflict},
+		{"expired", "u1", expired, http.StatusGone},
+		{"other owner", "u2", fresh, http.StatusBadRequest},
+		{"forged", "u1", fresh[:strings.Index(fresh, ".")] + ".x", http.StatusBadRequest},
+		{"unknown key", "u1", "nope." + signCursor("undo.nope", h.CursorSecret), http.StatusGone},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if status, body := undo(t, h, c.owner, c.token); status != c.status {
+				t.Errorf("got %d %s, want %d", status, body, c.status)
+			}
+		})
+	}
+
+	stored, _ := h.Store.Get(todo.ID, todo.Title)
+	if stored.Priority != "urgent" || !stored.Completed {
+		t.Errorf("got priority %q, want the failed undos to leave the todo alone", stored.Priority)
+	}
+}
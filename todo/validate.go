@@ -0,0 +1,210 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrRecurringNeedsDueAt is returned for a recurring todo without a due
+// date, which its next occurrence would be worked out from.
+var ErrRecurringNeedsDueAt = errors.New("Recurring todos need a dueAt")
+
+// Priorities lists the allowed priorities, lowest first.
+var Priorities = []string{"low", "medium", "high", "urgent"}
+
+const (
+	maxDescriptionLength = 4000
+	maxTags              = 20
+	maxTagLength         = 50
+	maxListNameLength    = 100
+)
+
+// PriorityRank returns the position of the priority in Priorities, or -1
+// for an unknown priority.
+func PriorityRank(priority string) int {
+	for i, p := range Priorities {
+		if p == priority {
+			return i
+		}
+	}
+	return -1
+}
+
+func validateDescription(description string) error {
+	if len(description) > maxDescriptionLength {
+		return fmt.Errorf("Description longer than %d characters", maxDescriptionLength)
+	}
+	return nil
+}
+
+// normalizeListName trims the name of a list, which must not be empty.
+func normalizeListName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("List name not specified")
+	}
+	if len(name) > maxListNameLength {
+		return "", fmt.Errorf("List name longer than %d characters", maxListNameLength)
+	}
+	return name, nil
+}
+
+// normalizeDueAt checks that the due date is RFC 3339 and stores it in UTC,
+// so due dates compare as plain strings.
+func normalizeDueAt(dueAt string) (string, error) {
+	if dueAt == "" {
+		return "", nil
+	}
+	due, err := time.Parse(time.RFC3339, dueAt)
+	if err != nil {
+		return "", errors.New("Invalid dueAt, expected RFC 3339")
+	}
+	return due.UTC().Format(time.RFC3339), nil
+}
+
+// normalizeRecurrence checks the RRULE and stores it upper-cased without
+// the "RRULE:" prefix.
+func normalizeRecurrence(rule string) (string, error) {
+	if rule == "" {
+		return "", nil
+	}
+	_, err := ParseRecurrence(rule)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:"), nil
+}
+
+func validateTimeZone(timeZone string) error {
+	if timeZone == "" {
+		return nil
+	}
+	_, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return errors.New("Invalid timeZone, expected an IANA time zone such as Europe/Berlin")
+	}
+	return nil
+}
+
+func validatePriority(priority string) error {
+	if priority != "" && PriorityRank(priority) < 0 {
+		return errors.New("Invalid priority, expected one of " + strings.Join(Priorities, ", "))
+	}
+	return nil
+}
+
+// normalizeTags trims, lower-cases, sorts and de-duplicates the tags, as a
+// string set holds each tag once anyway.
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return nil, errors.New("Empty tag")
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("Tag longer than %d characters", maxTagLength)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("More than %d tags", maxTags)
+	}
+
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// validate checks the optional details of a new todo and normalizes them.
+func (todo *Todos) validate() error {
+	err := validateDescription(todo.Description)
+	if err != nil {
+		return err
+	}
+	todo.DueAt, err = normalizeDueAt(todo.DueAt)
+	if err != nil {
+		return err
+	}
+	err = validatePriority(todo.Priority)
+	if err != nil {
+		return err
+	}
+	todo.Tags, err = normalizeTags(todo.Tags)
+	if err != nil {
+		return err
+	}
+	if len(todo.Tags) == 0 {
+		todo.Tags = nil
+	}
+	todo.Recurrence, err = normalizeRecurrence(todo.Recurrence)
+	if err != nil {
+		return err
+	}
+	err = todo.checkRecurrence()
+	if err != nil {
+		return err
+	}
+	return validateTimeZone(todo.TimeZone)
+}
+
+// checkRecurrence checks that a recurring todo has a due date. An update
+// has to pass it as merged with the stored todo.
+func (todo Todos) checkRecurrence() error {
+	if todo.Recurrence != "" && todo.DueAt == "" {
+		return ErrRecurringNeedsDueAt
+	}
+	return nil
+}
+
+// validate checks the fields an update sets and normalizes them.
+func (update *TodoUpdate) validate() error {
+	if update.Description != nil {
+		err := validateDescription(*update.Description)
+		if err != nil {
+			return err
+		}
+	}
+	if update.DueAt != nil {
+		dueAt, err := normalizeDueAt(*update.DueAt)
+		if err != nil {
+			return err
+		}
+		update.DueAt = &dueAt
+	}
+	if update.Priority != nil {
+		err := validatePriority(*update.Priority)
+		if err != nil {
+			return err
+		}
+	}
+	tags, err := normalizeTags(update.Tags)
+	if err != nil {
+		return err
+	}
+	update.Tags = tags
+	if update.Recurrence != nil {
+		rule, err := normalizeRecurrence(*update.Recurrence)
+		if err != nil {
+			return err
+		}
+		update.Recurrence = &rule
+	}
+	if update.TimeZone != nil {
+		err := validateTimeZone(*update.TimeZone)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}